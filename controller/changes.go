@@ -0,0 +1,18 @@
+package main
+
+import (
+	log "github.com/golang/glog"
+
+	"github.com/devops-simba/redns/definitions/changequeue"
+)
+
+// publishChange put a change of the REDIS in the change queue, if the controller has one
+func (this *Controller) publishChange(event changequeue.Event) {
+	if this.changes == nil {
+		return
+	}
+	err := this.changes.Publish(event)
+	if err != nil {
+		log.Errorf("Error in publishing change of %s, it will be retried with the next change: %v", event.Key, err)
+	}
+}
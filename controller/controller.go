@@ -1,18 +1,36 @@
 package main
 
 import (
-	"k8s.io/client-go/kubernetes"
+	"context"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	log "github.com/golang/glog"
 	"github.com/hoisie/redis"
 
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/changequeue"
 	rednsclientset "github.com/devops-simba/redns/definitions/client/clientset/versioned"
+	rednsscheme "github.com/devops-simba/redns/definitions/client/clientset/versioned/scheme"
+	rednsinformers "github.com/devops-simba/redns/definitions/client/informers/externalversions"
 )
 
 const (
@@ -24,79 +42,446 @@ const (
 
 	startingStatus int32 = 10
 	stoppingStatus int32 = 11
+
+	// finalizerName is the finalizer that keep the objects until their data removed from the REDIS
+	finalizerName = "devops.snapp.ir/redns-controller"
+
+	// redisKeyIndex index DNSRecord, DNSLoadBalancer and source objects by the REDIS keys that hold
+	// their addresses
+	redisKeyIndex = "redisKey"
+	// zoneIndex index DNSDomain objects by their zone
+	zoneIndex = "zone"
+
+	recordSyncKind = "record"
+	domainSyncKind = "domain"
 )
 
-type eventType struct {
-	Key          string
-	EventType    string
-	Namespace    string
-	ResourceType string
+func init() {
+	// REDNS objects are added to the kubernetes scheme, so one recorder can record events of both
+	// the REDNS objects and the sources
+	utilruntime.Must(rednsscheme.AddToScheme(kubescheme.Scheme))
+}
+
+// syncKey is an item of the work queue
+type syncKey struct {
+	// Kind is `recordSyncKind` when Name is a REDIS key, `domainSyncKind` when Name is a zone, or
+	// `sourcesSyncKind` to find the keys of the deleted sources
+	Kind string
+	Name string
 }
 
 type Controller struct {
 	// this will be used to update REDNS objects in the REDIS
-	redisClient *redis.Client
-	// this will be used to update REDNS objects in the REDIS
+	redis Store
+	// changes of the REDIS are put here, nil if the change queue is disabled
+	changes *changequeue.Producer
+	// this will be used to update REDNS objects in the kubernetes(their finalizers)
 	rednsClient rednsclientset.Interface
+	// lock of the leader election, nil if this controller is always the leader
+	lock resourcelock.Interface
 	// a flag that indicate we are leader
 	leader int32
-	// this function will be called to stop leader elector
-	stopFunc func()
 	// this will be used to stop informers
 	stopChannel chan struct{}
+	// this will be used to create informers of REDNS objects
+	informerFactory rednsinformers.SharedInformerFactory
 	// this will be used to watch for changes in DNSRecord objects
 	recordInformer cache.SharedIndexInformer
 	// this will be used to watch for changes in DNSLoadBalancer objects
 	loadbalancerInformer cache.SharedIndexInformer
-	// this will be used to wait for completion of different parts
+	// this will be used to watch for changes in DNSDomain objects
+	domainInformer cache.SharedIndexInformer
+	// this will be used to create informers of the sources, nil if no source is enabled
+	kubeInformerFactory kubeinformers.SharedInformerFactory
+	// this will be used to watch for changes in the sources(Service, Ingress and EndpointSlice objects)
+	sourceInformers []cache.SharedIndexInformer
+	// this will be used to read the services, nil if services and endpoints are not published
+	serviceInformer cache.SharedIndexInformer
+	// this will be used to read the endpoints of the headless services, nil if they are not published
+	endpointSliceInformer cache.SharedIndexInformer
+	// the enabled kinds of the sources
+	sources map[string]bool
+	// this will be used to protect the queue
+	mutex sync.RWMutex
+	// changed REDIS keys and zones are queued here until a worker sync them, it only exists while
+	// we are the leader
+	queue workqueue.RateLimitingInterface
+	// this will be closed when we stop leading
+	leading chan struct{}
+	// number of the workers that sync the queue
+	workers int
+	// this will be used to wait for completion of the workers
 	stopped sync.WaitGroup
+	// this will be used to protect healthResults
+	healthMutex sync.Mutex
+	// last health event of the addresses that has a health check by their REDIS key and their
+	// healthResultId, it is only used for the records that servers did not store time of the event in
+	// them. Addresses that no longer exist are evicted whenever their key is synced.
+	healthResults map[string]map[string]rednsv1.DNSHealthCheckResult
+	// this will be used to report drifts as events of the objects
+	recorder record.EventRecorder
+	// interval of checking all of the names for drift, 0 disable the checks
+	resyncInterval time.Duration
+	// driftMode is `driftModeReport` or `driftModeEnforce`
+	driftMode string
+	metrics   Metrics
 }
 
 func NewController(options *ControllerOptions) (*Controller, error) {
-	controller := &Controller{}
+	rednsClient, err := rednsclientset.NewForConfig(options.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(options.KubeConfig)
+	if err != nil {
+		return nil, err
+	}
 
-	var err error
-	controller.rednsClient, err = rednsclientset.NewForConfig(options.KubeConfig)
+	controller, err := newController(rednsClient, NewRedisStore(options.RedisDbUrl), options.Workers)
+	if err != nil {
+		return nil, err
+	}
+	controller.lock = &resourcelock.LeaseLock{
+		Client:     kubeClient.CoordinationV1(),
+		LeaseMeta:  metav1.ObjectMeta{Name: options.LockName, Namespace: options.LockNamespace},
+		LockConfig: resourcelock.ResourceLockConfig{Identity: options.NodeId},
+	}
+	err = controller.watchSources(kubeClient, options.Sources)
 	if err != nil {
 		return nil, err
 	}
+	if options.ChangedDnsObjectsQueue != nil {
+		controller.changes = changequeue.NewProducer(options.ChangedDnsObjectsQueue.CreateQueue())
+	}
+	controller.resyncInterval = options.ResyncInterval
+	controller.driftMode = options.DriftMode
 
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(log.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	controller.recorder = broadcaster.NewRecorder(kubescheme.Scheme,
+		corev1.EventSource{Component: "redns-controller", Host: options.NodeId})
 	return controller, nil
 }
+func newController(rednsClient rednsclientset.Interface, store Store, workers int) (*Controller, error) {
+	controller := &Controller{
+		redis:           store,
+		rednsClient:     rednsClient,
+		stopChannel:     make(chan struct{}),
+		informerFactory: rednsinformers.NewSharedInformerFactory(rednsClient, 0),
+		workers:         workers,
+		healthResults:   make(map[string]map[string]rednsv1.DNSHealthCheckResult),
+		driftMode:       driftModeReport,
+	}
 
-//region Leader Election
-func (this *Controller) onBecomeLeader() {
-	//
+	v1 := controller.informerFactory.Devops().V1()
+	controller.recordInformer = v1.DNSRecords().Informer()
+	controller.loadbalancerInformer = v1.DNSLoadBalancers().Informer()
+	controller.domainInformer = v1.DNSDomains().Informer()
+
+	err := controller.recordInformer.AddIndexers(cache.Indexers{redisKeyIndex: redisKeyIndexFunc})
+	if err != nil {
+		return nil, err
+	}
+	err = controller.loadbalancerInformer.AddIndexers(cache.Indexers{redisKeyIndex: redisKeyIndexFunc})
+	if err != nil {
+		return nil, err
+	}
+	err = controller.domainInformer.AddIndexers(cache.Indexers{zoneIndex: zoneIndexFunc})
+	if err != nil {
+		return nil, err
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    controller.enqueue,
+		UpdateFunc: controller.enqueueUpdate,
+		DeleteFunc: controller.enqueue,
+	}
+	controller.recordInformer.AddEventHandler(handler)
+	controller.loadbalancerInformer.AddEventHandler(handler)
+	controller.domainInformer.AddEventHandler(handler)
+
+	return controller, nil
 }
-func (this *Controller) onStoppedLeading() {
-	//
+
+// IsLeader return `true` if this controller is the leader and may write to the REDIS
+func (this *Controller) IsLeader() bool {
+	return atomic.LoadInt32(&this.leader) != 0
 }
-func (this *Controller) startLeaderElector(options *ControllerOptions) error {
-	restConfig, err := kubernetes.NewForConfig(options.)
+
+// Run start the informers and wait until `stop` closed. Informers of all of the controllers are
+// running, but only the leader run the workers that write to the REDIS.
+func (this *Controller) Run(stop <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+
+	this.informerFactory.Start(this.stopChannel)
+	defer close(this.stopChannel)
+	for informerType, ok := range this.informerFactory.WaitForCacheSync(stop) {
+		if !ok {
+			return fmt.Errorf("Failed to sync cache of %v", informerType)
+		}
+	}
+	if this.kubeInformerFactory != nil {
+		this.kubeInformerFactory.Start(this.stopChannel)
+		for informerType, ok := range this.kubeInformerFactory.WaitForCacheSync(stop) {
+			if !ok {
+				return fmt.Errorf("Failed to sync cache of %v", informerType)
+			}
+		}
+	}
+
+	// followers receive the health events too, so they are ready when they become leader
+	messages := make(chan redis.Message)
+	go this.receiveHealthEvents(messages)
+	go wait.Until(func() { this.subscribeHealthEvents(messages) }, 5*time.Second, stop)
+
+	if this.lock == nil {
+		this.startLeading(stop)
+		<-stop
+		this.stopLeading()
+		return nil
+	}
+	return this.runLeaderElection(stop)
+}
+
+//region Leader Election
+// runLeaderElection take part in the leader election until `stop` closed
+func (this *Controller) runLeaderElection(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		// stop writing to the REDIS before releasing the lease, so the next leader does not race
+		// with our workers
+		this.stopLeading()
+		cancel()
+	}()
+
 	config := leaderelection.LeaderElectionConfig{
-		Lock: &resourcelock.LeaseLock{
-			Client:     result.Client.CoordinationV1(),
-			LeaseMeta:  metav1.ObjectMeta{Name: options.LockName, Namespace: rest.NamespaceNone},
-			LockConfig: resourcelock.ResourceLockConfig{Identity: options.NodeId},
-		},
+		Lock:            this.lock,
 		ReleaseOnCancel: true,
 		LeaseDuration:   15 * time.Second,
 		RenewDeadline:   10 * time.Second,
 		RetryPeriod:     2 * time.Second,
 		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: onBecomeLeader,
-			OnStoppedLeading: onStoppedLeading,
-			OnNewLeader: func(id string) {
-				if id == lock.LockConfig.Identity {
-					onBecomeLeader(nil)
-				} else if this.IsLeader {
-					onStoppedLeading()
-				} else {
-					this.Callbacks.OnLeaderChanged(id)
+			OnStartedLeading: this.onStartedLeading,
+			OnStoppedLeading: this.stopLeading,
+			OnNewLeader: func(identity string) {
+				if identity != this.lock.Identity() {
+					log.Infof("%s is the leader", identity)
 				}
 			},
 		},
 	}
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		return err
+	}
+
+	// a leader that failed to renew its lease go back to the election
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+	this.stopLeading()
+	return nil
+}
+func (this *Controller) onStartedLeading(ctx context.Context) {
+	log.Infof("%s is now the leader", this.lock.Identity())
+	this.startLeading(ctx.Done())
+}
+
+// startLeading start the workers and queue all of the objects, since changes are not queued while
+// we are not the leader. Nothing is started if `stop` is already closed.
+func (this *Controller) startLeading(stop <-chan struct{}) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.queue != nil {
+		return
+	}
+	select {
+	case <-stop:
+		return
+	default:
+	}
+
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "redns")
+	this.queue = queue
+	this.leading = make(chan struct{})
+	atomic.StoreInt32(&this.leader, 1)
+	informers := []cache.SharedIndexInformer{this.recordInformer, this.loadbalancerInformer, this.domainInformer}
+	for _, informer := range append(informers, this.sourceInformers...) {
+		for _, obj := range informer.GetStore().List() {
+			for _, key := range this.syncKeysOf(obj) {
+				queue.Add(key)
+			}
+		}
+	}
+	if len(this.sourceInformers) != 0 {
+		queue.Add(syncKey{Kind: sourcesSyncKind})
+	}
+
+	log.Infof("Starting %d workers", this.workers)
+	for i := 0; i < this.workers; i++ {
+		this.stopped.Add(1)
+		go func() {
+			defer this.stopped.Done()
+			defer utilruntime.HandleCrash()
+			for this.processNextItem(queue) {
+			}
+		}()
+	}
+	this.stopped.Add(1)
+	go func(leading <-chan struct{}) {
+		defer this.stopped.Done()
+		this.runResync(leading)
+	}(this.leading)
+}
+
+// stopLeading stop the workers and wait for completion of the running syncs
+func (this *Controller) stopLeading() {
+	this.mutex.Lock()
+	queue := this.queue
+	this.queue = nil
+	atomic.StoreInt32(&this.leader, 0)
+	if queue != nil {
+		close(this.leading)
+	}
+	this.mutex.Unlock()
+	if queue == nil {
+		return
+	}
+
+	log.Info("Stopping the workers")
+	queue.ShutDown()
+	this.stopped.Wait()
+}
+
+//endregion
+
+//region Queue
+func redisKeyIndexFunc(obj interface{}) ([]string, error) {
+	switch obj := obj.(type) {
+	case *rednsv1.DNSRecord:
+		return []string{recordKey(obj.Spec.Domain, obj.Spec.Name)}, nil
+	case *rednsv1.DNSLoadBalancer:
+		return []string{recordKey(obj.Spec.Domain, obj.Spec.Name)}, nil
+	case *corev1.Service:
+		return sourceKeys(&obj.ObjectMeta), nil
+	case *networkingv1beta1.Ingress:
+		return sourceKeys(&obj.ObjectMeta), nil
+	default:
+		return nil, nil
+	}
+}
+func zoneIndexFunc(obj interface{}) ([]string, error) {
+	if domain, ok := obj.(*rednsv1.DNSDomain); ok {
+		return []string{normalizeZone(domain.Spec.Name)}, nil
+	}
+	return nil, nil
+}
+
+// syncKeysOf return the items of the work queue that sync an object
+func (this *Controller) syncKeysOf(obj interface{}) []syncKey {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	var keys []string
+	switch obj := obj.(type) {
+	case *rednsv1.DNSDomain:
+		return []syncKey{{Kind: domainSyncKind, Name: normalizeZone(obj.Spec.Name)}}
+	case *rednsv1.DNSRecord:
+		// pools that the record is their member are synced too
+		keys, _ = redisKeyIndexFunc(obj)
+		keys = append(keys, this.poolKeys(obj)...)
+	case *corev1.Service:
+		keys, _ = redisKeyIndexFunc(obj)
+		keys = append(keys, this.endpointKeys(obj, nil)...)
+	case *discoveryv1beta1.EndpointSlice:
+		if service := this.sliceService(obj); service != nil {
+			keys = this.endpointKeys(service, obj)
+		}
+	default:
+		keys, _ = redisKeyIndexFunc(obj)
+	}
+	result := make([]syncKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, syncKey{Kind: recordSyncKind, Name: key})
+	}
+	return result
+}
+
+// add queue the keys if we are the leader, followers queue everything when they become leader
+func (this *Controller) add(keys ...syncKey) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if this.queue != nil {
+		for _, key := range keys {
+			this.queue.Add(key)
+		}
+	}
+}
+func (this *Controller) enqueue(obj interface{}) {
+	this.add(this.syncKeysOf(obj)...)
+}
+func (this *Controller) enqueueUpdate(oldObj, newObj interface{}) {
+	// if domain or name of an object changed, its old key must be synced too(the queue ignore the
+	// duplicate keys)
+	this.add(append(this.syncKeysOf(newObj), this.syncKeysOf(oldObj)...)...)
+}
+func (this *Controller) processNextItem(queue workqueue.RateLimitingInterface) bool {
+	item, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(item)
+	// a shut down queue still return its remaining items, but we are no longer the leader
+	if queue.ShuttingDown() {
+		return true
+	}
+
+	key := item.(syncKey)
+	var err error
+	switch key.Kind {
+	case recordSyncKind:
+		err = this.syncRecord(key.Name)
+	case domainSyncKind:
+		err = this.syncDomain(key.Name)
+	case sourcesSyncKind:
+		err = this.syncSourceKeys()
+	}
+
+	if err == nil {
+		queue.Forget(item)
+	} else if queue.NumRequeues(item) < maxRetries {
+		log.Warningf("Error in syncing %s %s, retrying: %v", key.Kind, key.Name, err)
+		queue.AddRateLimited(item)
+	} else {
+		log.Errorf("Error in syncing %s %s, giving up: %v", key.Kind, key.Name, err)
+		queue.Forget(item)
+		utilruntime.HandleError(err)
+	}
+	return true
+}
+
+//endregion
+
+//region Finalizers
+func hasFinalizer(obj *metav1.ObjectMeta) bool {
+	for _, finalizer := range obj.Finalizers {
+		if finalizer == finalizerName {
+			return true
+		}
+	}
+	return false
+}
+func removeFinalizer(finalizers []string) []string {
+	result := make([]string, 0, len(finalizers))
+	for _, finalizer := range finalizers {
+		if finalizer != finalizerName {
+			result = append(result, finalizer)
+		}
+	}
+	return result
 }
 
 //endregion
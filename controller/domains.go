@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/changequeue"
+)
+
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
+
+// findZone return the closest zone that contain a name and has a DNSDomain, or an empty string if
+// there is no such zone
+func (this *Controller) findZone(name string) string {
+	zone := normalizeZone(name)
+	for zone != "" {
+		objs, _ := this.domainInformer.GetIndexer().ByIndex(zoneIndex, zone)
+		for _, obj := range objs {
+			if obj.(*rednsv1.DNSDomain).DeletionTimestamp == nil {
+				return zone
+			}
+		}
+		i := strings.IndexByte(zone, '.')
+		if i == -1 {
+			break
+		}
+		zone = zone[i+1:]
+	}
+	return ""
+}
+
+// enqueueDomainRecords queue the keys of the DNSRecord objects that are in a zone, so the records
+// that had no DNSDomain are synced once it is created and they are marked once it is removed
+func (this *Controller) enqueueDomainRecords(zone string) {
+	for _, obj := range this.recordInformer.GetStore().List() {
+		record := obj.(*rednsv1.DNSRecord)
+		domain := normalizeZone(record.Spec.Domain)
+		if domain == zone || strings.HasSuffix(domain, "."+zone) {
+			this.add(syncKey{Kind: recordSyncKind, Name: recordKey(record.Spec.Domain, record.Spec.Name)})
+			// the record may join or leave the pools, since orphans are not pool members
+			for _, key := range this.poolKeys(record) {
+				this.add(syncKey{Kind: recordSyncKind, Name: key})
+			}
+		}
+	}
+}
+
+// zoneInfo return the zone metadata of a DNSDomain, along with the warnings about the settings that
+// are ignored
+func zoneInfo(domain *rednsv1.DNSDomain) (*definitions.ZoneInfo, []string) {
+	spec := &domain.Spec
+	info := &definitions.ZoneInfo{
+		Nameserver:  spec.Nameserver,
+		Nameservers: spec.Nameservers,
+		Mailbox:     spec.Mailbox,
+		Refresh:     spec.Refresh,
+		Retry:       spec.Retry,
+		Expire:      spec.Expire,
+		DefaultTTL:  spec.DefaultTTL,
+		MinTTL:      spec.MinTTL,
+		MaxTTL:      spec.MaxTTL,
+		NegativeTTL: spec.NegativeTTL,
+		DNSSEC:      spec.DNSSEC,
+	}
+	for _, kind := range spec.AllowedTypes {
+		info.AllowedTypes = append(info.AllowedTypes, strings.ToUpper(kind))
+	}
+
+	var warnings []string
+	for _, network := range spec.TransferACL {
+		if _, _, err := net.ParseCIDR(network); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Ignoring invalid transfer ACL `%s`: %v", network, err))
+			continue
+		}
+		info.TransferACL = append(info.TransferACL, network)
+	}
+	// these are stored, so servers can use them once they support them
+	if len(info.TransferACL) != 0 {
+		warnings = append(warnings, "Transfer ACL has no effect yet, servers do not support zone transfers")
+	}
+	if info.DNSSEC {
+		warnings = append(warnings, "DNSSEC has no effect yet, servers do not sign the zones")
+	}
+	return info, warnings
+}
+
+// syncDomain add a zone and its settings to the REDIS if there is a DNSDomain for it, or remove the
+// zone if there is no such object
+func (this *Controller) syncDomain(zone string) error {
+	objs, err := this.domainInformer.GetIndexer().ByIndex(zoneIndex, zone)
+	if err != nil {
+		return err
+	}
+
+	var live, deleted []*rednsv1.DNSDomain
+	for _, obj := range objs {
+		domain := obj.(*rednsv1.DNSDomain)
+		if domain.DeletionTimestamp != nil {
+			deleted = append(deleted, domain)
+			continue
+		}
+		if !hasFinalizer(&domain.ObjectMeta) {
+			domain, err = this.addDomainFinalizer(domain)
+			if err != nil {
+				return err
+			}
+		}
+		live = append(live, domain)
+	}
+
+	if len(live) == 0 {
+		removed, err := this.redis.RemoveZone(zone)
+		if err != nil {
+			return err
+		}
+		if removed {
+			log.Infof("Removed zone %s", zone)
+			this.enqueueSourceKeys(zone)
+			this.enqueueDomainRecords(zone)
+			this.publishChange(changequeue.Event{
+				Key:       definitions.GetZoneInfoKey(zone),
+				Domain:    zone,
+				Operation: changequeue.Operation_DeleteZone,
+			})
+		}
+	} else {
+		// if multiple objects define the zone, the oldest one wins
+		sort.Slice(live, func(i, j int) bool {
+			if !live[i].CreationTimestamp.Equal(&live[j].CreationTimestamp) {
+				return live[i].CreationTimestamp.Before(&live[j].CreationTimestamp)
+			}
+			return live[i].Name < live[j].Name
+		})
+		if len(live) > 1 {
+			log.Warningf("Zone %s is defined by %d DNSDomain objects, using %s", zone, len(live), live[0].Name)
+		}
+
+		info, warnings := zoneInfo(live[0])
+		changed, err := this.redis.SetZone(zone, info)
+		if err != nil {
+			return err
+		}
+		if changed {
+			log.Infof("Updated zone %s", zone)
+			for _, warning := range warnings {
+				log.Warningf("DNSDomain %s: %s", live[0].Name, warning)
+				this.event(live[0], corev1.EventTypeWarning, "InvalidSettings", warning)
+			}
+			this.enqueueSourceKeys(zone)
+			this.enqueueDomainRecords(zone)
+			this.publishChange(changequeue.Event{
+				Key:       definitions.GetZoneInfoKey(zone),
+				Domain:    zone,
+				Operation: changequeue.Operation_SetZone,
+				Version:   computeObjectVersion(info),
+			})
+		}
+	}
+
+	for _, domain := range deleted {
+		err = this.removeDomainFinalizer(domain)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *Controller) addDomainFinalizer(domain *rednsv1.DNSDomain) (*rednsv1.DNSDomain, error) {
+	domain = domain.DeepCopy()
+	domain.Finalizers = append(domain.Finalizers, finalizerName)
+	return this.rednsClient.DevopsV1().DNSDomains().Update(context.TODO(), domain, metav1.UpdateOptions{})
+}
+func (this *Controller) removeDomainFinalizer(domain *rednsv1.DNSDomain) error {
+	if !hasFinalizer(&domain.ObjectMeta) {
+		return nil
+	}
+	domain = domain.DeepCopy()
+	domain.Finalizers = removeFinalizer(domain.Finalizers)
+	_, err := this.rednsClient.DevopsV1().DNSDomains().Update(context.TODO(), domain, metav1.UpdateOptions{})
+	return err
+}
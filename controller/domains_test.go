@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+)
+
+func TestZoneInfo(t *testing.T) {
+	domain := testDomain("example", "example.com")
+	domain.Spec.Nameservers = []string{"ns1.example.com"}
+	domain.Spec.AllowedTypes = []string{"a", "Aaaa"}
+	info, warnings := zoneInfo(domain)
+	if len(warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+	if info.PrimaryNameserver() != "ns1.example.com" || !info.AllowsType("AAAA") || info.AllowsType("TXT") {
+		t.Errorf("Unexpected settings: %+v", info)
+	}
+
+	// settings that servers do not use are stored with a warning
+	domain.Spec.TransferACL = []string{"192.0.2.0/24", "invalid"}
+	domain.Spec.DNSSEC = true
+	info, warnings = zoneInfo(domain)
+	if len(info.TransferACL) != 1 || info.TransferACL[0] != "192.0.2.0/24" || !info.DNSSEC {
+		t.Errorf("Unexpected settings: %+v", info)
+	}
+	if len(warnings) != 3 {
+		t.Errorf("Expected warnings about the invalid ACL, transfer ACL and DNSSEC, got %v", warnings)
+	}
+
+	domain.Spec = rednsv1.DNSDomainSpec{Name: "example.com", TransferACL: []string{"invalid"}}
+	if _, warnings = zoneInfo(domain); len(warnings) != 1 {
+		t.Errorf("Expected only the warning of the invalid ACL, got %v", warnings)
+	}
+}
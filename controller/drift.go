@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	log "github.com/golang/glog"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+)
+
+const (
+	// driftModeReport only report the names that their REDIS value is changed outside of the controller
+	driftModeReport = "report"
+	// driftModeEnforce report the names that their REDIS value is changed outside of the controller and
+	// write the expected value to them
+	driftModeEnforce = "enforce"
+)
+
+// recordVersion return version of a record regardless of health of its addresses, since servers
+// change it
+func recordVersion(record *definitions.DNSRecord) string {
+	if record == nil {
+		return computeObjectVersion(nil)
+	}
+
+	content, _ := json.Marshal(record)
+	normalized := &definitions.DNSRecord{}
+	json.Unmarshal(content, normalized)
+	for _, address := range normalized.GetAddresses() {
+		address.BaseAddress().Healthy = true
+		address.BaseAddress().HealthChanged = nil
+	}
+	return computeObjectVersion(normalized)
+}
+
+// appliedVersion return version of the record that the controller wrote for the objects the last
+// time, it returns an empty string if no object has a version
+func appliedVersion(records []*rednsv1.DNSRecord, loadbalancers []*rednsv1.DNSLoadBalancer) string {
+	for _, record := range records {
+		if version := getLastAppliedVersion(&record.ObjectMeta); version != "" {
+			return version
+		}
+	}
+	for _, loadbalancer := range loadbalancers {
+		if version := getLastAppliedVersion(&loadbalancer.ObjectMeta); version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+// setAppliedVersion write the version of the record that is written for the objects to them, the
+// objects are replaced with the updated objects
+func (this *Controller) setAppliedVersion(records []*rednsv1.DNSRecord, loadbalancers []*rednsv1.DNSLoadBalancer, version string) error {
+	for i, record := range records {
+		if getLastAppliedVersion(&record.ObjectMeta) == version {
+			continue
+		}
+		record = record.DeepCopy()
+		setLastAppliedVersion(&record.ObjectMeta, version)
+		updated, err := this.rednsClient.DevopsV1().DNSRecords().Update(context.TODO(), record, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		records[i] = updated
+	}
+	for i, loadbalancer := range loadbalancers {
+		if getLastAppliedVersion(&loadbalancer.ObjectMeta) == version {
+			continue
+		}
+		loadbalancer = loadbalancer.DeepCopy()
+		setLastAppliedVersion(&loadbalancer.ObjectMeta, version)
+		updated, err := this.rednsClient.DevopsV1().DNSLoadBalancers().Update(context.TODO(), loadbalancer, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		loadbalancers[i] = updated
+	}
+	return nil
+}
+
+// runResync periodically check all of the names for drift until `stop` closed
+func (this *Controller) runResync(stop <-chan struct{}) {
+	if this.resyncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(this.resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			this.resync(stop)
+		}
+	}
+}
+
+// resync compare REDIS value of every name that has an object or a source with the value that the
+// controller wrote for it, and report the names that are changed outside of the controller. In enforce
+// mode these names are synced again.
+func (this *Controller) resync(stop <-chan struct{}) {
+	keys := make(map[string]bool)
+	if len(this.sourceInformers) != 0 {
+		sourceKeys, err := this.redis.GetSourceKeys()
+		if err != nil {
+			log.Errorf("Error in reading the names of the sources: %v", err)
+		}
+		for _, key := range sourceKeys {
+			keys[key] = true
+		}
+	}
+	for _, key := range this.recordInformer.GetIndexer().ListIndexFuncValues(redisKeyIndex) {
+		keys[key] = true
+	}
+	for _, key := range this.loadbalancerInformer.GetIndexer().ListIndexFuncValues(redisKeyIndex) {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	drifted := 0
+	for _, key := range sortedKeys {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ok, err := this.checkDrift(key)
+		if err != nil {
+			log.Errorf("Error in checking %s for drift: %v", key, err)
+			continue
+		}
+		if ok {
+			drifted++
+		}
+	}
+
+	// names of the sources that are deleted without an event are found too
+	if len(this.sourceInformers) != 0 {
+		this.add(syncKey{Kind: sourcesSyncKind})
+	}
+
+	atomic.AddUint64(&this.metrics.resyncs, 1)
+	atomic.StoreInt64(&this.metrics.driftedKeys, int64(drifted))
+	atomic.StoreInt64(&this.metrics.lastResync, time.Now().Unix())
+	log.Infof("Checked %d names for drift, %d drifted", len(sortedKeys), drifted)
+}
+
+// checkDrift check a name for drift, it returns `true` if the name is drifted
+func (this *Controller) checkDrift(key string) (bool, error) {
+	records, loadbalancers, err := this.liveObjects(key)
+	if err != nil {
+		return false, err
+	}
+	// orphans are not written, so they can't drift
+	records, _ = this.splitOrphanRecords(records)
+	sources, err := this.sourceAddresses(key)
+	if err != nil {
+		return false, err
+	}
+	members, _ := this.poolMembers(loadbalancers)
+	// names without a version are not synced yet, they are in the queue
+	applied := appliedVersion(records, loadbalancers)
+	if len(records) == 0 && len(loadbalancers) == 0 && len(sources) != 0 {
+		// keys that only have sources keep their version in the REDIS
+		applied = this.redis.GetAppliedVersion(key)
+	}
+	if applied == "" {
+		return false, nil
+	}
+
+	current, err := this.redis.GetRecord(key)
+	currentVersion := "invalid"
+	if err == nil {
+		currentVersion = recordVersion(current)
+		if currentVersion == applied {
+			return false, nil
+		}
+		// objects are changed and the change is already written, but not their version
+		if expected, _ := buildRecord(current, records, loadbalancers, members, sources); recordVersion(expected) == currentVersion {
+			return false, nil
+		}
+	}
+
+	message := fmt.Sprintf("REDIS value of %s is changed outside of the controller(expected version %s, found %s)",
+		key, applied, currentVersion)
+	if this.driftMode == driftModeEnforce {
+		message += ", it will be replaced"
+		atomic.AddUint64(&this.metrics.corrections, 1)
+		this.add(syncKey{Kind: recordSyncKind, Name: key})
+	}
+	log.Warning(message)
+	atomic.AddUint64(&this.metrics.drifts, 1)
+	for _, record := range records {
+		this.event(record, corev1.EventTypeWarning, "Drifted", message)
+	}
+	for _, loadbalancer := range loadbalancers {
+		this.event(loadbalancer, corev1.EventTypeWarning, "Drifted", message)
+	}
+	reported := make(map[string]bool)
+	for _, source := range sources {
+		if !reported[source.Ref] {
+			reported[source.Ref] = true
+			this.event(source.Object, corev1.EventTypeWarning, "Drifted", message)
+		}
+	}
+	return true, nil
+}
+
+// liveObjects return the objects of a REDIS key that are not deleted
+func (this *Controller) liveObjects(key string) ([]*rednsv1.DNSRecord, []*rednsv1.DNSLoadBalancer, error) {
+	objs, err := this.recordInformer.GetIndexer().ByIndex(redisKeyIndex, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []*rednsv1.DNSRecord
+	for _, obj := range objs {
+		if record := obj.(*rednsv1.DNSRecord); record.DeletionTimestamp == nil {
+			records = append(records, record)
+		}
+	}
+
+	objs, err = this.loadbalancerInformer.GetIndexer().ByIndex(redisKeyIndex, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var loadbalancers []*rednsv1.DNSLoadBalancer
+	for _, obj := range objs {
+		if loadbalancer := obj.(*rednsv1.DNSLoadBalancer); loadbalancer.DeletionTimestamp == nil {
+			loadbalancers = append(loadbalancers, loadbalancer)
+		}
+	}
+	return records, loadbalancers, nil
+}
+
+// event record an event for an object, if the controller has a recorder
+func (this *Controller) event(obj runtime.Object, eventType, reason, message string) {
+	if this.recorder != nil {
+		this.recorder.Event(obj, eventType, reason, message)
+	}
+}
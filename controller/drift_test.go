@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/client/clientset/versioned/fake"
+)
+
+func TestRecordVersionIgnoreHealth(t *testing.T) {
+	healthCheck := &definitions.HealthCheck{Type: definitions.HealthCheck_TCP, Target: "192.0.2.1:80"}
+	record := &definitions.DNSRecord{}
+	record.AddAddress(definitions.Kind_A, "192.0.2.1", definitions.DNS_Address{Enabled: true, Healthy: true, HealthCheck: healthCheck}, 0)
+	version := recordVersion(record)
+
+	now := time.Now()
+	record.ARecords.Addresses[0].Healthy = false
+	record.ARecords.Addresses[0].HealthChanged = &now
+	if recordVersion(record) != version {
+		t.Error("Version changed with the health of an address")
+	}
+	if record.ARecords.Addresses[0].Healthy {
+		t.Error("Version changed the record")
+	}
+
+	record.ARecords.Addresses[0].IP = "192.0.2.2"
+	if recordVersion(record) == version {
+		t.Error("Version did not change with the address")
+	}
+	if recordVersion(nil) == version {
+		t.Error("Version of a missing record must differ")
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	for _, mode := range []string{driftModeReport, driftModeEnforce} {
+		t.Run(mode, func(t *testing.T) {
+			store := newMemoryStore()
+			client := fake.NewSimpleClientset()
+			controller, err := newController(client, store, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := record.NewFakeRecorder(10)
+			controller.recorder = recorder
+			controller.driftMode = mode
+			startController(t, controller)
+
+			createDomain(t, client, testDomain("example", "example.com"))
+			createRecord(t, client, withHealthCheck(testRecord("a", definitions.Kind_A, "192.0.2.1")))
+			// checkDrift read the version from the cache of the controller
+			waitUntil(t, "the applied version", func() bool {
+				obj, ok, _ := controller.recordInformer.GetIndexer().GetByKey("a")
+				if !ok {
+					return false
+				}
+				object := obj.(*rednsv1.DNSRecord)
+				return getLastAppliedVersion(&object.ObjectMeta) != "" &&
+					conditionOf(object.Status.Conditions, rednsv1.ConditionSynced) == "True/Synced"
+			})
+
+			// servers change the health, that is not a drift
+			current, _ := store.GetRecord("www.example.com")
+			current.ARecords.Addresses[0].Healthy = false
+			store.SetRecord("www.example.com", current)
+			if drifted, err := controller.checkDrift("www.example.com"); err != nil || drifted {
+				t.Fatalf("Health change is reported as drift: %v", err)
+			}
+
+			current.ARecords.Addresses[0].IP = "198.51.100.1"
+			store.SetRecord("www.example.com", current)
+			if drifted, err := controller.checkDrift("www.example.com"); err != nil || !drifted {
+				t.Fatalf("Drift is not found: %v", err)
+			}
+			if drifts := atomic.LoadUint64(&controller.metrics.drifts); drifts != 1 {
+				t.Errorf("Expected 1 drift, got %d", drifts)
+			}
+			select {
+			case event := <-recorder.Events:
+				if !strings.Contains(event, "Drifted") {
+					t.Errorf("Unexpected event: %s", event)
+				}
+			default:
+				t.Error("No event is recorded for the drift")
+			}
+
+			if mode == driftModeEnforce {
+				waitUntil(t, "the correction", func() bool {
+					record, _ := store.GetRecord("www.example.com")
+					return record != nil && record.ARecords.Addresses[0].IP == "192.0.2.1"
+				})
+				return
+			}
+
+			// a sync of the key in report mode keep the value and mark the objects
+			controller.add(syncKey{Kind: recordSyncKind, Name: "www.example.com"})
+			waitUntil(t, "the drifted status", func() bool {
+				return conditionOf(getRecord(client, "a").Status.Conditions, rednsv1.ConditionSynced) == "False/Drifted"
+			})
+			if record, _ := store.GetRecord("www.example.com"); record.ARecords.Addresses[0].IP != "198.51.100.1" {
+				t.Fatalf("Value is replaced in the report mode: %+v", record)
+			}
+
+			// changes of the objects are still written
+			object := getRecord(client, "a")
+			object.Spec.Value = "192.0.2.5"
+			object.Spec.HealthCheck.Server = "192.0.2.5:80"
+			_, err = client.DevopsV1().DNSRecords().Update(context.TODO(), object, metav1.UpdateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitUntil(t, "the change of the object", func() bool {
+				record, _ := store.GetRecord("www.example.com")
+				return record != nil && record.ARecords.Addresses[0].IP == "192.0.2.5" &&
+					conditionOf(getRecord(client, "a").Status.Conditions, rednsv1.ConditionSynced) == "True/Synced"
+			})
+		})
+	}
+}
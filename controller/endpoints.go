@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+const (
+	// serviceIndex index EndpointSlice objects by `namespace/name` of their service
+	serviceIndex = "service"
+)
+
+func serviceIndexFunc(obj interface{}) ([]string, error) {
+	if slice, ok := obj.(*discoveryv1beta1.EndpointSlice); ok {
+		if name := slice.Labels[discoveryv1beta1.LabelServiceName]; name != "" {
+			return []string{slice.Namespace + "/" + name}, nil
+		}
+	}
+	return nil, nil
+}
+func isHeadless(service *corev1.Service) bool {
+	return service.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+// endpointLabel return the label of the name of an endpoint, that is hostname of the pod or name of
+// the pod if it has no hostname
+func endpointLabel(endpoint *discoveryv1beta1.Endpoint) string {
+	if endpoint.Hostname != nil && *endpoint.Hostname != "" {
+		return strings.ToLower(*endpoint.Hostname)
+	}
+	if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" && endpoint.TargetRef.Name != "" {
+		return strings.ToLower(endpoint.TargetRef.Name)
+	}
+	if len(endpoint.Addresses) != 0 {
+		return strings.NewReplacer(".", "-", ":", "-").Replace(endpoint.Addresses[0])
+	}
+	return ""
+}
+
+// endpointRecords return the addresses of the endpoints of a headless service by their REDIS key.
+// Every name of the service has the addresses of all of the endpoints, `<pod>.<name>` has the
+// addresses of a pod and `_<port>._<protocol>.<name>` has an SRV address for every pod. Addresses
+// of the endpoints that are not ready are unhealthy.
+func endpointRecords(service *corev1.Service, slices []*discoveryv1beta1.EndpointSlice) map[string][]sourceAddress {
+	result := make(map[string][]sourceAddress)
+	if !isHeadless(service) || service.DeletionTimestamp != nil {
+		return result
+	}
+
+	ref := objectRef(serviceKind, service.Namespace+"/"+service.Name)
+	ttl := sourceTTL(&service.ObjectMeta)
+	add := func(name, kind, value string, healthy bool) {
+		key := definitions.NameToRedisKey(name)
+		result[key] = append(result[key], sourceAddress{
+			Ref:     ref,
+			Object:  service,
+			Kind:    kind,
+			Value:   value,
+			TTL:     ttl,
+			Healthy: healthy,
+		})
+	}
+	for _, hostname := range sourceHostnames(&service.ObjectMeta) {
+		for _, slice := range slices {
+			for i := range slice.Endpoints {
+				endpoint := &slice.Endpoints[i]
+				label := endpointLabel(endpoint)
+				if label == "" {
+					continue
+				}
+				// a nil condition means the endpoint is ready
+				ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+				for _, address := range endpoint.Addresses {
+					kind := addressKind(address)
+					if kind == definitions.Kind_CNAME {
+						continue
+					}
+					add(hostname, kind, address, ready)
+					add(label+"."+hostname, kind, address, ready)
+				}
+
+				for _, port := range slice.Ports {
+					if port.Name == nil || *port.Name == "" || port.Port == nil || port.Protocol == nil {
+						continue
+					}
+					name := "_" + *port.Name + "._" + strings.ToLower(string(*port.Protocol)) + "." + hostname
+					add(name, definitions.Kind_SRV, label+"."+hostname+":"+strconv.Itoa(int(*port.Port)), ready)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// serviceSlices return the EndpointSlice objects of a service
+func (this *Controller) serviceSlices(service *corev1.Service) []*discoveryv1beta1.EndpointSlice {
+	if this.endpointSliceInformer == nil {
+		return nil
+	}
+	objs, _ := this.endpointSliceInformer.GetIndexer().ByIndex(serviceIndex, service.Namespace+"/"+service.Name)
+	result := make([]*discoveryv1beta1.EndpointSlice, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, obj.(*discoveryv1beta1.EndpointSlice))
+	}
+	return result
+}
+
+// sliceService return the service of an EndpointSlice, or nil if it is not in the cache
+func (this *Controller) sliceService(slice *discoveryv1beta1.EndpointSlice) *corev1.Service {
+	keys, _ := serviceIndexFunc(slice)
+	if len(keys) == 0 || this.serviceInformer == nil {
+		return nil
+	}
+	obj, exists, _ := this.serviceInformer.GetStore().GetByKey(keys[0])
+	if !exists {
+		return nil
+	}
+	return obj.(*corev1.Service)
+}
+
+// endpointKeys return the REDIS keys of the endpoints of a headless service, if `slice` is not nil
+// only keys of its endpoints are returned
+func (this *Controller) endpointKeys(service *corev1.Service, slice *discoveryv1beta1.EndpointSlice) []string {
+	if this.endpointSliceInformer == nil {
+		return nil
+	}
+	slices := []*discoveryv1beta1.EndpointSlice{slice}
+	if slice == nil {
+		slices = this.serviceSlices(service)
+	}
+	var result []string
+	for key := range endpointRecords(service, slices) {
+		result = append(result, key)
+	}
+	return result
+}
+
+// endpointAddresses return the addresses of the endpoints that are published under a REDIS key.
+// A key may be a name of a headless service, a name of a pod of it or a name of a port of it, so
+// the service is searched in the key and its two parents.
+func (this *Controller) endpointAddresses(key string) ([]sourceAddress, error) {
+	if this.endpointSliceInformer == nil {
+		return nil, nil
+	}
+
+	var result []sourceAddress
+	seen := make(map[string]bool)
+	name := key
+	for i := 0; i < 3; i++ {
+		objs, err := this.serviceInformer.GetIndexer().ByIndex(redisKeyIndex, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			service := obj.(*corev1.Service)
+			ref := service.Namespace + "/" + service.Name
+			if !isHeadless(service) || seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			result = append(result, endpointRecords(service, this.serviceSlices(service))[key]...)
+		}
+
+		dot := strings.IndexByte(name, '.')
+		if dot == -1 {
+			break
+		}
+		name = name[dot+1:]
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+func TestEndpointRecords(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "db",
+			Namespace:   "ns",
+			Annotations: map[string]string{hostnameAnnotation: "db.example.com"},
+		},
+		Spec: corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+	}
+	ready, notReady := true, false
+	hostname := "db-0"
+	portName, protocol, port := "pg", corev1.ProtocolTCP, int32(5432)
+	slice := &discoveryv1beta1.EndpointSlice{
+		ObjectMeta:  metav1.ObjectMeta{Name: "db-abc", Namespace: "ns"},
+		AddressType: discoveryv1beta1.AddressTypeIPv4,
+		Endpoints: []discoveryv1beta1.Endpoint{{
+			Addresses:  []string{"10.0.0.1"},
+			Hostname:   &hostname,
+			Conditions: discoveryv1beta1.EndpointConditions{Ready: &ready},
+		}, {
+			Addresses:  []string{"10.0.0.2"},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: "db-x"},
+			Conditions: discoveryv1beta1.EndpointConditions{Ready: &notReady},
+		}},
+		Ports: []discoveryv1beta1.EndpointPort{{Name: &portName, Protocol: &protocol, Port: &port}},
+	}
+
+	result := endpointRecords(service, []*discoveryv1beta1.EndpointSlice{slice})
+	type address struct {
+		kind, value string
+		healthy     bool
+	}
+	expected := map[string][]address{
+		"db.example.com": {
+			{definitions.Kind_A, "10.0.0.1", true},
+			{definitions.Kind_A, "10.0.0.2", false},
+		},
+		"db-0.db.example.com": {{definitions.Kind_A, "10.0.0.1", true}},
+		"db-x.db.example.com": {{definitions.Kind_A, "10.0.0.2", false}},
+		"_pg._tcp.db.example.com": {
+			{definitions.Kind_SRV, "db-0.db.example.com:5432", true},
+			{definitions.Kind_SRV, "db-x.db.example.com:5432", false},
+		},
+	}
+	if len(result) != len(expected) {
+		t.Errorf("Expected %d names, got %d: %v", len(expected), len(result), result)
+	}
+	for key, addresses := range expected {
+		actual := result[key]
+		if len(actual) != len(addresses) {
+			t.Errorf("Expected %d addresses for %s, got %v", len(addresses), key, actual)
+			continue
+		}
+		for i, address := range addresses {
+			if actual[i].Kind != address.kind || actual[i].Value != address.value || actual[i].Healthy != address.healthy {
+				t.Errorf("Expected %v for %s, got %+v", address, key, actual[i])
+			}
+		}
+	}
+
+	service.Spec.ClusterIP = "10.96.0.10"
+	if result := endpointRecords(service, []*discoveryv1beta1.EndpointSlice{slice}); len(result) != 0 {
+		t.Errorf("Expected no address for a service that is not headless, got %v", result)
+	}
+}
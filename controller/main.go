@@ -2,8 +2,11 @@ package main
 
 import (
 	"flag"
+	"net/http"
 
 	log "github.com/golang/glog"
+
+	"github.com/devops-simba/redns/definitions/signals"
 )
 
 func main() {
@@ -19,4 +22,21 @@ func main() {
 		log.Fatalf("Failed to start the controller: %v", err)
 	}
 
+	if options.MetricsAddress != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", controller.ServeMetrics)
+		go func() {
+			err := http.ListenAndServe(options.MetricsAddress, mux)
+			if err != nil {
+				log.Errorf("Error in serving the metrics: %v", err)
+			}
+		}()
+	}
+
+	stop := signals.SetupSignalHandler(1)
+	err = controller.Run(stop)
+	if err != nil {
+		log.Fatalf("Error in running the controller: %v", err)
+	}
+	log.Info("Controller stopped")
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoisie/redis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/client/clientset/versioned/fake"
+)
+
+// memoryStore is a Store that keep everything in the memory, records are kept in JSON like REDIS
+type memoryStore struct {
+	mutex           sync.Mutex
+	records         map[string][]byte
+	zones           map[string]*definitions.ZoneInfo
+	sourceKeys      map[string]bool
+	appliedVersions map[string]string
+	// err is returned by UpdateRecord, if it is not nil
+	err error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		records:         make(map[string][]byte),
+		zones:           make(map[string]*definitions.ZoneInfo),
+		sourceKeys:      make(map[string]bool),
+		appliedVersions: make(map[string]string),
+	}
+}
+
+func (this *memoryStore) GetRecord(key string) (*definitions.DNSRecord, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.getRecord(key)
+}
+func (this *memoryStore) getRecord(key string) (*definitions.DNSRecord, error) {
+	content, ok := this.records[key]
+	if !ok {
+		return nil, nil
+	}
+	record := &definitions.DNSRecord{}
+	err := json.Unmarshal(content, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// SetRecord replace the record of a key, like the servers or a user that edit the REDIS
+func (this *memoryStore) SetRecord(key string, record *definitions.DNSRecord) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.records[key], _ = json.Marshal(record)
+}
+
+func (this *memoryStore) UpdateRecord(key string, update func(current *definitions.DNSRecord) *definitions.DNSRecord) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.err != nil {
+		return false, this.err
+	}
+
+	current, _ := this.getRecord(key)
+	record := update(current)
+	if record == nil {
+		_, ok := this.records[key]
+		delete(this.records, key)
+		return ok, nil
+	}
+	content, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(content, this.records[key]) {
+		return false, nil
+	}
+	this.records[key] = content
+	return true, nil
+}
+
+func (this *memoryStore) SetZone(zone string, info *definitions.ZoneInfo) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	current, ok := this.zones[zone]
+	this.zones[zone] = info
+	if !ok {
+		return true, nil
+	}
+	content, _ := json.Marshal(info)
+	currentContent, _ := json.Marshal(current)
+	return !bytes.Equal(content, currentContent), nil
+}
+func (this *memoryStore) RemoveZone(zone string) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	_, ok := this.zones[zone]
+	delete(this.zones, zone)
+	return ok, nil
+}
+
+// HasZone return `true` if a zone is added to the store
+func (this *memoryStore) HasZone(zone string) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	_, ok := this.zones[zone]
+	return ok
+}
+
+func (this *memoryStore) SetSourceKey(key string, hasSource bool) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if hasSource {
+		this.sourceKeys[key] = true
+	} else {
+		delete(this.sourceKeys, key)
+	}
+	return nil
+}
+func (this *memoryStore) GetSourceKeys() ([]string, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	result := make([]string, 0, len(this.sourceKeys))
+	for key := range this.sourceKeys {
+		result = append(result, key)
+	}
+	return result, nil
+}
+func (this *memoryStore) SetAppliedVersion(key, version string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if version == "" {
+		delete(this.appliedVersions, key)
+	} else {
+		this.appliedVersions[key] = version
+	}
+	return nil
+}
+func (this *memoryStore) GetAppliedVersion(key string) string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.appliedVersions[key]
+}
+
+// SubscribeHealthEvents does nothing, tests call handleHealthEvent to send the events
+func (this *memoryStore) SubscribeHealthEvents(messages chan<- redis.Message) error {
+	return nil
+}
+
+var errStoreFailed = errors.New("Store failed")
+
+//region Helpers
+// startTestController start a controller that write to `store`, it is stopped when the test ends
+func startTestController(t *testing.T, store Store) (*Controller, *fake.Clientset) {
+	client := fake.NewSimpleClientset()
+	controller, err := newController(client, store, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startController(t, controller)
+	return controller, client
+}
+
+// startController run a controller until the test ends
+func startController(t *testing.T, controller *Controller) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		controller.Run(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+// waitUntil wait until `done` returns true, the test fails if it does not in a few seconds
+func waitUntil(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if done() {
+			return
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+	t.Fatalf("Timeout in waiting for %s", what)
+}
+
+func testDomain(name, zone string) *rednsv1.DNSDomain {
+	return &rednsv1.DNSDomain{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       rednsv1.DNSDomainSpec{Name: zone},
+	}
+}
+
+// testRecord return an enabled DNSRecord for www.example.com
+func testRecord(name, kind, value string) *rednsv1.DNSRecord {
+	return &rednsv1.DNSRecord{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: rednsv1.DNSRecordSpec{
+			Domain:  "example.com",
+			Name:    "www",
+			Type:    kind,
+			Value:   value,
+			Weight:  1,
+			TTL:     30,
+			Enabled: true,
+		},
+	}
+}
+
+// withHealthCheck add a tcp health check to a DNSRecord
+func withHealthCheck(record *rednsv1.DNSRecord) *rednsv1.DNSRecord {
+	record.Spec.HealthCheck = &rednsv1.DNSRecordHealthCheck{
+		HealthCheck: definitions.HealthCheck{Type: definitions.HealthCheck_TCP},
+		Server:      record.Spec.Value + ":80",
+	}
+	return record
+}
+
+func createRecord(t *testing.T, client *fake.Clientset, record *rednsv1.DNSRecord) {
+	_, err := client.DevopsV1().DNSRecords().Create(context.TODO(), record, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+func createDomain(t *testing.T, client *fake.Clientset, domain *rednsv1.DNSDomain) {
+	_, err := client.DevopsV1().DNSDomains().Create(context.TODO(), domain, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+func getRecord(client *fake.Clientset, name string) *rednsv1.DNSRecord {
+	record, err := client.DevopsV1().DNSRecords().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return &rednsv1.DNSRecord{}
+	}
+	return record
+}
+
+// conditionOf return `<status>/<reason>` of a condition, or `-` if there is no such condition
+func conditionOf(conditions []rednsv1.DNSCondition, conditionType string) string {
+	condition := rednsv1.FindCondition(conditions, conditionType)
+	if condition == nil {
+		return "-"
+	}
+	return string(condition.Status) + "/" + condition.Reason
+}
+
+//endregion
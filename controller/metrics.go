@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics are the counters of the controller
+type Metrics struct {
+	// resyncs is the number of the completed full resyncs
+	resyncs uint64
+	// drifts is the number of the drifts that are detected
+	drifts uint64
+	// corrections is the number of the drifts that are corrected
+	corrections uint64
+	// driftedKeys is the number of the drifted names in the last resync
+	driftedKeys int64
+	// lastResync is the unix time of the last resync
+	lastResync int64
+}
+
+// ServeMetrics write the metrics of the controller in the prometheus text format
+func (this *Controller) ServeMetrics(w http.ResponseWriter, req *http.Request) {
+	leader := 0
+	if this.IsLeader() {
+		leader = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "redns_controller_leader", "gauge",
+		"Whether this controller is the leader", leader)
+	writeMetric(w, "redns_controller_resyncs_total", "counter",
+		"Number of the completed full resyncs", atomic.LoadUint64(&this.metrics.resyncs))
+	writeMetric(w, "redns_controller_drifts_total", "counter",
+		"Number of the names that their REDIS value found changed outside of the controller", atomic.LoadUint64(&this.metrics.drifts))
+	writeMetric(w, "redns_controller_drift_corrections_total", "counter",
+		"Number of the drifted names that are synced again", atomic.LoadUint64(&this.metrics.corrections))
+	writeMetric(w, "redns_controller_drifted_names", "gauge",
+		"Number of the drifted names in the last resync", atomic.LoadInt64(&this.metrics.driftedKeys))
+	writeMetric(w, "redns_controller_last_resync_timestamp_seconds", "gauge",
+		"Unix time of the last resync", atomic.LoadInt64(&this.metrics.lastResync))
+}
+func writeMetric(w http.ResponseWriter, name, metricType, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, metricType, name, value)
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/openshift/kubernetes/staging/src/k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/rest"
 )
 
 const (
@@ -14,18 +17,39 @@ const (
 	KUBECONFIG_PATH = "KUBECONFIG_PATH"
 	ELECTION_LOCK   = "ELECTION_LOCK"
 	CHANGE_QUEUE    = "CHANGE_QUEUE"
+	WORKERS         = "WORKERS"
+	RESYNC_INTERVAL = "RESYNC_INTERVAL"
+	DRIFT_MODE      = "DRIFT_MODE"
+	METRICS_ADDRESS = "METRICS_ADDRESS"
+	SOURCES         = "SOURCES"
 )
 
 var (
 	DefaultKubeConfigPath = os.Getenv("HOME") + "/.kube/config"
+	// namespaceFile contain namespace of the pod when we are running in a cluster
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 type ControllerOptions struct {
-	NodeId                 string
-	LockName               string
-	RedisDbUrl             *RedisUrl
+	NodeId string
+	// LockNamespace and LockName are namespace and name of the Lease of the leader election
+	LockNamespace string
+	LockName      string
+	RedisDbUrl    *RedisUrl
+	// ChangedDnsObjectsQueue is the queue that changes of the REDIS are put in it, nil if it is disabled
 	ChangedDnsObjectsQueue *RedisUrl
 	KubeConfig             *rest.Config
+	// Workers is number of the objects that synced concurrently
+	Workers int
+	// ResyncInterval is the interval of checking all of the names for drift, 0 disable the checks
+	ResyncInterval time.Duration
+	// DriftMode is `report` to only report the drifts, or `enforce` to also correct them
+	DriftMode string
+	// MetricsAddress is the address of the metrics HTTP server, empty disable the server
+	MetricsAddress string
+	// Sources is the kinds of the kubernetes objects that their addresses are published, `service`,
+	// `ingress` and `endpointslice`(pods of the headless services)
+	Sources []string
 }
 
 func NewControllerOptionsFromEnv() (*ControllerOptions, error) {
@@ -40,17 +64,50 @@ func NewControllerOptionsFromEnv() (*ControllerOptions, error) {
 		return nil, err
 	}
 
-	changedDnsObjectsUrl, err := ParseRedisUrl(ReadEnv(CHANGE_QUEUE, redisUrlValue), "changes")
+	// the queue is only filled if someone consume it, so it is disabled unless a queue is set
+	var changedDnsObjectsUrl *RedisUrl
+	if changeQueue := ReadEnv(CHANGE_QUEUE, "none"); changeQueue != "none" {
+		changedDnsObjectsUrl, err = ParseRedisUrl(changeQueue, "changes")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := loadKubeConfig(ReadEnv(KUBECONFIG_PATH, DefaultKubeConfigPath))
 	if err != nil {
 		return nil, err
 	}
 
-	configPath := ReadEnv(KUBECONFIG_PATH, DefaultKubeConfigPath)
-	config, err := rest.InClusterConfig()
+	lockNamespace, lockName, err := parseElectionLock(ReadEnv(ELECTION_LOCK, "redns-controller"))
 	if err != nil {
-		config, err = clientcmd.BuildConfigFromFlags("", this.KubeConfigPath)
-		if err != nil {
-			return err
+		return nil, err
+	}
+
+	workers, err := strconv.Atoi(ReadEnv(WORKERS, "4"))
+	if err != nil || workers <= 0 {
+		return nil, fmt.Errorf("Invalid `%s`, it must be a positive number", WORKERS)
+	}
+
+	resyncInterval, err := time.ParseDuration(ReadEnv(RESYNC_INTERVAL, "5m"))
+	if err != nil || resyncInterval < 0 {
+		return nil, fmt.Errorf("Invalid `%s`, it must be a non-negative duration", RESYNC_INTERVAL)
+	}
+
+	driftMode := ReadEnv(DRIFT_MODE, driftModeReport)
+	if driftMode != driftModeReport && driftMode != driftModeEnforce {
+		return nil, fmt.Errorf("Invalid `%s`, it must be `%s` or `%s`", DRIFT_MODE, driftModeReport, driftModeEnforce)
+	}
+
+	var sources []string
+	for _, source := range strings.Split(ReadEnv(SOURCES, ""), ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		switch source {
+		case "":
+		case serviceSource, ingressSource, endpointSliceSource:
+			sources = append(sources, source)
+		default:
+			return nil, fmt.Errorf("Invalid `%s`, `%s` is not one of `%s`, `%s` and `%s`",
+				SOURCES, source, serviceSource, ingressSource, endpointSliceSource)
 		}
 	}
 
@@ -59,6 +116,38 @@ func NewControllerOptionsFromEnv() (*ControllerOptions, error) {
 		KubeConfig:             config,
 		RedisDbUrl:             redisUrl,
 		ChangedDnsObjectsQueue: changedDnsObjectsUrl,
-		LockName:               ReadEnv(NODE_ID, "redns-lock"),
+		LockNamespace:          lockNamespace,
+		LockName:               lockName,
+		Workers:                workers,
+		ResyncInterval:         resyncInterval,
+		DriftMode:              driftMode,
+		MetricsAddress:         ReadEnv(METRICS_ADDRESS, ":8080"),
+		Sources:                sources,
 	}, nil
 }
+
+// parseElectionLock parse a lock in `[namespace/]name` format, default namespace is namespace of
+// the pod or `default` if we are not running in a cluster
+func parseElectionLock(value string) (string, string, error) {
+	namespace, name := "", value
+	if i := strings.IndexByte(value, '/'); i != -1 {
+		namespace, name = value[:i], value[i+1:]
+		if namespace == "" {
+			return "", "", fmt.Errorf("Invalid `%s`, namespace is empty", ELECTION_LOCK)
+		}
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("Invalid `%s`, it must be in `[namespace/]name` format", ELECTION_LOCK)
+	}
+
+	if namespace == "" {
+		content, err := ioutil.ReadFile(namespaceFile)
+		if err == nil {
+			namespace = strings.TrimSpace(string(content))
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	return namespace, name, nil
+}
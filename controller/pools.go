@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+)
+
+// poolSelector return the selector of the members of a DNSLoadBalancer, or nil if it has no selector
+func poolSelector(loadbalancer *rednsv1.DNSLoadBalancer) (labels.Selector, error) {
+	if loadbalancer.Spec.Selector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(loadbalancer.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid selector: %v", err)
+	}
+	return selector, nil
+}
+
+// isPoolMember return `true` if a DNSRecord is a member of a DNSLoadBalancer
+func isPoolMember(loadbalancer *rednsv1.DNSLoadBalancer, selector labels.Selector, record *rednsv1.DNSRecord) bool {
+	return record.DeletionTimestamp == nil &&
+		strings.EqualFold(record.Spec.Type, loadbalancer.Spec.Type) &&
+		selector.Matches(labels.Set(record.Labels))
+}
+
+// poolMembers return the members of the DNSLoadBalancer objects by their name, sorted by name. The
+// objects that their selector is invalid are returned by their objectRef.
+func (this *Controller) poolMembers(loadbalancers []*rednsv1.DNSLoadBalancer) (map[string][]*rednsv1.DNSRecord, map[string]error) {
+	members := make(map[string][]*rednsv1.DNSRecord)
+	invalid := make(map[string]error)
+	for _, loadbalancer := range loadbalancers {
+		selector, err := poolSelector(loadbalancer)
+		if err != nil {
+			log.Warningf("Ignoring members of DNSLoadBalancer %s: %v", loadbalancer.Name, err)
+			invalid[objectRef(dnsLoadBalancerKind, loadbalancer.Name)] = err
+			continue
+		}
+		if selector == nil {
+			continue
+		}
+
+		// orphans are not members until their domain is created, like they are not written to their key
+		var result []*rednsv1.DNSRecord
+		for _, obj := range this.recordInformer.GetStore().List() {
+			record := obj.(*rednsv1.DNSRecord)
+			if isPoolMember(loadbalancer, selector, record) && this.findZone(record.Spec.Domain) != "" {
+				result = append(result, record)
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+		members[loadbalancer.Name] = result
+	}
+	return members, invalid
+}
+
+// poolKeys return the REDIS keys of the DNSLoadBalancer objects that a DNSRecord is their member
+func (this *Controller) poolKeys(record *rednsv1.DNSRecord) []string {
+	var result []string
+	for _, obj := range this.loadbalancerInformer.GetStore().List() {
+		loadbalancer := obj.(*rednsv1.DNSLoadBalancer)
+		selector, err := poolSelector(loadbalancer)
+		if err != nil || selector == nil {
+			continue
+		}
+		// deleted records are still members, so they are removed from the pool
+		if strings.EqualFold(record.Spec.Type, loadbalancer.Spec.Type) && selector.Matches(labels.Set(record.Labels)) {
+			result = append(result, recordKey(loadbalancer.Spec.Domain, loadbalancer.Spec.Name))
+		}
+	}
+	return result
+}
+
+// memberStatuses return the state of the members of a DNSLoadBalancer in the REDIS
+func (this *syncResult) memberStatuses(loadbalancer *rednsv1.DNSLoadBalancer, members []*rednsv1.DNSRecord) []rednsv1.DNSLoadBalancerMember {
+	var result []rednsv1.DNSLoadBalancerMember
+	for _, member := range members {
+		status := rednsv1.DNSLoadBalancerMember{
+			Name:    member.Name,
+			Value:   member.Spec.Value,
+			Weight:  member.Spec.Weight,
+			Enabled: loadbalancer.Spec.Enabled && member.Spec.Enabled,
+		}
+		var address definitions.IDNSAddress
+		if this.record != nil {
+			address = this.record.FindAddress(loadbalancer.Spec.Type, member.Spec.Value)
+		}
+		status.Healthy = status.Enabled && address != nil && address.BaseAddress().Healthy
+		result = append(result, status)
+	}
+	return result
+}
+
+// poolHealth return the Healthy condition of a DNSLoadBalancer that has a selector, a pool is healthy
+// if it has a healthy member
+func poolHealth(loadbalancer *rednsv1.DNSLoadBalancer, members []rednsv1.DNSLoadBalancerMember) rednsv1.DNSCondition {
+	healthy := 0
+	for _, member := range members {
+		if member.Healthy {
+			healthy++
+		}
+	}
+
+	result := rednsv1.DNSCondition{Type: rednsv1.ConditionHealthy}
+	switch {
+	case !loadbalancer.Spec.Enabled:
+		result.Status, result.Reason = metav1.ConditionFalse, "Disabled"
+	case len(members) == 0:
+		result.Status, result.Reason = metav1.ConditionFalse, "NoMembers"
+	case healthy == 0:
+		result.Status, result.Reason = metav1.ConditionFalse, "NoHealthyMember"
+	default:
+		result.Status, result.Reason = metav1.ConditionTrue, "HealthyMembers"
+	}
+	if len(members) != 0 {
+		result.Message = fmt.Sprintf("%d of %d members are healthy", healthy, len(members))
+	}
+	return result
+}
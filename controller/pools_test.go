@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/client/clientset/versioned/fake"
+)
+
+func testPool() *rednsv1.DNSLoadBalancer {
+	return &rednsv1.DNSLoadBalancer{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: rednsv1.DNSLoadBalancerSpec{
+			Domain:   "example.com",
+			Name:     "web",
+			Type:     definitions.Kind_A,
+			Enabled:  true,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "web"}},
+		},
+	}
+}
+func testMember(name, domain, value string) *rednsv1.DNSRecord {
+	record := testRecord(name, definitions.Kind_A, value)
+	record.Labels = map[string]string{"pool": "web"}
+	record.Spec.Domain = domain
+	record.Spec.Name = name
+	return record
+}
+
+func TestPoolMembers(t *testing.T) {
+	controller, err := newController(fake.NewSimpleClientset(), newMemoryStore(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.domainInformer.GetIndexer().Add(testDomain("example", "example.com"))
+	aaaa := testMember("web-aaaa", "example.com", "2001:db8::1")
+	aaaa.Spec.Type = definitions.Kind_AAAA
+	deleted := testMember("web-deleted", "example.com", "192.0.2.3")
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	other := testRecord("other", definitions.Kind_A, "192.0.2.4")
+	for _, record := range []*rednsv1.DNSRecord{
+		testMember("web-2", "example.com", "192.0.2.2"),
+		testMember("web-1", "example.com", "192.0.2.1"),
+		testMember("web-orphan", "example.org", "192.0.2.5"),
+		aaaa, deleted, other,
+	} {
+		controller.recordInformer.GetIndexer().Add(record)
+	}
+
+	invalidPool := testPool()
+	invalidPool.Name = "invalid"
+	invalidPool.Spec.Selector = &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "pool", Operator: "Unknown"}},
+	}
+	members, invalid := controller.poolMembers([]*rednsv1.DNSLoadBalancer{testPool(), invalidPool})
+	if len(members["web"]) != 2 || members["web"][0].Name != "web-1" || members["web"][1].Name != "web-2" {
+		t.Errorf("Expected web-1 and web-2 as members, got %v", members["web"])
+	}
+	if _, ok := invalid[objectRef(dnsLoadBalancerKind, "invalid")]; !ok || len(invalid) != 1 {
+		t.Errorf("Expected the invalid selector to be reported, got %v", invalid)
+	}
+
+	// members of a domain that is created later join the pool
+	controller.domainInformer.GetIndexer().Add(testDomain("example-org", "example.org"))
+	members, _ = controller.poolMembers([]*rednsv1.DNSLoadBalancer{testPool()})
+	if len(members["web"]) != 3 {
+		t.Errorf("Expected the member of the new domain to join, got %v", members["web"])
+	}
+}
+
+func TestMemberStatuses(t *testing.T) {
+	record := &definitions.DNSRecord{}
+	record.AddAddress(definitions.Kind_A, "192.0.2.1", definitions.DNS_Address{Enabled: true, Healthy: true}, 0)
+	record.AddAddress(definitions.Kind_A, "192.0.2.2", definitions.DNS_Address{Enabled: true, Healthy: false}, 0)
+	disabled := testMember("web-3", "example.com", "192.0.2.3")
+	disabled.Spec.Enabled = false
+	members := []*rednsv1.DNSRecord{
+		testMember("web-1", "example.com", "192.0.2.1"),
+		testMember("web-2", "example.com", "192.0.2.2"),
+		disabled,
+		testMember("web-4", "example.com", "192.0.2.4"),
+	}
+	result := &syncResult{key: "web.example.com", record: record}
+
+	statuses := result.memberStatuses(testPool(), members)
+	expected := []bool{true, false, false, false}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d members, got %v", len(expected), statuses)
+	}
+	for i, healthy := range expected {
+		if statuses[i].Name != members[i].Name || statuses[i].Healthy != healthy {
+			t.Errorf("Expected %s to be healthy=%v, got %+v", members[i].Name, healthy, statuses[i])
+		}
+	}
+	if statuses[2].Enabled {
+		t.Error("Disabled member is enabled")
+	}
+
+	pool := testPool()
+	pool.Spec.Enabled = false
+	for _, status := range result.memberStatuses(pool, members) {
+		if status.Enabled || status.Healthy {
+			t.Errorf("Members of a disabled pool must be disabled, got %+v", status)
+		}
+	}
+}
+
+func TestPoolHealth(t *testing.T) {
+	healthy := rednsv1.DNSLoadBalancerMember{Name: "web-1", Enabled: true, Healthy: true}
+	unhealthy := rednsv1.DNSLoadBalancerMember{Name: "web-2", Enabled: true}
+	disabled := testPool()
+	disabled.Spec.Enabled = false
+
+	for _, test := range []struct {
+		loadbalancer *rednsv1.DNSLoadBalancer
+		members      []rednsv1.DNSLoadBalancerMember
+		expected     string
+		message      string
+	}{
+		{testPool(), []rednsv1.DNSLoadBalancerMember{healthy, unhealthy}, "True/HealthyMembers", "1 of 2 members are healthy"},
+		{testPool(), []rednsv1.DNSLoadBalancerMember{unhealthy}, "False/NoHealthyMember", "0 of 1 members are healthy"},
+		{testPool(), nil, "False/NoMembers", ""},
+		{disabled, []rednsv1.DNSLoadBalancerMember{healthy}, "False/Disabled", "1 of 1 members are healthy"},
+	} {
+		condition := poolHealth(test.loadbalancer, test.members)
+		if actual := conditionOf([]rednsv1.DNSCondition{condition}, rednsv1.ConditionHealthy); actual != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, actual)
+		}
+		if condition.Message != test.message {
+			t.Errorf("Expected message %q, got %q", test.message, condition.Message)
+		}
+	}
+}
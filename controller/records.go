@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/changequeue"
+)
+
+// errNoDomain is the error of the DNSRecord objects that there is no DNSDomain for their domain
+var errNoDomain = errors.New("There is no DNSDomain for the domain")
+
+// recordKey return the REDIS key that hold the addresses of a name in a domain
+func recordKey(domain, name string) string {
+	return definitions.GetRedisKey(strings.ToLower(domain), strings.ToLower(name))
+}
+
+// recordDomain return domain of the objects of a REDIS key
+func recordDomain(records []interface{}, loadbalancers []interface{}) string {
+	if len(records) != 0 {
+		return strings.ToLower(records[0].(*rednsv1.DNSRecord).Spec.Domain)
+	}
+	if len(loadbalancers) != 0 {
+		return strings.ToLower(loadbalancers[0].(*rednsv1.DNSLoadBalancer).Spec.Domain)
+	}
+	return ""
+}
+
+// splitOrphanRecords split the records to the records that there is a DNSDomain for their domain and
+// the records that there is not(orphans), orphans are not written to the REDIS until their domain is
+// created
+func (this *Controller) splitOrphanRecords(records []*rednsv1.DNSRecord) ([]*rednsv1.DNSRecord, []*rednsv1.DNSRecord) {
+	var result, orphans []*rednsv1.DNSRecord
+	for _, record := range records {
+		if this.findZone(record.Spec.Domain) == "" {
+			orphans = append(orphans, record)
+		} else {
+			result = append(result, record)
+		}
+	}
+	return result, orphans
+}
+
+// syncRecord write the addresses of all of the DNSRecord, DNSLoadBalancer and source objects that
+// share a REDIS key to it, and remove the key if there is no such object
+func (this *Controller) syncRecord(key string) error {
+	records, err := this.recordInformer.GetIndexer().ByIndex(redisKeyIndex, key)
+	if err != nil {
+		return err
+	}
+	loadbalancers, err := this.loadbalancerInformer.GetIndexer().ByIndex(redisKeyIndex, key)
+	if err != nil {
+		return err
+	}
+	sources, err := this.sourceAddresses(key)
+	if err != nil {
+		return err
+	}
+	// the key is marked before it is written, so it can be found if its sources are deleted later
+	if len(sources) != 0 {
+		err = this.redis.SetSourceKey(key, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	var liveRecords, deletedRecords []*rednsv1.DNSRecord
+	for _, obj := range records {
+		record := obj.(*rednsv1.DNSRecord)
+		if record.DeletionTimestamp != nil {
+			deletedRecords = append(deletedRecords, record)
+			continue
+		}
+		if !hasFinalizer(&record.ObjectMeta) {
+			record, err = this.addRecordFinalizer(record)
+			if err != nil {
+				return err
+			}
+		}
+		liveRecords = append(liveRecords, record)
+	}
+	liveRecords, orphanRecords := this.splitOrphanRecords(liveRecords)
+	var liveLoadBalancers, deletedLoadBalancers []*rednsv1.DNSLoadBalancer
+	for _, obj := range loadbalancers {
+		loadbalancer := obj.(*rednsv1.DNSLoadBalancer)
+		if loadbalancer.DeletionTimestamp != nil {
+			deletedLoadBalancers = append(deletedLoadBalancers, loadbalancer)
+			continue
+		}
+		if !hasFinalizer(&loadbalancer.ObjectMeta) {
+			loadbalancer, err = this.addLoadBalancerFinalizer(loadbalancer)
+			if err != nil {
+				return err
+			}
+		}
+		liveLoadBalancers = append(liveLoadBalancers, loadbalancer)
+	}
+
+	// orphans alone don't own the key, so its current value(that may be written by the CLI) is kept
+	if len(orphanRecords) != 0 && len(liveRecords) == 0 && len(deletedRecords) == 0 &&
+		len(loadbalancers) == 0 && len(sources) == 0 {
+		return this.syncOrphanRecords(key, orphanRecords)
+	}
+
+	members, invalidPools := this.poolMembers(liveLoadBalancers)
+	result := &syncResult{key: key, conflicts: findConflicts(liveRecords, liveLoadBalancers, sources)}
+	applied := appliedVersion(liveRecords, liveLoadBalancers)
+	// keys that only have sources keep their version in the REDIS
+	sourceOnly := len(liveRecords) == 0 && len(liveLoadBalancers) == 0 && len(sources) != 0
+	if sourceOnly {
+		applied = this.redis.GetAppliedVersion(key)
+	}
+	changed, err := this.redis.UpdateRecord(key, func(current *definitions.DNSRecord) *definitions.DNSRecord {
+		result.record, result.invalid = buildRecord(current, liveRecords, liveLoadBalancers, members, sources)
+		// in report-only mode a value that is changed outside of the controller is only replaced when
+		// the objects change
+		if this.driftMode == driftModeReport && applied != "" &&
+			recordVersion(result.record) == applied && recordVersion(current) != applied {
+			result.record, result.drifted = current, true
+		}
+		return result.record
+	})
+	if result.invalid == nil {
+		result.invalid = make(map[string]error)
+	}
+	for ref, err := range invalidPools {
+		result.invalid[ref] = err
+	}
+	for _, record := range orphanRecords {
+		result.invalid[objectRef(dnsRecordKind, record.Name)] = errNoDomain
+	}
+	// status of the orphans is updated too, so they are marked
+	this.reportOrphanRecords(orphanRecords)
+	if err != nil {
+		result.err = err
+		if statusErr := this.updateStatuses(result, append(liveRecords, orphanRecords...), liveLoadBalancers, members); statusErr != nil {
+			log.Warningf("Error in updating status of the objects of %s: %v", key, statusErr)
+		}
+		return err
+	}
+	this.evictHealthResults(key, result.record)
+	if !result.drifted {
+		err = this.setAppliedVersion(liveRecords, liveLoadBalancers, recordVersion(result.record))
+		if err == nil && sourceOnly {
+			err = this.redis.SetAppliedVersion(key, recordVersion(result.record))
+		} else if err == nil && len(this.sourceInformers) != 0 {
+			err = this.redis.SetAppliedVersion(key, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = this.updateStatuses(result, append(liveRecords, orphanRecords...), liveLoadBalancers, members)
+	if err != nil {
+		return err
+	}
+	this.reportInvalidSources(result, sources)
+	if len(sources) == 0 && len(this.sourceInformers) != 0 {
+		err = this.redis.SetSourceKey(key, false)
+		if err != nil {
+			return err
+		}
+	}
+	if changed {
+		log.Infof("Updated %s from %d records, %d load balancers and %d source addresses",
+			key, len(liveRecords), len(liveLoadBalancers), len(sources))
+		event := changequeue.Event{Key: key, Operation: changequeue.Operation_Delete}
+		if result.record != nil {
+			event.Operation = changequeue.Operation_Set
+			event.Version = recordVersion(result.record)
+		}
+		event.Domain = recordDomain(records, loadbalancers)
+		if event.Domain == "" && len(sources) != 0 {
+			event.Domain = sources[0].Zone
+		}
+		this.publishChange(event)
+	}
+
+	// now that their addresses are removed, deleted objects can go
+	for _, record := range deletedRecords {
+		err = this.removeRecordFinalizer(record)
+		if err != nil {
+			return err
+		}
+	}
+	for _, loadbalancer := range deletedLoadBalancers {
+		err = this.removeLoadBalancerFinalizer(loadbalancer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncOrphanRecords mark the DNSRecord objects of a key that all of them are orphans, without writing
+// the key
+func (this *Controller) syncOrphanRecords(key string, records []*rednsv1.DNSRecord) error {
+	result := &syncResult{key: key, invalid: make(map[string]error)}
+	for _, record := range records {
+		result.invalid[objectRef(dnsRecordKind, record.Name)] = errNoDomain
+	}
+	this.reportOrphanRecords(records)
+	return this.updateStatuses(result, records, nil, nil)
+}
+
+// keepHealth set health of an address that has a health check to its health in `current`, since it
+// is updated by the servers
+func keepHealth(current *definitions.DNSRecord, kind, value string, base *definitions.DNS_Address) {
+	if base.HealthCheck != nil {
+		if address := current.FindAddress(kind, value); address != nil {
+			base.Healthy = address.BaseAddress().Healthy
+			base.HealthChanged = address.BaseAddress().HealthChanged
+		}
+	}
+}
+
+// buildRecord aggregate the objects that share a REDIS key into the record that should be stored in
+// it, it returns nil if there is no address. `current` is the record that currently stored in the key,
+// health of its addresses that have a health check is kept, since it is updated by the servers.
+// `members` is the members of the load balancers by their name.
+// Objects that their address is invalid are ignored and their error is returned by their objectRef.
+func buildRecord(current *definitions.DNSRecord, records []*rednsv1.DNSRecord, loadbalancers []*rednsv1.DNSLoadBalancer, members map[string][]*rednsv1.DNSRecord, sources []sourceAddress) (*definitions.DNSRecord, map[string]error) {
+	// sort the objects so the result does not depend on the order of the cache
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	sort.Slice(loadbalancers, func(i, j int) bool { return loadbalancers[i].Name < loadbalancers[j].Name })
+
+	result := &definitions.DNSRecord{}
+	invalid := make(map[string]error)
+	count := 0
+	for _, record := range records {
+		spec := &record.Spec
+		result.Domain = strings.ToLower(spec.Domain)
+		base := definitions.DNS_Address{
+			TTL:         uint32(spec.TTL),
+			Enabled:     spec.Enabled,
+			Healthy:     true,
+			Weight:      spec.Weight,
+			HealthCheck: spec.HealthCheck.ToHealthCheck(),
+		}
+		keepHealth(current, spec.Type, spec.Value, &base)
+		var priority uint16
+		if spec.Priority != nil {
+			priority = *spec.Priority
+		}
+
+		err := result.AddAddress(spec.Type, spec.Value, base, priority)
+		if err != nil {
+			log.Warningf("Ignoring DNSRecord %s: %v", record.Name, err)
+			invalid[objectRef(dnsRecordKind, record.Name)] = err
+			continue
+		}
+		count++
+	}
+
+	// a load balancer is a pool of its value and the addresses of its members, that is served by
+	// its strategy
+	for _, loadbalancer := range loadbalancers {
+		spec := &loadbalancer.Spec
+		ref := objectRef(dnsLoadBalancerKind, loadbalancer.Name)
+		result.Domain = strings.ToLower(spec.Domain)
+		if spec.Value == "" && spec.Selector == nil {
+			invalid[ref] = errors.New("DNSLoadBalancer must have a value or a selector")
+			continue
+		}
+
+		healthCheck := spec.HealthCheck.ToHealthCheck()
+		added := 0
+		if spec.Value != "" {
+			base := definitions.DNS_Address{TTL: uint32(spec.TTL), Enabled: spec.Enabled, Healthy: true, Weight: 1, HealthCheck: healthCheck}
+			keepHealth(current, spec.Type, spec.Value, &base)
+			err := result.AddAddress(spec.Type, spec.Value, base, 0)
+			if err != nil {
+				log.Warningf("Ignoring DNSLoadBalancer %s: %v", loadbalancer.Name, err)
+				invalid[ref] = err
+				continue
+			}
+			added++
+		}
+		for _, member := range members[loadbalancer.Name] {
+			memberSpec := &member.Spec
+			base := definitions.DNS_Address{
+				TTL:         uint32(memberSpec.TTL),
+				Enabled:     spec.Enabled && memberSpec.Enabled,
+				Healthy:     true,
+				Weight:      memberSpec.Weight,
+				HealthCheck: memberSpec.HealthCheck.ToHealthCheck(),
+			}
+			if base.TTL == 0 {
+				base.TTL = uint32(spec.TTL)
+			}
+			if base.HealthCheck == nil && healthCheck != nil {
+				base.HealthCheck = healthCheck.DeepCopy()
+			}
+			keepHealth(current, spec.Type, memberSpec.Value, &base)
+			var priority uint16
+			if memberSpec.Priority != nil {
+				priority = *memberSpec.Priority
+			}
+
+			err := result.AddAddress(spec.Type, memberSpec.Value, base, priority)
+			if err != nil {
+				log.Warningf("Ignoring member %s of DNSLoadBalancer %s: %v", member.Name, loadbalancer.Name, err)
+				continue
+			}
+			added++
+		}
+		if added == 0 {
+			continue
+		}
+
+		// SRV pools are balanced by the priority and weight of their addresses
+		if definitions.SupportsStrategy(spec.Type) {
+			strategy := spec.Strategy
+			if strategy == "" {
+				strategy = definitions.Strategy_Weighted
+			}
+			result.SetStrategy(spec.Type, strategy, spec.TopN)
+		} else if spec.Strategy != "" {
+			invalid[ref] = result.SetStrategy(spec.Type, spec.Strategy, spec.TopN)
+		}
+		count++
+	}
+
+	for _, source := range sources {
+		if source.Zone == "" {
+			invalid[source.Ref] = errors.New("There is no DNSDomain for the name")
+			continue
+		}
+		if result.Domain == "" {
+			result.Domain = source.Zone
+		}
+		base := definitions.DNS_Address{TTL: source.TTL, Enabled: true, Healthy: source.Healthy, Weight: 1}
+		err := result.AddAddress(source.Kind, source.Value, base, 0)
+		if err != nil {
+			log.Warningf("Ignoring address %s of %s: %v", source.Value, source.Ref, err)
+			invalid[source.Ref] = err
+			continue
+		}
+		count++
+	}
+
+	if count == 0 {
+		return nil, invalid
+	}
+	return result, invalid
+}
+
+func (this *Controller) addRecordFinalizer(record *rednsv1.DNSRecord) (*rednsv1.DNSRecord, error) {
+	record = record.DeepCopy()
+	record.Finalizers = append(record.Finalizers, finalizerName)
+	return this.rednsClient.DevopsV1().DNSRecords().Update(context.TODO(), record, metav1.UpdateOptions{})
+}
+func (this *Controller) removeRecordFinalizer(record *rednsv1.DNSRecord) error {
+	if !hasFinalizer(&record.ObjectMeta) {
+		return nil
+	}
+	record = record.DeepCopy()
+	record.Finalizers = removeFinalizer(record.Finalizers)
+	_, err := this.rednsClient.DevopsV1().DNSRecords().Update(context.TODO(), record, metav1.UpdateOptions{})
+	return err
+}
+func (this *Controller) addLoadBalancerFinalizer(loadbalancer *rednsv1.DNSLoadBalancer) (*rednsv1.DNSLoadBalancer, error) {
+	loadbalancer = loadbalancer.DeepCopy()
+	loadbalancer.Finalizers = append(loadbalancer.Finalizers, finalizerName)
+	return this.rednsClient.DevopsV1().DNSLoadBalancers().Update(context.TODO(), loadbalancer, metav1.UpdateOptions{})
+}
+func (this *Controller) removeLoadBalancerFinalizer(loadbalancer *rednsv1.DNSLoadBalancer) error {
+	if !hasFinalizer(&loadbalancer.ObjectMeta) {
+		return nil
+	}
+	loadbalancer = loadbalancer.DeepCopy()
+	loadbalancer.Finalizers = removeFinalizer(loadbalancer.Finalizers)
+	_, err := this.rednsClient.DevopsV1().DNSLoadBalancers().Update(context.TODO(), loadbalancer, metav1.UpdateOptions{})
+	return err
+}
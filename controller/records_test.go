@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+	"github.com/devops-simba/redns/definitions/client/clientset/versioned/fake"
+)
+
+func TestBuildRecordAggregation(t *testing.T) {
+	records := []*rednsv1.DNSRecord{
+		testRecord("b", definitions.Kind_A, "192.0.2.2"),
+		testRecord("a", definitions.Kind_A, "192.0.2.1"),
+		testRecord("c", definitions.Kind_SRV, "sip.example.com:5060"),
+		testRecord("d", definitions.Kind_A, "invalid"),
+	}
+	loadbalancers := []*rednsv1.DNSLoadBalancer{{
+		ObjectMeta: metav1.ObjectMeta{Name: "lb"},
+		Spec: rednsv1.DNSLoadBalancerSpec{
+			Domain: "example.com", Name: "www", Type: definitions.Kind_AAAA, Value: "2001:db8::1", Enabled: true,
+		},
+	}}
+
+	result, invalid := buildRecord(nil, records, loadbalancers, nil, nil)
+	if result == nil {
+		t.Fatal("Expected a record")
+	}
+	if len(result.ARecords.Addresses) != 2 || result.ARecords.Addresses[0].IP != "192.0.2.1" ||
+		result.ARecords.Addresses[1].IP != "192.0.2.2" {
+		t.Errorf("A addresses are not aggregated in the order of the names: %+v", result.ARecords.Addresses)
+	}
+	if len(result.AAAARecords.Addresses) != 1 || result.AAAARecords.Addresses[0].IP != "2001:db8::1" {
+		t.Errorf("Address of the load balancer is missing: %+v", result.AAAARecords.Addresses)
+	}
+	if len(result.SRVRecords) != 1 || result.SRVRecords[0].Port != 5060 {
+		t.Errorf("SRV address is missing: %+v", result.SRVRecords)
+	}
+	if _, ok := invalid[objectRef(dnsRecordKind, "d")]; !ok || len(invalid) != 1 {
+		t.Errorf("Expected only the invalid address of d, got %v", invalid)
+	}
+
+	if result, _ := buildRecord(nil, nil, nil, nil, nil); result != nil {
+		t.Errorf("Expected no record without objects, got %+v", result)
+	}
+}
+
+func TestBuildRecordKeepHealth(t *testing.T) {
+	current := &definitions.DNSRecord{}
+	current.AddAddress(definitions.Kind_A, "192.0.2.1", definitions.DNS_Address{Healthy: false}, 0)
+	current.AddAddress(definitions.Kind_A, "192.0.2.2", definitions.DNS_Address{Healthy: false}, 0)
+	records := []*rednsv1.DNSRecord{
+		withHealthCheck(testRecord("a", definitions.Kind_A, "192.0.2.1")),
+		testRecord("b", definitions.Kind_A, "192.0.2.2"),
+		withHealthCheck(testRecord("c", definitions.Kind_A, "192.0.2.3")),
+	}
+
+	result, _ := buildRecord(current, records, nil, nil, nil)
+	healthy := map[string]bool{}
+	for _, address := range result.ARecords.Addresses {
+		healthy[address.IP] = address.Healthy
+	}
+	if healthy["192.0.2.1"] {
+		t.Error("Health of an address with a health check is not kept")
+	}
+	if !healthy["192.0.2.2"] {
+		t.Error("Address without a health check must be healthy")
+	}
+	if !healthy["192.0.2.3"] {
+		t.Error("New address must start healthy")
+	}
+}
+
+func TestSyncRecordFinalizers(t *testing.T) {
+	domain := testDomain("example", "example.com")
+	store := newMemoryStore()
+	client := fake.NewSimpleClientset(domain,
+		testRecord("a", definitions.Kind_A, "192.0.2.1"), testRecord("b", definitions.Kind_A, "192.0.2.2"))
+	controller, err := newController(client, store, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.domainInformer.GetIndexer().Add(domain)
+	// the informers are not running, so the cache is updated from the client before every sync
+	sync := func() {
+		for _, name := range []string{"a", "b"} {
+			record, err := client.DevopsV1().DNSRecords().Get(context.TODO(), name, metav1.GetOptions{})
+			if err == nil {
+				controller.recordInformer.GetIndexer().Update(record)
+			}
+		}
+		if err := controller.syncRecord("www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sync()
+	record, _ := store.GetRecord("www.example.com")
+	if record == nil || len(record.ARecords.Addresses) != 2 {
+		t.Fatalf("Expected both addresses in the key, got %+v", record)
+	}
+	if !hasFinalizer(&getRecord(client, "a").ObjectMeta) || !hasFinalizer(&getRecord(client, "b").ObjectMeta) {
+		t.Fatal("Finalizer is not added to the records")
+	}
+
+	// the fake client does not handle finalizers, so deletion is marked like the API server does
+	for i, name := range []string{"a", "b"} {
+		object := getRecord(client, name)
+		now := metav1.Now()
+		object.DeletionTimestamp = &now
+		_, err = client.DevopsV1().DNSRecords().Update(context.TODO(), object, metav1.UpdateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sync()
+
+		record, _ := store.GetRecord("www.example.com")
+		count := 0
+		if record != nil {
+			count = len(record.ARecords.Addresses)
+		}
+		if count != 1-i {
+			t.Errorf("Expected %d addresses after deletion of %s, got %d", 1-i, name, count)
+		}
+		if hasFinalizer(&getRecord(client, name).ObjectMeta) {
+			t.Errorf("Finalizer of %s is not removed", name)
+		}
+	}
+	if record, _ := store.GetRecord("www.example.com"); record != nil {
+		t.Errorf("Key is not removed with its last record: %+v", record)
+	}
+}
+
+func TestSplitOrphanRecords(t *testing.T) {
+	controller, err := newController(fake.NewSimpleClientset(), newMemoryStore(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.domainInformer.GetIndexer().Add(testDomain("example", "example.com"))
+
+	sub := testRecord("sub", definitions.Kind_A, "192.0.2.2")
+	sub.Spec.Domain = "Sub.Example.com"
+	orphan := testRecord("orphan", definitions.Kind_A, "192.0.2.3")
+	orphan.Spec.Domain = "example.org"
+	records, orphans := controller.splitOrphanRecords([]*rednsv1.DNSRecord{
+		testRecord("a", definitions.Kind_A, "192.0.2.1"), sub, orphan,
+	})
+	if len(records) != 2 || records[0].Name != "a" || records[1].Name != "sub" {
+		t.Errorf("Records of the domain and its subdomains must not be orphans: %v", records)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "orphan" {
+		t.Errorf("Expected orphan to be the only orphan: %v", orphans)
+	}
+}
+
+func TestOrphanRecords(t *testing.T) {
+	store := newMemoryStore()
+	// a value that is written by the CLI
+	cli := &definitions.DNSRecord{}
+	cli.AddAddress(definitions.Kind_A, "198.51.100.1", definitions.DNS_Address{Enabled: true, Healthy: true}, 0)
+	store.SetRecord("www.example.com", cli)
+	_, client := startTestController(t, store)
+	createRecord(t, client, testRecord("a", definitions.Kind_A, "192.0.2.1"))
+
+	waitUntil(t, "the orphan status", func() bool {
+		conditions := getRecord(client, "a").Status.Conditions
+		return conditionOf(conditions, rednsv1.ConditionSynced) == "False/NoDomain" &&
+			conditionOf(conditions, rednsv1.ConditionDomainFound) == "False/NoDomain"
+	})
+	record, _ := store.GetRecord("www.example.com")
+	if record == nil || len(record.ARecords.Addresses) != 1 || record.ARecords.Addresses[0].IP != "198.51.100.1" {
+		t.Fatalf("Orphan changed the value of its key: %+v", record)
+	}
+
+	createDomain(t, client, testDomain("example", "example.com"))
+	waitUntil(t, "the record", func() bool {
+		conditions := getRecord(client, "a").Status.Conditions
+		record, _ := store.GetRecord("www.example.com")
+		return record != nil && len(record.ARecords.Addresses) == 1 && record.ARecords.Addresses[0].IP == "192.0.2.1" &&
+			conditionOf(conditions, rednsv1.ConditionSynced) == "True/Synced" &&
+			conditionOf(conditions, rednsv1.ConditionDomainFound) == "True/DomainFound"
+	})
+}
+
+func TestProcessNextItemGiveUp(t *testing.T) {
+	domain := testDomain("example", "example.com")
+	record := testRecord("a", definitions.Kind_A, "192.0.2.1")
+	record.Finalizers = []string{finalizerName}
+	store := newMemoryStore()
+	store.err = errStoreFailed
+	controller, err := newController(fake.NewSimpleClientset(domain, record), store, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.domainInformer.GetIndexer().Add(domain)
+	controller.recordInformer.GetIndexer().Add(record)
+
+	// retries are queued without a delay
+	queue := workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(0, 0))
+	defer queue.ShutDown()
+	item := syncKey{Kind: recordSyncKind, Name: "www.example.com"}
+	queue.Add(item)
+	for i := 1; i <= maxRetries; i++ {
+		controller.processNextItem(queue)
+		if queue.Len() != 1 || queue.NumRequeues(item) != i {
+			t.Fatalf("Expected retry %d to be queued, queue has %d items and %d requeues",
+				i, queue.Len(), queue.NumRequeues(item))
+		}
+	}
+	controller.processNextItem(queue)
+	if queue.Len() != 0 || queue.NumRequeues(item) != 0 {
+		t.Fatalf("Expected to give up after %d retries, queue has %d items and %d requeues",
+			maxRetries, queue.Len(), queue.NumRequeues(item))
+	}
+
+	status := getRecord(controller.rednsClient.(*fake.Clientset), "a").Status
+	if conditionOf(status.Conditions, rednsv1.ConditionSynced) != "False/RedisError" {
+		t.Errorf("Expected the error in the status, got %v", status.Conditions)
+	}
+}
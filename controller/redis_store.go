@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/golang/glog"
+	"github.com/hoisie/redis"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// Store is the database that the controller write the REDNS objects to it, in the format that
+// servers read them
+type Store interface {
+	// GetRecord read record of a key, it returns nil if the key does not exist
+	GetRecord(key string) (*definitions.DNSRecord, error)
+	// UpdateRecord lock a key and replace its record with the result of `update`, a nil result remove
+	// the key. It returns `false` if the record did not change.
+	UpdateRecord(key string, update func(current *definitions.DNSRecord) *definitions.DNSRecord) (bool, error)
+	// SetZone add a zone and write its settings, it returns `false` if they did not change
+	SetZone(zone string, info *definitions.ZoneInfo) (bool, error)
+	// RemoveZone remove a zone and its settings, it returns `false` if the zone did not exist
+	RemoveZone(zone string) (bool, error)
+	// SetSourceKey add a key to the keys that have an address from a source, or remove it
+	SetSourceKey(key string, hasSource bool) error
+	// GetSourceKeys return the keys that have an address from a source
+	GetSourceKeys() ([]string, error)
+	// SetAppliedVersion write the version of the record that is written for a key that only has
+	// sources, an empty version remove it
+	SetAppliedVersion(key, version string) error
+	// GetAppliedVersion return the version that is written by `SetAppliedVersion`, or an empty string
+	GetAppliedVersion(key string) string
+	// SubscribeHealthEvents send the health events that servers publish to `messages`, it returns on
+	// the first error
+	SubscribeHealthEvents(messages chan<- redis.Message) error
+}
+
+// RedisStore read and write the REDNS objects in the REDIS, in the format that servers read them
+type RedisStore struct {
+	redis.Client
+}
+
+func NewRedisStore(url *RedisUrl) *RedisStore {
+	return &RedisStore{Client: *url.CreateClient()}
+}
+
+// GetRecord read record of a key, it returns nil if the key does not exist
+func (this *RedisStore) GetRecord(key string) (*definitions.DNSRecord, error) {
+	values, err := this.Mget(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || values[0] == nil {
+		return nil, nil
+	}
+
+	record := &definitions.DNSRecord{}
+	err = json.Unmarshal(values[0], record)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid record in %s: %v", key, err)
+	}
+	return record, nil
+}
+
+// UpdateRecord lock a key and replace its record with the result of `update`, a nil result remove
+// the key. The lock is the same lock that servers and the CLI use to update the records. It returns
+// `false` if the record did not change.
+func (this *RedisStore) UpdateRecord(key string, update func(current *definitions.DNSRecord) *definitions.DNSRecord) (bool, error) {
+	lock, err := definitions.LockKey(this, key, definitions.LockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err := lock.Unlock()
+		if err != nil {
+			log.Errorf("Error in releasing lock of %s: %v", key, err)
+		}
+	}()
+
+	current, err := this.GetRecord(key)
+	if err != nil {
+		// an invalid record is replaced
+		log.Warningf("%v", err)
+	}
+
+	record := update(current)
+	if record == nil {
+		if current == nil {
+			return false, nil
+		}
+		_, err = this.Del(key)
+		if err != nil {
+			return false, err
+		}
+		return true, definitions.RemoveRecordKey(this, key)
+	}
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	if current != nil {
+		currentContent, err := json.Marshal(current)
+		if err == nil && bytes.Equal(content, currentContent) {
+			// keys that are written by the older versions are indexed and marked when they are synced
+			return false, definitions.AddRecordKey(this, key)
+		}
+	}
+	err = this.Set(key, content)
+	if err != nil {
+		return false, err
+	}
+	return true, definitions.AddRecordKey(this, key)
+}
+
+// SetZone add a zone to the zones of the servers and write its settings, it returns `false` if the
+// zone and its settings did not change
+func (this *RedisStore) SetZone(zone string, info *definitions.ZoneInfo) (bool, error) {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return false, err
+	}
+	key := definitions.GetZoneInfoKey(zone)
+	current, err := this.Get(key)
+	changed := err != nil || !bytes.Equal(current, content)
+	if changed {
+		err = this.Set(key, content)
+		if err != nil {
+			return false, err
+		}
+	}
+	added, err := this.Sadd(definitions.ZonesKey, []byte(zone))
+	return changed || added, err
+}
+
+// RemoveZone remove a zone from the zones of the servers and remove its settings, it returns `false`
+// if the zone did not exist
+func (this *RedisStore) RemoveZone(zone string) (bool, error) {
+	removed, err := this.Srem(definitions.ZonesKey, []byte(zone))
+	if err != nil {
+		return false, err
+	}
+	deleted, err := this.Del(definitions.GetZoneInfoKey(zone))
+	return removed || deleted, err
+}
+
+// SetSourceKey add a key to the keys that have an address from a source, or remove it
+func (this *RedisStore) SetSourceKey(key string, hasSource bool) error {
+	var err error
+	if hasSource {
+		_, err = this.Sadd(sourceKeysKey, []byte(key))
+	} else {
+		_, err = this.Srem(sourceKeysKey, []byte(key))
+	}
+	return err
+}
+
+// SetAppliedVersion write the version of the record that is written for a key that only has sources,
+// an empty version remove it
+func (this *RedisStore) SetAppliedVersion(key, version string) error {
+	var err error
+	if version == "" {
+		_, err = this.Hdel(appliedVersionsKey, key)
+	} else {
+		_, err = this.Hset(appliedVersionsKey, key, []byte(version))
+	}
+	return err
+}
+
+// GetAppliedVersion return the version of the record that is written for a key that only has sources,
+// it returns an empty string if there is no version
+func (this *RedisStore) GetAppliedVersion(key string) string {
+	version, err := this.Hget(appliedVersionsKey, key)
+	if err != nil {
+		return ""
+	}
+	return string(version)
+}
+
+// GetSourceKeys return the keys that have an address from a source
+func (this *RedisStore) GetSourceKeys() ([]string, error) {
+	members, err := this.Smembers(sourceKeysKey)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(members))
+	for _, member := range members {
+		result = append(result, string(member))
+	}
+	return result, nil
+}
+
+// SubscribeHealthEvents send the health events that servers publish to `messages`, it returns on the
+// first error
+func (this *RedisStore) SubscribeHealthEvents(messages chan<- redis.Message) error {
+	subscribe := make(chan string, 1)
+	subscribe <- definitions.HealthEventsChannel
+	return this.Subscribe(subscribe, nil, nil, nil, messages)
+}
@@ -66,7 +66,7 @@ func ParseRedisUrl(value string, defaultQueueName string) (*RedisUrl, error) {
 	if len(queueNames) > 1 {
 		return nil, errors.New("Multiple queue names is not supported")
 	} else if (!ok || len(queueNames) == 0) && len(defaultQueueName) != 0 {
-		options["queue"] = defaultQueueName
+		options.Set("queue", defaultQueueName)
 	}
 
 	return &RedisUrl{
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+const (
+	serviceSource = "service"
+	ingressSource = "ingress"
+	// endpointSliceSource publish the pods of the headless services
+	endpointSliceSource = "endpointslice"
+
+	// hostnameAnnotation is a comma separated list of the names that addresses of a source are
+	// published under them
+	hostnameAnnotation = "devops.snapp.ir/hostname"
+	// ttlAnnotation is TTL of the addresses of a source in seconds
+	ttlAnnotation = "devops.snapp.ir/ttl"
+	// defaultSourceTTL is TTL of the addresses of the sources that have no TTL annotation
+	defaultSourceTTL = 300
+
+	serviceKind = "Service"
+	ingressKind = "Ingress"
+
+	// sourceKeysKey is a REDIS set of the keys that have an address from a source, so names of the
+	// sources that are deleted while we are not the leader can be found and removed
+	sourceKeysKey = "redns-controller:source-keys"
+	// appliedVersionsKey is a REDIS hash of the versions of the records that are written for the keys
+	// that only have sources, since there is no object to hold the version
+	appliedVersionsKey = "redns-controller:applied-versions"
+
+	sourcesSyncKind = "sources"
+)
+
+// sourceAddress is an address of a name that is published from a kubernetes object(a source),
+// instead of a REDNS object
+type sourceAddress struct {
+	// Ref is objectRef of the source
+	Ref    string
+	Object runtime.Object
+	// Zone is the zone of the name, it is empty if there is no DNSDomain for the name
+	Zone  string
+	Kind  string
+	Value string
+	TTL   uint32
+	// Healthy is `false` if the address is published, but it should not be served
+	Healthy bool
+}
+
+// watchSources create the informers of the sources, `sources` is the list of the enabled kinds
+func (this *Controller) watchSources(kubeClient kubernetes.Interface, sources []string) error {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	this.sources = make(map[string]bool)
+	for _, source := range sources {
+		switch source {
+		case serviceSource, ingressSource, endpointSliceSource:
+			this.sources[source] = true
+		default:
+			return fmt.Errorf("Invalid source `%s`", source)
+		}
+	}
+
+	this.kubeInformerFactory = kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+	var informers []cache.SharedIndexInformer
+	// headless services are read from the services
+	if this.sources[serviceSource] || this.sources[endpointSliceSource] {
+		this.serviceInformer = this.kubeInformerFactory.Core().V1().Services().Informer()
+		informers = append(informers, this.serviceInformer)
+	}
+	if this.sources[ingressSource] {
+		informers = append(informers, this.kubeInformerFactory.Networking().V1beta1().Ingresses().Informer())
+	}
+	if this.sources[endpointSliceSource] {
+		this.endpointSliceInformer = this.kubeInformerFactory.Discovery().V1beta1().EndpointSlices().Informer()
+		err := this.endpointSliceInformer.AddIndexers(cache.Indexers{serviceIndex: serviceIndexFunc})
+		if err != nil {
+			return err
+		}
+		informers = append(informers, this.endpointSliceInformer)
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    this.enqueue,
+		UpdateFunc: this.enqueueUpdate,
+		DeleteFunc: this.enqueue,
+	}
+	for _, informer := range informers {
+		err := informer.AddIndexers(cache.Indexers{redisKeyIndex: redisKeyIndexFunc})
+		if err != nil {
+			return err
+		}
+		informer.AddEventHandler(handler)
+	}
+	this.sourceInformers = informers
+	return nil
+}
+
+// sourceHostnames return the names that a source is published under them
+func sourceHostnames(obj *metav1.ObjectMeta) []string {
+	var result []string
+	for _, hostname := range strings.Split(obj.Annotations[hostnameAnnotation], ",") {
+		hostname = normalizeZone(strings.TrimSpace(hostname))
+		if hostname != "" {
+			result = append(result, hostname)
+		}
+	}
+	return result
+}
+
+// sourceKeys return the REDIS keys that hold the addresses of a source
+func sourceKeys(obj *metav1.ObjectMeta) []string {
+	var result []string
+	for _, hostname := range sourceHostnames(obj) {
+		result = append(result, definitions.NameToRedisKey(hostname))
+	}
+	return result
+}
+func sourceTTL(obj *metav1.ObjectMeta) uint32 {
+	value, ok := obj.Annotations[ttlAnnotation]
+	if !ok {
+		return defaultSourceTTL
+	}
+	ttl, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		log.Warningf("Ignoring invalid %s annotation of %s/%s: %v", ttlAnnotation, obj.Namespace, obj.Name, err)
+		return defaultSourceTTL
+	}
+	return uint32(ttl)
+}
+
+// addressKind return kind of the record of an address, IPs are A or AAAA and names are CNAME
+func addressKind(value string) string {
+	ip := net.ParseIP(value)
+	switch {
+	case ip == nil:
+		return definitions.Kind_CNAME
+	case ip.To4() != nil:
+		return definitions.Kind_A
+	default:
+		return definitions.Kind_AAAA
+	}
+}
+
+// sourceValues return the addresses of a source, LoadBalancer services are published by their
+// ingress points and other services by their external IPs
+func sourceValues(obj interface{}) []string {
+	var result []string
+	switch obj := obj.(type) {
+	case *corev1.Service:
+		if obj.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			for _, ingress := range obj.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					result = append(result, ingress.IP)
+				} else if ingress.Hostname != "" {
+					result = append(result, ingress.Hostname)
+				}
+			}
+		}
+		result = append(result, obj.Spec.ExternalIPs...)
+	case *networkingv1beta1.Ingress:
+		for _, ingress := range obj.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				result = append(result, ingress.IP)
+			} else if ingress.Hostname != "" {
+				result = append(result, ingress.Hostname)
+			}
+		}
+	}
+	return result
+}
+
+// sourceAddresses return the addresses of the sources that are published under a REDIS key
+func (this *Controller) sourceAddresses(key string) ([]sourceAddress, error) {
+	var result []sourceAddress
+	for _, informer := range this.sourceInformers {
+		objs, err := informer.GetIndexer().ByIndex(redisKeyIndex, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			var ref string
+			var meta *metav1.ObjectMeta
+			switch obj := obj.(type) {
+			case *corev1.Service:
+				// headless services are published from their endpoints
+				if isHeadless(obj) || !this.sources[serviceSource] {
+					continue
+				}
+				ref, meta = objectRef(serviceKind, obj.Namespace+"/"+obj.Name), &obj.ObjectMeta
+			case *networkingv1beta1.Ingress:
+				ref, meta = objectRef(ingressKind, obj.Namespace+"/"+obj.Name), &obj.ObjectMeta
+			default:
+				continue
+			}
+			if meta.DeletionTimestamp != nil {
+				continue
+			}
+
+			ttl := sourceTTL(meta)
+			values := sourceValues(obj)
+			// a name can't have both a CNAME and other addresses, so IPs win
+			hasIP := false
+			for _, value := range values {
+				hasIP = hasIP || addressKind(value) != definitions.Kind_CNAME
+			}
+			for _, value := range values {
+				kind := addressKind(value)
+				if hasIP && kind == definitions.Kind_CNAME {
+					continue
+				}
+				result = append(result, sourceAddress{
+					Ref:     ref,
+					Object:  obj.(runtime.Object),
+					Kind:    kind,
+					Value:   strings.ToLower(strings.TrimSuffix(value, ".")),
+					TTL:     ttl,
+					Healthy: true,
+				})
+			}
+		}
+	}
+
+	endpoints, err := this.endpointAddresses(key)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, endpoints...)
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	zone := this.findZone(definitions.RedisKeyToName(key))
+	for i := range result {
+		result[i].Zone = zone
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Ref != result[j].Ref {
+			return result[i].Ref < result[j].Ref
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result, nil
+}
+
+// enqueueSourceKeys queue the keys of the sources that are in a zone, since zone of their names changed
+func (this *Controller) enqueueSourceKeys(zone string) {
+	for _, informer := range this.sourceInformers {
+		for _, key := range informer.GetIndexer().ListIndexFuncValues(redisKeyIndex) {
+			name := definitions.RedisKeyToName(key)
+			if name == zone || strings.HasSuffix(name, "."+zone) {
+				this.add(syncKey{Kind: recordSyncKind, Name: key})
+			}
+		}
+	}
+}
+
+// syncSourceKeys queue the keys that have an address from a source but no source is published under
+// them anymore, so sources that are deleted while we are not the leader are removed from the REDIS
+func (this *Controller) syncSourceKeys() error {
+	keys, err := this.redis.GetSourceKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		found := false
+		for _, informer := range this.sourceInformers {
+			objs, err := informer.GetIndexer().ByIndex(redisKeyIndex, key)
+			if err != nil {
+				return err
+			}
+			found = found || len(objs) != 0
+		}
+		// names of the endpoints are not indexed, so they are always synced
+		if !found {
+			this.add(syncKey{Kind: recordSyncKind, Name: key})
+		}
+	}
+	return nil
+}
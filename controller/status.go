@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/hoisie/redis"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+)
+
+const (
+	dnsRecordKind       = "DNSRecord"
+	dnsLoadBalancerKind = "DNSLoadBalancer"
+)
+
+// syncResult is the result of syncing a REDIS key, that status of its objects is computed from it
+type syncResult struct {
+	key string
+	// record is the record that stored in the key
+	record *definitions.DNSRecord
+	// err is the error of writing the record
+	err error
+	// drifted is `true` if the record is changed outside of the controller and it is not replaced
+	drifted bool
+	// invalid is the error of the objects that their address is invalid, by their objectRef
+	invalid map[string]error
+	// conflicts is the reason that objects conflict with other objects of the key, by their objectRef
+	conflicts map[string]string
+}
+
+func objectRef(kind, name string) string {
+	return kind + "/" + name
+}
+
+// findConflicts find the objects that has the same address as another object, and the objects that
+// are in a key that has both CNAME and other types of addresses
+func findConflicts(records []*rednsv1.DNSRecord, loadbalancers []*rednsv1.DNSLoadBalancer, sources []sourceAddress) map[string]string {
+	type object struct {
+		ref, kind, value string
+	}
+	var objects []object
+	for _, record := range records {
+		objects = append(objects, object{objectRef(dnsRecordKind, record.Name), record.Spec.Type, record.Spec.Value})
+	}
+	for _, loadbalancer := range loadbalancers {
+		// pools without a value only have the addresses of their members
+		if loadbalancer.Spec.Value != "" {
+			objects = append(objects, object{objectRef(dnsLoadBalancerKind, loadbalancer.Name), loadbalancer.Spec.Type, loadbalancer.Spec.Value})
+		}
+	}
+	for _, source := range sources {
+		objects = append(objects, object{source.Ref, source.Kind, source.Value})
+	}
+
+	hasCNAME, hasOther := false, false
+	for _, obj := range objects {
+		if obj.kind == definitions.Kind_CNAME {
+			hasCNAME = true
+		} else {
+			hasOther = true
+		}
+	}
+
+	result := make(map[string]string)
+	for i, obj := range objects {
+		for j, other := range objects {
+			if i != j && obj.kind == other.kind && strings.EqualFold(obj.value, other.value) {
+				result[obj.ref] = fmt.Sprintf("%s %s is also defined by %s", obj.kind, obj.value, other.ref)
+				break
+			}
+		}
+		if _, ok := result[obj.ref]; !ok && hasCNAME && hasOther {
+			result[obj.ref] = "CNAME can't coexist with other types of addresses"
+		}
+	}
+	return result
+}
+
+// setConditions set Synced, Healthy and Conflicting conditions of an object, it returns the address of
+// the object in the REDIS or nil if it is not there
+func (this *syncResult) setConditions(conditions []rednsv1.DNSCondition, ref, kind, value string, enabled bool) ([]rednsv1.DNSCondition, definitions.IDNSAddress) {
+	var address definitions.IDNSAddress
+	synced := rednsv1.DNSCondition{Type: rednsv1.ConditionSynced, Status: metav1.ConditionTrue, Reason: "Synced"}
+	if this.err != nil {
+		synced.Status, synced.Reason, synced.Message = metav1.ConditionFalse, "RedisError", this.err.Error()
+	} else if err, ok := this.invalid[ref]; ok {
+		reason := "InvalidAddress"
+		if err == errNoDomain {
+			reason = "NoDomain"
+		}
+		synced.Status, synced.Reason, synced.Message = metav1.ConditionFalse, reason, err.Error()
+	} else if this.drifted {
+		synced.Status, synced.Reason = metav1.ConditionFalse, "Drifted"
+		synced.Message = "REDIS value of the name is changed outside of the controller"
+		address = this.record.FindAddress(kind, value)
+	} else {
+		address = this.record.FindAddress(kind, value)
+	}
+	conditions = rednsv1.SetCondition(conditions, synced)
+
+	healthy := rednsv1.DNSCondition{Type: rednsv1.ConditionHealthy}
+	switch {
+	case !enabled:
+		healthy.Status, healthy.Reason = metav1.ConditionFalse, "Disabled"
+	case address == nil:
+		healthy.Status, healthy.Reason = metav1.ConditionUnknown, "NotSynced"
+	case address.BaseAddress().HealthCheck == nil:
+		healthy.Status, healthy.Reason = metav1.ConditionTrue, "NoHealthCheck"
+	case address.BaseAddress().Healthy:
+		healthy.Status, healthy.Reason = metav1.ConditionTrue, "HealthCheckPassed"
+	default:
+		healthy.Status, healthy.Reason = metav1.ConditionFalse, "HealthCheckFailed"
+	}
+	conditions = rednsv1.SetCondition(conditions, healthy)
+
+	conflicting := rednsv1.DNSCondition{Type: rednsv1.ConditionConflicting, Status: metav1.ConditionFalse, Reason: "NoConflict"}
+	if message, ok := this.conflicts[ref]; ok {
+		conflicting.Status, conflicting.Reason, conflicting.Message = metav1.ConditionTrue, "Conflict", message
+	}
+	conditions = rednsv1.SetCondition(conditions, conflicting)
+	return conditions, address
+}
+
+// updateStatuses update status of the objects of a REDIS key from the result of syncing it, `members`
+// is the members of the load balancers by their name
+func (this *Controller) updateStatuses(result *syncResult, records []*rednsv1.DNSRecord, loadbalancers []*rednsv1.DNSLoadBalancer, members map[string][]*rednsv1.DNSRecord) error {
+	var firstErr error
+	for _, record := range records {
+		status := *record.Status.DeepCopy()
+		status.ObservedGeneration = record.Generation
+		status.RedisKey = result.key
+		var address definitions.IDNSAddress
+		ref := objectRef(dnsRecordKind, record.Name)
+		status.Conditions, address = result.setConditions(status.Conditions, ref, record.Spec.Type, record.Spec.Value, record.Spec.Enabled)
+		status.Conditions = rednsv1.SetCondition(status.Conditions, domainCondition(record, result.invalid[ref] != errNoDomain))
+		if address != nil {
+			if health, ok := this.lastHealthCheck(result.key, address); ok {
+				status.LastHealthCheck = &health
+			}
+		}
+		if equality.Semantic.DeepEqual(status, record.Status) {
+			continue
+		}
+
+		record = record.DeepCopy()
+		record.Status = status
+		_, err := this.rednsClient.DevopsV1().DNSRecords().UpdateStatus(context.TODO(), record, metav1.UpdateOptions{})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, loadbalancer := range loadbalancers {
+		status := *loadbalancer.Status.DeepCopy()
+		status.ObservedGeneration = loadbalancer.Generation
+		status.RedisKey = result.key
+		status.Conditions, _ = result.setConditions(status.Conditions,
+			objectRef(dnsLoadBalancerKind, loadbalancer.Name), loadbalancer.Spec.Type, loadbalancer.Spec.Value, loadbalancer.Spec.Enabled)
+		status.Members = result.memberStatuses(loadbalancer, members[loadbalancer.Name])
+		if loadbalancer.Spec.Selector != nil {
+			status.Conditions = rednsv1.SetCondition(status.Conditions, poolHealth(loadbalancer, status.Members))
+		}
+		if equality.Semantic.DeepEqual(status, loadbalancer.Status) {
+			continue
+		}
+
+		loadbalancer = loadbalancer.DeepCopy()
+		loadbalancer.Status = status
+		_, err := this.rednsClient.DevopsV1().DNSLoadBalancers().UpdateStatus(context.TODO(), loadbalancer, metav1.UpdateOptions{})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// domainCondition return the DomainFound condition of a DNSRecord
+func domainCondition(record *rednsv1.DNSRecord, found bool) rednsv1.DNSCondition {
+	if found {
+		return rednsv1.DNSCondition{Type: rednsv1.ConditionDomainFound, Status: metav1.ConditionTrue, Reason: "DomainFound"}
+	}
+	return rednsv1.DNSCondition{
+		Type:    rednsv1.ConditionDomainFound,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NoDomain",
+		Message: fmt.Sprintf("There is no DNSDomain for %s, the record is synced once it is created", record.Spec.Domain),
+	}
+}
+
+// reportOrphanRecords record an event for the DNSRecord objects that are not synced since there is no
+// DNSDomain for their domain, unless they are already marked
+func (this *Controller) reportOrphanRecords(records []*rednsv1.DNSRecord) {
+	for _, record := range records {
+		condition := rednsv1.FindCondition(record.Status.Conditions, rednsv1.ConditionDomainFound)
+		if condition != nil && condition.Status == metav1.ConditionFalse {
+			continue
+		}
+		log.Warningf("Ignoring DNSRecord %s: %v", record.Name, errNoDomain)
+		this.event(record, corev1.EventTypeWarning, "NoDomain", domainCondition(record, false).Message)
+	}
+}
+
+// reportInvalidSources record an event for the sources that their address is not published, since
+// sources have no status
+func (this *Controller) reportInvalidSources(result *syncResult, sources []sourceAddress) {
+	reported := make(map[string]bool)
+	for _, source := range sources {
+		err, ok := result.invalid[source.Ref]
+		if !ok || reported[source.Ref] {
+			continue
+		}
+		reported[source.Ref] = true
+		this.event(source.Object, corev1.EventTypeWarning, "InvalidAddress",
+			fmt.Sprintf("Addresses of %s are not published: %v", definitions.RedisKeyToName(result.key), err))
+	}
+}
+
+//region Health Events
+func healthResultId(kind, value string) string {
+	return kind + "|" + value
+}
+
+// lastHealthCheck return the last health event of an address, servers store its time next to the
+// health of the address and the events are only used for the records that does not have it
+func (this *Controller) lastHealthCheck(key string, address definitions.IDNSAddress) (rednsv1.DNSHealthCheckResult, bool) {
+	base := address.BaseAddress()
+	if base.HealthChanged != nil {
+		return rednsv1.DNSHealthCheckResult{Healthy: base.Healthy, Time: metav1.NewTime(*base.HealthChanged)}, true
+	}
+
+	this.healthMutex.Lock()
+	defer this.healthMutex.Unlock()
+	result, ok := this.healthResults[key][healthResultId(address.GetKind(), address.GetValue())]
+	return result, ok
+}
+
+// evictHealthResults remove the health events of the addresses of a key that are not in its record
+func (this *Controller) evictHealthResults(key string, record *definitions.DNSRecord) {
+	this.healthMutex.Lock()
+	defer this.healthMutex.Unlock()
+	results, ok := this.healthResults[key]
+	if !ok {
+		return
+	}
+	for id := range results {
+		kind, value := splitHealthResultId(id)
+		if record.FindAddress(kind, value) == nil {
+			delete(results, id)
+		}
+	}
+	if len(results) == 0 {
+		delete(this.healthResults, key)
+	}
+}
+func splitHealthResultId(id string) (string, string) {
+	i := strings.IndexByte(id, '|')
+	return id[:i], id[i+1:]
+}
+
+// subscribeHealthEvents subscribe to the health events that servers publish and send them to
+// `messages`, it returns on the first error
+func (this *Controller) subscribeHealthEvents(messages chan<- redis.Message) {
+	err := this.redis.SubscribeHealthEvents(messages)
+	if err != nil {
+		log.Errorf("Error in receiving health events: %v", err)
+	}
+}
+
+// receiveHealthEvents keep the health events and sync the keys that health of their addresses changed
+func (this *Controller) receiveHealthEvents(messages <-chan redis.Message) {
+	for message := range messages {
+		this.handleHealthEvent(message.Message)
+	}
+}
+func (this *Controller) handleHealthEvent(content []byte) {
+	var event definitions.HealthEvent
+	err := json.Unmarshal(content, &event)
+	if err != nil {
+		log.Warningf("Invalid health event: %v", err)
+		return
+	}
+
+	this.healthMutex.Lock()
+	results, ok := this.healthResults[event.Key]
+	if !ok {
+		results = make(map[string]rednsv1.DNSHealthCheckResult)
+		this.healthResults[event.Key] = results
+	}
+	results[healthResultId(event.Kind, event.Value)] = rednsv1.DNSHealthCheckResult{
+		Healthy: event.Healthy,
+		Time:    metav1.NewTime(event.Time),
+	}
+	this.healthMutex.Unlock()
+	this.add(syncKey{Kind: recordSyncKind, Name: event.Key})
+}
+
+//endregion
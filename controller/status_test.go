@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
+	rednsv1 "github.com/devops-simba/redns/definitions/apis/redns/v1"
+)
+
+func TestSetConditions(t *testing.T) {
+	record := &definitions.DNSRecord{}
+	healthCheck := &definitions.HealthCheck{Type: definitions.HealthCheck_TCP, Target: "192.0.2.1:80"}
+	record.AddAddress(definitions.Kind_A, "192.0.2.1", definitions.DNS_Address{Enabled: true, Healthy: true, HealthCheck: healthCheck}, 0)
+	ref := objectRef(dnsRecordKind, "a")
+	result := &syncResult{key: "www.example.com", record: record, invalid: map[string]error{}, conflicts: map[string]string{}}
+
+	conditions, address := result.setConditions(nil, ref, definitions.Kind_A, "192.0.2.1", true)
+	if address == nil {
+		t.Fatal("Expected the address of the object")
+	}
+	for conditionType, expected := range map[string]string{
+		rednsv1.ConditionSynced:      "True/Synced",
+		rednsv1.ConditionHealthy:     "True/HealthCheckPassed",
+		rednsv1.ConditionConflicting: "False/NoConflict",
+	} {
+		if actual := conditionOf(conditions, conditionType); actual != expected {
+			t.Errorf("Expected %s to be %s, got %s", conditionType, expected, actual)
+		}
+	}
+
+	// the transition time only change with the status
+	past := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	for i := range conditions {
+		conditions[i].LastTransitionTime = past
+	}
+	record.ARecords.Addresses[0].Healthy = false
+	conditions, _ = result.setConditions(conditions, ref, definitions.Kind_A, "192.0.2.1", true)
+	if synced := rednsv1.FindCondition(conditions, rednsv1.ConditionSynced); !synced.LastTransitionTime.Equal(&past) {
+		t.Errorf("Transition time of Synced changed without a change of its status: %v", synced.LastTransitionTime)
+	}
+	healthy := rednsv1.FindCondition(conditions, rednsv1.ConditionHealthy)
+	if healthy.Status != metav1.ConditionFalse || healthy.Reason != "HealthCheckFailed" {
+		t.Errorf("Expected False/HealthCheckFailed, got %s/%s", healthy.Status, healthy.Reason)
+	}
+	if !healthy.LastTransitionTime.After(past.Time) {
+		t.Errorf("Transition time of Healthy did not change with its status: %v", healthy.LastTransitionTime)
+	}
+
+	result.invalid[ref] = errors.New("Invalid address")
+	conditions, address = result.setConditions(conditions, ref, definitions.Kind_A, "192.0.2.1", true)
+	if address != nil || conditionOf(conditions, rednsv1.ConditionSynced) != "False/InvalidAddress" ||
+		conditionOf(conditions, rednsv1.ConditionHealthy) != "Unknown/NotSynced" {
+		t.Errorf("Unexpected conditions of an invalid address: %v", conditions)
+	}
+
+	conditions, _ = result.setConditions(nil, ref, definitions.Kind_A, "192.0.2.1", false)
+	if actual := conditionOf(conditions, rednsv1.ConditionHealthy); actual != "False/Disabled" {
+		t.Errorf("Expected False/Disabled for a disabled object, got %s", actual)
+	}
+}
+
+func TestFindConflicts(t *testing.T) {
+	conflicts := findConflicts([]*rednsv1.DNSRecord{
+		testRecord("a", definitions.Kind_A, "192.0.2.1"),
+		testRecord("b", definitions.Kind_A, "192.0.2.1"),
+		testRecord("c", definitions.Kind_A, "192.0.2.2"),
+	}, nil, nil)
+	if len(conflicts) != 2 || !strings.Contains(conflicts[objectRef(dnsRecordKind, "a")], "DNSRecord/b") ||
+		!strings.Contains(conflicts[objectRef(dnsRecordKind, "b")], "DNSRecord/a") {
+		t.Errorf("Expected a and b to conflict, got %v", conflicts)
+	}
+
+	conflicts = findConflicts([]*rednsv1.DNSRecord{
+		testRecord("a", definitions.Kind_A, "192.0.2.1"),
+	}, nil, []sourceAddress{{Ref: "Service/ns/web", Kind: definitions.Kind_CNAME, Value: "web.example.org"}})
+	if len(conflicts) != 2 || conflicts["Service/ns/web"] != "CNAME can't coexist with other types of addresses" {
+		t.Errorf("Expected CNAME to conflict with the other addresses, got %v", conflicts)
+	}
+
+	conflicts = findConflicts([]*rednsv1.DNSRecord{
+		testRecord("a", definitions.Kind_A, "192.0.2.1"),
+		testRecord("b", definitions.Kind_AAAA, "2001:db8::1"),
+	}, nil, nil)
+	if len(conflicts) != 0 {
+		t.Errorf("Expected no conflict, got %v", conflicts)
+	}
+}
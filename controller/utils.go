@@ -8,11 +8,8 @@ import (
 	"os"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-
-	rednsclientset "github.com/devops-simba/redns/definitions/client/clientset/versioned"
 )
 
 const (
@@ -27,25 +24,17 @@ func ReadEnv(envName, defaultValue string) string {
 	return value
 }
 
-func getKubeClients(configPath string) (kubernetes.Interface, rednsclientset.Interface, error) {
+// loadKubeConfig return configuration of the cluster that we are running in, or the configuration
+// in `configPath` if we are not running in a cluster
+func loadKubeConfig(configPath string) (*rest.Config, error) {
 	config, err := rest.InClusterConfig()
-	if err != nil {
-		if configPath == "" {
-			configPath = os.Getenv("HOME") + "/.kube/config"
-		}
-		config, err = clientcmd.BuildConfigFromFlags("", configPath)
-		if err != nil {
-			return nil, nil, err
-		}
+	if err == nil {
+		return config, nil
 	}
-
-	client, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, nil, err
+	if configPath == "" {
+		configPath = os.Getenv("HOME") + "/.kube/config"
 	}
-
-	rednsClient, err := rednsclientset.NewForConfig(config)
-	return client, rednsClient, err
+	return clientcmd.BuildConfigFromFlags("", configPath)
 }
 
 func getLastAppliedVersion(obj *metav1.ObjectMeta) string {
@@ -53,6 +42,9 @@ func getLastAppliedVersion(obj *metav1.ObjectMeta) string {
 	return result
 }
 func setLastAppliedVersion(obj *metav1.ObjectMeta, value string) {
+	if obj.Annotations == nil {
+		obj.Annotations = make(map[string]string)
+	}
 	obj.Annotations[lastAppliedVersionAnnotation] = value
 }
 
@@ -65,5 +57,5 @@ func computeObjectVersion(obj interface{}) string {
 	crc_hash := crc32.New(crc32.MakeTable(crc32.IEEE))
 	crc_hash.Write(s)
 
-	return fmt.Sprintf("%s/%s", adler_hash.Sum32(), crc_hash.Sum32())
+	return fmt.Sprintf("%08x/%08x", adler_hash.Sum32(), crc_hash.Sum32())
 }
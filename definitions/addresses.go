@@ -3,6 +3,7 @@ package definitions
 import (
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -16,6 +17,12 @@ type DNS_Address struct {
 	Enabled bool   `json:"enabled"`
 	Healthy bool   `json:"healthy"`
 	Weight  uint16 `json:"weight,omitempty"`
+	// Tier of this address in `Strategy_Failover`, lower tiers are preferred
+	Tier uint16 `json:"tier,omitempty"`
+	// HealthCheck of this address, `Healthy` is updated by the health check runner if it is set
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// HealthChanged is the last time that the health check runner changed `Healthy`
+	HealthChanged *time.Time `json:"healthChanged,omitempty"`
 }
 
 func (this DNS_Address) createRRHeader(name string, rrtype uint16) dns.RR_Header {
@@ -92,7 +99,7 @@ func (this *DNS_NS_Address) GetKind() string { return Kind_NS }
 func (this *DNS_NS_Address) ToRR(name string) dns.RR {
 	return &dns.NS{
 		Hdr: this.createRRHeader(name, dns.TypeNS),
-		Ns:  this.Value,
+		Ns:  dns.Fqdn(this.Value),
 	}
 }
 
@@ -116,7 +123,7 @@ func (this *DNS_CNAME_Address) GetKind() string { return Kind_CNAME }
 func (this *DNS_CNAME_Address) ToRR(name string) dns.RR {
 	return &dns.CNAME{
 		Hdr:    this.createRRHeader(name, dns.TypeCNAME),
-		Target: this.Value,
+		Target: dns.Fqdn(this.Value),
 	}
 }
 
@@ -144,7 +151,7 @@ func (this *DNS_MX_Address) BaseAddress() *DNS_Address { return &this.DNS_Addres
 func (this *DNS_MX_Address) ToRR(name string) dns.RR {
 	return &dns.MX{
 		Hdr:        this.createRRHeader(name, dns.TypeMX),
-		Mx:         this.Value,
+		Mx:         dns.Fqdn(this.Value),
 		Preference: this.Priority,
 	}
 }
@@ -177,7 +184,7 @@ func (this *DNS_SRV_Address) GetValue() string {
 func (this *DNS_SRV_Address) ToRR(name string) dns.RR {
 	return &dns.SRV{
 		Hdr:      this.createRRHeader(name, dns.TypeSRV),
-		Target:   this.Value,
+		Target:   dns.Fqdn(this.Value),
 		Port:     this.Port,
 		Priority: this.Priority,
 	}
@@ -0,0 +1,63 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionSynced is true when the object is written to the REDIS
+	ConditionSynced = "Synced"
+	// ConditionHealthy is true when the addresses of the object are healthy, or they don't have a
+	// health check
+	ConditionHealthy = "Healthy"
+	// ConditionConflicting is true when the object conflict with another object of the same name
+	ConditionConflicting = "Conflicting"
+	// ConditionDomainFound is true when there is a DNSDomain for the domain of a DNSRecord, records
+	// without a DNSDomain are not written to the REDIS
+	ConditionDomainFound = "DomainFound"
+)
+
+// DNSCondition is a condition of the status of a REDNS resource
+type DNSCondition struct {
+	Type               string                 `json:"type"`
+	Status             metav1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// DNSHealthCheckResult is the last result of the health checks of an address, that changed its health
+type DNSHealthCheckResult struct {
+	Healthy bool        `json:"healthy"`
+	Time    metav1.Time `json:"time"`
+}
+
+// FindCondition return the condition of a type, it returns nil if there is no such condition
+func FindCondition(conditions []DNSCondition, conditionType string) *DNSCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition add or replace a condition, transition time of the condition is kept if its status
+// did not change
+func SetCondition(conditions []DNSCondition, condition DNSCondition) []DNSCondition {
+	current := FindCondition(conditions, condition.Type)
+	if current == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		return append(conditions, condition)
+	}
+
+	if current.Status == condition.Status {
+		condition.LastTransitionTime = current.LastTransitionTime
+	} else if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = metav1.Now()
+	}
+	*current = condition
+	return conditions
+}
@@ -11,7 +11,7 @@ import (
 // DNSDomain is a specification for DNSDomain resource.
 type DNSDomain struct {
 	metav1.TypeMeta   `json:",inline"`
-	metav1.ObjectMeta `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec DNSDomainSpec `json:"spec"`
 }
@@ -19,6 +19,32 @@ type DNSDomain struct {
 // DNSDomainSpec is the spec for a DNSDomain resource.
 type DNSDomainSpec struct {
 	Name string `json:"name"`
+	// Nameserver is the primary nameserver of the zone, that is used in its SOA record
+	Nameserver string `json:"nameserver,omitempty"`
+	// Nameservers are the authoritative nameservers of the zone, they are served as NS records of the
+	// zone apex if it has no NS record. The first one is the primary nameserver if `Nameserver` is empty.
+	Nameservers []string `json:"nameservers,omitempty"`
+	// Mailbox is the mailbox of the person responsible for the zone, in DNS name format
+	Mailbox string `json:"mailbox,omitempty"`
+	// Refresh, Retry and Expire are the timers of the SOA record in seconds
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	// DefaultTTL is TTL of the records of the zone that have no TTL
+	DefaultTTL uint32 `json:"defaultTTL,omitempty"`
+	// MinTTL and MaxTTL limit TTL of the records of the zone
+	MinTTL uint32 `json:"minTTL,omitempty"`
+	MaxTTL uint32 `json:"maxTTL,omitempty"`
+	// NegativeTTL is TTL of the negative answers of the zone
+	NegativeTTL uint32 `json:"negativeTTL,omitempty"`
+	// AllowedTypes are the types of the records that are served in the zone, empty allow all of the types
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// TransferACL is the networks(CIDR) that may transfer the zone, it is stored in the zone settings
+	// but servers do not support zone transfers yet
+	TransferACL []string `json:"transferACL,omitempty"`
+	// DNSSEC enable signing of the zone, it is stored in the zone settings but servers do not sign the
+	// zones yet
+	DNSSEC bool `json:"dnssec,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -14,21 +14,50 @@ type DNSLoadBalancer struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   DNSLoadBalancerSpec   `json:"spec"`
-	Status DNSLoadBalancerStatus `json:"status"`
+	Status DNSLoadBalancerStatus `json:"status,omitempty"`
 }
 
-// DNSLoadBalancerSpec is the spec for a DNSLoadBalancer resource
+// DNSLoadBalancerSpec is the spec for a DNSLoadBalancer resource, it is a pool of addresses of a name.
+// Members of the pool are the DNSRecord objects that are selected by `Selector` and have the same type
+// as the pool.
 type DNSLoadBalancerSpec struct {
-	Domain  string `json:"domain"`
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Value   string `json:"value"`
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Value is an address that is added to the members, it is optional if the pool has a selector
+	Value   string `json:"value,omitempty"`
 	Enabled bool   `json:"enabled"`
+	// Strategy is the strategy of selecting the members, `weighted` if it is empty
+	Strategy string `json:"strategy,omitempty"`
+	// TopN is the number of the members that are returned by the `top-n` strategy
+	TopN uint16 `json:"topN,omitempty"`
+	// TTL is the TTL of the members that have no TTL
+	TTL uint16 `json:"ttl,omitempty"`
+	// HealthCheck is the health check of the members that have no health check
+	HealthCheck *DNSRecordHealthCheck `json:"healthCheck,omitempty"`
+	// Selector select the members by their labels
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
 }
 
 // DNSLoadBalancerStatus is the status for a DNSLoadBalancer resource
 type DNSLoadBalancerStatus struct {
-	Generation *int32 `json:"generation"`
+	// ObservedGeneration is the generation of the object that the status is computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// RedisKey is the REDIS key that hold the addresses of the object
+	RedisKey string `json:"redisKey,omitempty"`
+	// Members is the state of the members of the pool
+	Members    []DNSLoadBalancerMember `json:"members,omitempty"`
+	Conditions []DNSCondition          `json:"conditions,omitempty"`
+}
+
+// DNSLoadBalancerMember is the state of a member of a DNSLoadBalancer
+type DNSLoadBalancerMember struct {
+	// Name is name of the DNSRecord of the member
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Weight  uint16 `json:"weight"`
+	Enabled bool   `json:"enabled"`
+	Healthy bool   `json:"healthy"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -2,6 +2,8 @@ package v1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devops-simba/redns/definitions"
 )
 
 // +genclient
@@ -14,31 +16,51 @@ type DNSRecord struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   DNSRecordSpec   `json:"spec"`
-	Status DNSRecordStatus `json:"status"`
+	Status DNSRecordStatus `json:"status,omitempty"`
 }
 
 // DNSRecordSpec is the spec for a DNSRecord resource
 type DNSRecordSpec struct {
-	Domain      string               `json:"domain"`
-	Name        string               `json:"name"`
-	Type        string               `json:"type"`
-	Value       string               `json:"value"`
-	Weight      uint16               `json:"weight"`
-	TTL         uint16               `json:"ttl"`
-	Priority    *uint16              `json:"priority,omitempty"`
-	Enabled     bool                 `json:"enabled"`
-	HealthCheck DNSRecordHealthCheck `json:"healthCheck"`
+	Domain      string                `json:"domain"`
+	Name        string                `json:"name"`
+	Type        string                `json:"type"`
+	Value       string                `json:"value"`
+	Weight      uint16                `json:"weight"`
+	TTL         uint16                `json:"ttl"`
+	Priority    *uint16               `json:"priority,omitempty"`
+	Enabled     bool                  `json:"enabled"`
+	HealthCheck *DNSRecordHealthCheck `json:"healthCheck,omitempty"`
 }
 
 // DNSRecordStatus is the status for a DNSRecord resource
 type DNSRecordStatus struct {
-	Generation *int32 `json:"generation"`
+	// ObservedGeneration is the generation of the object that the status is computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// RedisKey is the REDIS key that hold the addresses of the object
+	RedisKey string `json:"redisKey,omitempty"`
+	// LastHealthCheck is the last result of the health checks that changed health of the address
+	LastHealthCheck *DNSHealthCheckResult `json:"lastHealthCheck,omitempty"`
+	Conditions      []DNSCondition        `json:"conditions,omitempty"`
 }
 
-// DNSRecordHealthCheck is the specification for healthCheck of a DNSRecord resource
+// DNSRecordHealthCheck is the specification for healthCheck of a DNSRecord resource, it is the same
+// health check that stored with the addresses
 type DNSRecordHealthCheck struct {
-	Type   string `json:"type"`
-	Server string `json:"server"`
+	definitions.HealthCheck `json:",inline"`
+	// Server is the old name of `Target`
+	Server string `json:"server,omitempty"`
+}
+
+// ToHealthCheck return the health check that should be stored with the address of the record
+func (this *DNSRecordHealthCheck) ToHealthCheck() *definitions.HealthCheck {
+	if this == nil || this.Type == "" {
+		return nil
+	}
+	result := this.HealthCheck.DeepCopy()
+	if result.Target == "" {
+		result.Target = this.Server
+	}
+	return result
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -5,15 +5,33 @@
 package v1
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSCondition) DeepCopyInto(out *DNSCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSCondition.
+func (in *DNSCondition) DeepCopy() *DNSCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSDomain) DeepCopyInto(out *DNSDomain) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	return
 }
 
@@ -71,6 +89,21 @@ func (in *DNSDomainList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSDomainSpec) DeepCopyInto(out *DNSDomainSpec) {
 	*out = *in
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedTypes != nil {
+		in, out := &in.AllowedTypes, &out.AllowedTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TransferACL != nil {
+		in, out := &in.TransferACL, &out.TransferACL
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -84,12 +117,29 @@ func (in *DNSDomainSpec) DeepCopy() *DNSDomainSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSHealthCheckResult) DeepCopyInto(out *DNSHealthCheckResult) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSHealthCheckResult.
+func (in *DNSHealthCheckResult) DeepCopy() *DNSHealthCheckResult {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSHealthCheckResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSLoadBalancer) DeepCopyInto(out *DNSLoadBalancer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -145,9 +195,35 @@ func (in *DNSLoadBalancerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSLoadBalancerMember) DeepCopyInto(out *DNSLoadBalancerMember) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSLoadBalancerMember.
+func (in *DNSLoadBalancerMember) DeepCopy() *DNSLoadBalancerMember {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSLoadBalancerMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSLoadBalancerSpec) DeepCopyInto(out *DNSLoadBalancerSpec) {
 	*out = *in
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(DNSRecordHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -164,10 +240,17 @@ func (in *DNSLoadBalancerSpec) DeepCopy() *DNSLoadBalancerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSLoadBalancerStatus) DeepCopyInto(out *DNSLoadBalancerStatus) {
 	*out = *in
-	if in.Generation != nil {
-		in, out := &in.Generation, &out.Generation
-		*out = new(int32)
-		**out = **in
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]DNSLoadBalancerMember, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]DNSCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -213,6 +296,7 @@ func (in *DNSRecord) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSRecordHealthCheck) DeepCopyInto(out *DNSRecordHealthCheck) {
 	*out = *in
+	in.HealthCheck.DeepCopyInto(&out.HealthCheck)
 	return
 }
 
@@ -267,7 +351,11 @@ func (in *DNSRecordSpec) DeepCopyInto(out *DNSRecordSpec) {
 		*out = new(uint16)
 		**out = **in
 	}
-	out.HealthCheck = in.HealthCheck
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(DNSRecordHealthCheck)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -284,10 +372,17 @@ func (in *DNSRecordSpec) DeepCopy() *DNSRecordSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSRecordStatus) DeepCopyInto(out *DNSRecordStatus) {
 	*out = *in
-	if in.Generation != nil {
-		in, out := &in.Generation, &out.Generation
-		*out = new(int32)
-		**out = **in
+	if in.LastHealthCheck != nil {
+		in, out := &in.LastHealthCheck, &out.LastHealthCheck
+		*out = new(DNSHealthCheckResult)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]DNSCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -0,0 +1,279 @@
+// Package changequeue contain the producer and the consumer of the queue of the changes that the
+// controller make in the REDIS. Consumers may use it to invalidate their caches or notify secondary
+// servers.
+//
+// Events that are in the queue are delivered at least once, but the producer keep the events that it
+// could not put in the queue only in memory, so they are lost if the controller restarts or too many
+// of them are kept. The queue is not a complete history of the changes, consumers must resync their
+// caches from the REDIS when they start and should resync them periodically.
+package changequeue
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adjust/redismq"
+	log "github.com/golang/glog"
+)
+
+// Operations of the events
+const (
+	// Operation_Set means records of the key are written
+	Operation_Set = "set"
+	// Operation_Delete means records of the key are removed
+	Operation_Delete = "delete"
+	// Operation_SetZone means settings of the zone are written
+	Operation_SetZone = "set-zone"
+	// Operation_DeleteZone means the zone and its settings are removed
+	Operation_DeleteZone = "delete-zone"
+)
+
+const (
+	defaultMaxPending   = 1000
+	defaultMaxAttempts  = 5
+	defaultRetryDelay   = time.Second
+	defaultPollInterval = time.Second
+)
+
+// queue is the part of redismq.Queue that is used, so it can be replaced in the tests
+type queue interface {
+	Put(payload string) error
+	GetInputLength() int64
+	GetFailedLength() int64
+	RequeueFailed() error
+}
+
+// delivery is a package of the queue that is delivered to a consumer
+type delivery interface {
+	payload() string
+	Ack() error
+	Fail() error
+}
+
+// consumer is the part of redismq.Consumer that is used, so it can be replaced in the tests
+type consumer interface {
+	HasUnacked() bool
+	getUnacked() (delivery, error)
+	noWait() (delivery, error)
+}
+
+type redismqPackage struct {
+	*redismq.Package
+}
+
+func (this redismqPackage) payload() string {
+	return this.Payload
+}
+
+type redismqConsumer struct {
+	*redismq.Consumer
+}
+
+func (this redismqConsumer) getUnacked() (delivery, error) {
+	pkg, err := this.GetUnacked()
+	if err != nil {
+		return nil, err
+	}
+	return redismqPackage{pkg}, nil
+}
+func (this redismqConsumer) noWait() (delivery, error) {
+	pkg, err := this.NoWait()
+	if err != nil {
+		return nil, err
+	}
+	return redismqPackage{pkg}, nil
+}
+
+// Event is a change that is made in the REDIS
+type Event struct {
+	// Key is the REDIS key that is changed, for zone operations it is the zone info key
+	Key string `json:"key"`
+	// Domain is the zone of the key
+	Domain    string `json:"domain"`
+	Operation string `json:"operation"`
+	// Version is the version of the value that is written, it is empty for deletes
+	Version string    `json:"version,omitempty"`
+	Time    time.Time `json:"time"`
+	// Attempts is the number of the failed deliveries of the event
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Producer put the events in a queue. Events that could not be put are kept in memory and retried
+// before the next event, so a short outage of the queue does not lose them. Kept events are lost if
+// the controller stops or more than `MaxPending` events are kept, the key of every lost event is logged
+// and consumers should fully resync their caches when they start, since they may miss a change.
+type Producer struct {
+	queue queue
+	// MaxPending is the maximum number of the kept events, older events are dropped
+	MaxPending int
+
+	mutex   sync.Mutex
+	pending []Event
+}
+
+func NewProducer(queue *redismq.Queue) *Producer {
+	return newProducer(queue)
+}
+func newProducer(queue queue) *Producer {
+	return &Producer{queue: queue, MaxPending: defaultMaxPending}
+}
+
+// Publish put an event in the queue, if it fails the event is kept and it is retried with the next
+// event. Events are published in the order of the calls, so callers publish after their write.
+func (this *Producer) Publish(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.pending = append(this.pending, event)
+	var err error
+	for len(this.pending) != 0 {
+		var content []byte
+		content, err = json.Marshal(this.pending[0])
+		if err == nil {
+			err = this.queue.Put(string(content))
+		}
+		if err != nil {
+			break
+		}
+		this.pending = this.pending[1:]
+	}
+	if len(this.pending) > this.MaxPending {
+		dropped := this.pending[:len(this.pending)-this.MaxPending]
+		for _, event := range dropped {
+			log.Errorf("Dropped %s change event of %s, the queue is not available", event.Operation, event.Key)
+		}
+		this.pending = this.pending[len(dropped):]
+	}
+	return err
+}
+
+// Handler handle an event, returning an error cause the event to be retried
+type Handler func(event Event) error
+
+// Consumer deliver the events of a queue to a handler, at least once. An event is acknowledged after
+// its handler succeeds, so the events of a consumer that crashed while handling them are delivered
+// again when it starts again with the same name. Events that their handler failed `MaxAttempts` times,
+// or that are invalid, are moved to the failed queue of the queue(dead letters).
+// Only the events that reached the queue are delivered, events that the producer dropped are not,
+// so a consumer must resync its state from the REDIS when it starts.
+type Consumer struct {
+	queue    queue
+	consumer consumer
+	handler  Handler
+
+	// MaxAttempts is the number of the deliveries of an event before it is moved to the dead letters
+	MaxAttempts int
+	// RetryDelay is the delay before putting a failed event back in the queue
+	RetryDelay time.Duration
+	// PollInterval is the interval of checking an empty queue for new events
+	PollInterval time.Duration
+}
+
+// NewConsumer create a consumer of a queue, name of the consumer should be stable across restarts
+// of the consumer and unique between the consumers of the queue
+func NewConsumer(queue *redismq.Queue, name string, handler Handler) (*Consumer, error) {
+	consumer, err := queue.AddConsumer(name)
+	if err != nil {
+		return nil, err
+	}
+	return newConsumer(queue, redismqConsumer{consumer}, handler), nil
+}
+func newConsumer(queue queue, consumer consumer, handler Handler) *Consumer {
+	return &Consumer{
+		queue:        queue,
+		consumer:     consumer,
+		handler:      handler,
+		MaxAttempts:  defaultMaxAttempts,
+		RetryDelay:   defaultRetryDelay,
+		PollInterval: defaultPollInterval,
+	}
+}
+
+// Run deliver the events until `stop` closed, it returns on the first error of the queue
+func (this *Consumer) Run(stop <-chan struct{}) error {
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		pkg, err := this.next()
+		if err != nil {
+			return err
+		}
+		if pkg == nil {
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(this.PollInterval):
+			}
+			continue
+		}
+
+		err = this.deliver(pkg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// DeadLetters return the number of the events in the dead letters
+func (this *Consumer) DeadLetters() int64 {
+	return this.queue.GetFailedLength()
+}
+
+// RequeueDeadLetters put the dead letters back in the queue
+func (this *Consumer) RequeueDeadLetters() error {
+	return this.queue.RequeueFailed()
+}
+
+// next return the next event of the queue, the event that is not acknowledged before the last stop
+// come first. It returns nil if the queue is empty.
+func (this *Consumer) next() (delivery, error) {
+	if this.consumer.HasUnacked() {
+		return this.consumer.getUnacked()
+	}
+	if this.queue.GetInputLength() == 0 {
+		return nil, nil
+	}
+	return this.consumer.noWait()
+}
+func (this *Consumer) deliver(pkg delivery) error {
+	var event Event
+	err := json.Unmarshal([]byte(pkg.payload()), &event)
+	if err != nil {
+		log.Errorf("Moving invalid change event to the dead letters: %v", err)
+		return pkg.Fail()
+	}
+
+	err = this.handler(event)
+	if err == nil {
+		return pkg.Ack()
+	}
+
+	event.Attempts++
+	if event.Attempts >= this.MaxAttempts {
+		log.Errorf("Moving change event of %s to the dead letters after %d attempts: %v",
+			event.Key, event.Attempts, err)
+		return pkg.Fail()
+	}
+	log.Warningf("Error in handling change event of %s, retrying: %v", event.Key, err)
+
+	// the retry is put before the acknowledge, so the event is never lost
+	time.Sleep(this.RetryDelay)
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = this.queue.Put(string(content))
+	if err != nil {
+		return fmt.Errorf("Failed to put the event back in the queue: %v", err)
+	}
+	return pkg.Ack()
+}
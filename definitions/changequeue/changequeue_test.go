@@ -0,0 +1,198 @@
+package changequeue
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// memoryQueue is a queue with a single consumer that keep its packages in the memory
+type memoryQueue struct {
+	input   []string
+	failed  []string
+	unacked []*memoryPackage
+	// err is returned by Put, if it is not nil
+	err error
+}
+type memoryPackage struct {
+	queue   *memoryQueue
+	content string
+}
+
+func (this *memoryQueue) Put(payload string) error {
+	if this.err != nil {
+		return this.err
+	}
+	this.input = append(this.input, payload)
+	return nil
+}
+func (this *memoryQueue) GetInputLength() int64  { return int64(len(this.input)) }
+func (this *memoryQueue) GetFailedLength() int64 { return int64(len(this.failed)) }
+func (this *memoryQueue) RequeueFailed() error {
+	this.input = append(this.input, this.failed...)
+	this.failed = nil
+	return nil
+}
+func (this *memoryQueue) HasUnacked() bool { return len(this.unacked) != 0 }
+func (this *memoryQueue) getUnacked() (delivery, error) {
+	if len(this.unacked) == 0 {
+		return nil, errors.New("No unacked package")
+	}
+	return this.unacked[0], nil
+}
+func (this *memoryQueue) noWait() (delivery, error) {
+	if len(this.unacked) != 0 {
+		return nil, errors.New("Unacked packages found")
+	}
+	if len(this.input) == 0 {
+		return nil, errors.New("No package")
+	}
+	pkg := &memoryPackage{queue: this, content: this.input[0]}
+	this.input = this.input[1:]
+	this.unacked = append(this.unacked, pkg)
+	return pkg, nil
+}
+
+func (this *memoryPackage) payload() string { return this.content }
+func (this *memoryPackage) remove() {
+	for i, pkg := range this.queue.unacked {
+		if pkg == this {
+			this.queue.unacked = append(this.queue.unacked[:i], this.queue.unacked[i+1:]...)
+			return
+		}
+	}
+}
+func (this *memoryPackage) Ack() error {
+	this.remove()
+	return nil
+}
+func (this *memoryPackage) Fail() error {
+	this.remove()
+	this.queue.failed = append(this.queue.failed, this.content)
+	return nil
+}
+
+func decodeEvents(t *testing.T, payloads []string) []Event {
+	events := make([]Event, len(payloads))
+	for i, payload := range payloads {
+		if err := json.Unmarshal([]byte(payload), &events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return events
+}
+
+// deliverNext deliver the next package of the queue to the consumer
+func deliverNext(t *testing.T, consumer *Consumer) {
+	pkg, err := consumer.next()
+	if err != nil || pkg == nil {
+		t.Fatalf("Expected a package, got %v", err)
+	}
+	if err = consumer.deliver(pkg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProducerPending(t *testing.T) {
+	queue := &memoryQueue{err: errors.New("Queue is down")}
+	producer := newProducer(queue)
+	producer.MaxPending = 2
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := producer.Publish(Event{Key: key, Operation: Operation_Set}); err == nil {
+			t.Fatal("Expected the error of the queue")
+		}
+	}
+	queue.err = nil
+	if err := producer.Publish(Event{Key: "d", Operation: Operation_Delete}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest event is dropped, the others are put in order
+	events := decodeEvents(t, queue.input)
+	if len(events) != 3 || events[0].Key != "b" || events[1].Key != "c" || events[2].Key != "d" {
+		t.Fatalf("Expected b, c and d in order, got %+v", events)
+	}
+	if events[0].Time.IsZero() {
+		t.Error("Time of the event is not set")
+	}
+}
+
+func TestConsumerRetry(t *testing.T) {
+	queue := &memoryQueue{}
+	var handled []Event
+	fail := true
+	consumer := newConsumer(queue, queue, func(event Event) error {
+		handled = append(handled, event)
+		if fail {
+			return errors.New("Handler failed")
+		}
+		return nil
+	})
+	consumer.MaxAttempts = 3
+	consumer.RetryDelay = 0
+	newProducer(queue).Publish(Event{Key: "www.example.com", Operation: Operation_Set})
+
+	// failed events are put back with their attempts, until they reach the dead letters
+	for attempt := 1; attempt < consumer.MaxAttempts; attempt++ {
+		deliverNext(t, consumer)
+		events := decodeEvents(t, queue.input)
+		if len(events) != 1 || events[0].Attempts != attempt || len(queue.unacked) != 0 {
+			t.Fatalf("Expected the event to be put back with %d attempts, got %+v", attempt, events)
+		}
+	}
+	deliverNext(t, consumer)
+	if len(queue.input) != 0 || consumer.DeadLetters() != 1 {
+		t.Fatalf("Expected the event in the dead letters, input: %v, failed: %v", queue.input, queue.failed)
+	}
+	if len(handled) != consumer.MaxAttempts {
+		t.Errorf("Expected %d deliveries, got %d", consumer.MaxAttempts, len(handled))
+	}
+
+	// requeued dead letters are delivered again
+	fail = false
+	if err := consumer.RequeueDeadLetters(); err != nil {
+		t.Fatal(err)
+	}
+	deliverNext(t, consumer)
+	if consumer.DeadLetters() != 0 || len(queue.input) != 0 || len(queue.unacked) != 0 {
+		t.Fatalf("Expected the event to be acknowledged, input: %v, failed: %v", queue.input, queue.failed)
+	}
+}
+
+func TestConsumerInvalidEvent(t *testing.T) {
+	queue := &memoryQueue{input: []string{"invalid"}}
+	consumer := newConsumer(queue, queue, func(event Event) error {
+		t.Fatalf("Invalid event is handled: %+v", event)
+		return nil
+	})
+	deliverNext(t, consumer)
+	if consumer.DeadLetters() != 1 || len(queue.unacked) != 0 {
+		t.Fatalf("Expected the invalid event in the dead letters, failed: %v", queue.failed)
+	}
+}
+
+func TestConsumerUnacked(t *testing.T) {
+	queue := &memoryQueue{}
+	producer := newProducer(queue)
+	producer.Publish(Event{Key: "a", Operation: Operation_Set})
+	producer.Publish(Event{Key: "b", Operation: Operation_Set})
+	// a consumer that stopped before acknowledging its package
+	if _, err := queue.noWait(); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled []string
+	consumer := newConsumer(queue, queue, func(event Event) error {
+		handled = append(handled, event.Key)
+		return nil
+	})
+	deliverNext(t, consumer)
+	deliverNext(t, consumer)
+	if pkg, err := consumer.next(); err != nil || pkg != nil {
+		t.Fatalf("Expected an empty queue, got %v, %v", pkg, err)
+	}
+	if len(handled) != 2 || handled[0] != "a" || handled[1] != "b" {
+		t.Errorf("Expected the unacked event first, got %v", handled)
+	}
+}
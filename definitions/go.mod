@@ -3,7 +3,10 @@ module github.com/devops-simba/redns/definitions
 go 1.14
 
 require (
+	github.com/adjust/redismq master
+	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/miekg/dns v1.1.31
+	golang.org/x/net v0.0.0-20191004110552-13f9640d40b9
 	k8s.io/client-go v0.18.3
 	k8s.io/apimachinery v0.18.3
 )
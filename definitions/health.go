@@ -0,0 +1,250 @@
+package definitions
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	HealthCheck_TCP  = "tcp"
+	HealthCheck_TLS  = "tls"
+	HealthCheck_ICMP = "icmp"
+	HealthCheck_HTTP = "http"
+	HealthCheck_DNS  = "dns"
+	HealthCheck_GRPC = "grpc"
+
+	// HealthEventsChannel is the REDIS channel that changes of the health of the addresses are published on it
+	HealthEventsChannel = "dns-health-events"
+)
+
+// HealthCheck is the health check of an address, the health check runner update `Healthy` of the
+// address using it
+type HealthCheck struct {
+	// Type of the check, one of tcp, tls, icmp, http, dns or grpc
+	Type string `json:"type"`
+	// Target of the check, `host:port` for tcp, tls, dns and grpc, host for icmp and URL for http.
+	// If it is empty, it is derived from value of the address(see `GetTarget`)
+	Target string `json:"target,omitempty"`
+	// Interval between checks in seconds, 0 use the default of the runner
+	Interval uint32 `json:"interval,omitempty"`
+	// Timeout of a check in seconds, 0 use the default of the runner
+	Timeout uint32 `json:"timeout,omitempty"`
+	// Rise is number of the consecutive successful checks that mark an unhealthy address healthy
+	Rise uint16 `json:"rise,omitempty"`
+	// Fall is number of the consecutive failed checks that mark a healthy address unhealthy
+	Fall uint16 `json:"fall,omitempty"`
+
+	// Settings of the specific types of the checks
+	HTTP *HTTPHealthCheck `json:"http,omitempty"`
+	TLS  *TLSHealthCheck  `json:"tls,omitempty"`
+	TCP  *TCPHealthCheck  `json:"tcp,omitempty"`
+	DNS  *DNSHealthCheck  `json:"dns,omitempty"`
+	GRPC *GRPCHealthCheck `json:"grpc,omitempty"`
+}
+
+// HTTPHealthCheck is the expectations of an http check
+type HTTPHealthCheck struct {
+	// Method of the request, GET if it is empty
+	Method string `json:"method,omitempty"`
+	// Headers of the request, `Host` change the virtual host of the request
+	Headers map[string]string `json:"headers,omitempty"`
+	// ExpectedStatus is the status codes that are healthy, any 2xx if it is empty
+	ExpectedStatus []int `json:"expectedStatus,omitempty"`
+	// BodyRegex is a regular expression that must match the body of the response
+	BodyRegex string `json:"bodyRegex,omitempty"`
+}
+
+// TLSHealthCheck is the TLS settings of tls, https and grpc checks
+type TLSHealthCheck struct {
+	// ServerName is the SNI of the handshake, host of the target if it is empty
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disable verification of the certificate of the server
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// MinValidDays fail the check if the certificate of the server expire in less than this days
+	MinValidDays uint32 `json:"minValidDays,omitempty"`
+}
+
+// TCPHealthCheck is the conversation of tcp and tls checks
+type TCPHealthCheck struct {
+	// Send is written to the connection after it established
+	Send string `json:"send,omitempty"`
+	// Expect must be in the data that read from the connection
+	Expect string `json:"expect,omitempty"`
+}
+
+// DNSHealthCheck is the query of a dns check
+type DNSHealthCheck struct {
+	// Name that is queried
+	Name string `json:"name"`
+	// Type of the query, A if it is empty
+	Type string `json:"type,omitempty"`
+	// Transport of the query, udp or tcp, udp if it is empty
+	Transport string `json:"transport,omitempty"`
+	// ExpectedRcode is the expected response code, NOERROR if it is empty
+	ExpectedRcode string `json:"expectedRcode,omitempty"`
+	// Expected must be in one of the answers, if it is not empty
+	Expected string `json:"expected,omitempty"`
+}
+
+// GRPCHealthCheck is the request of a grpc check that uses grpc.health.v1.Health/Check
+type GRPCHealthCheck struct {
+	// Service that is checked, empty check the server itself
+	Service string `json:"service,omitempty"`
+}
+
+// GetTarget return target of the check for an address. If `Target` is empty it is derived from the
+// value of the address, using the default port of the check if the value does not have a port:
+// `value:443` for tls, `http://value/`(https if `TLS` is set) for http, `value:443`(80 without `TLS`)
+// for grpc and the value itself for icmp and dns(that use port 53). tcp has no default port, so the
+// value must have a port, like values of the SRV addresses.
+func (this *HealthCheck) GetTarget(value string) (string, error) {
+	if this.Target != "" {
+		return this.Target, nil
+	}
+
+	_, _, err := net.SplitHostPort(value)
+	hasPort := err == nil
+	withPort := func(port string) string {
+		if hasPort {
+			return value
+		}
+		return net.JoinHostPort(value, port)
+	}
+	switch strings.ToLower(this.Type) {
+	case HealthCheck_TCP:
+		if !hasPort {
+			return "", fmt.Errorf("tcp health check of `%s` require a target, since it has no port", value)
+		}
+		return value, nil
+	case HealthCheck_TLS:
+		return withPort("443"), nil
+	case HealthCheck_HTTP:
+		host := value
+		if !hasPort && strings.IndexByte(value, ':') != -1 {
+			// IPv6 address
+			host = "[" + value + "]"
+		}
+		if this.TLS != nil {
+			return "https://" + host + "/", nil
+		}
+		return "http://" + host + "/", nil
+	case HealthCheck_GRPC:
+		if this.TLS != nil {
+			return withPort("443"), nil
+		}
+		return withPort("80"), nil
+	default:
+		return value, nil
+	}
+}
+
+// Validate check the health check and return an error that describe its first problem
+func (this *HealthCheck) Validate() error {
+	switch strings.ToLower(this.Type) {
+	case HealthCheck_TCP, HealthCheck_TLS, HealthCheck_ICMP, HealthCheck_HTTP, HealthCheck_GRPC:
+	case HealthCheck_DNS:
+		if this.DNS == nil || this.DNS.Name == "" {
+			return errors.New("dns health check require a name to query")
+		}
+	default:
+		return fmt.Errorf("Invalid health check type `%s`", this.Type)
+	}
+
+	if this.HTTP != nil {
+		if this.HTTP.BodyRegex != "" {
+			if _, err := regexp.Compile(this.HTTP.BodyRegex); err != nil {
+				return fmt.Errorf("Invalid body regex: %v", err)
+			}
+		}
+		for _, status := range this.HTTP.ExpectedStatus {
+			if status < 100 || status > 599 {
+				return fmt.Errorf("Invalid expected status: %d", status)
+			}
+		}
+	}
+	if this.DNS != nil {
+		if this.DNS.Type != "" {
+			if _, ok := dns.StringToType[strings.ToUpper(this.DNS.Type)]; !ok {
+				return fmt.Errorf("Invalid dns query type `%s`", this.DNS.Type)
+			}
+		}
+		if this.DNS.ExpectedRcode != "" {
+			if _, ok := dns.StringToRcode[strings.ToUpper(this.DNS.ExpectedRcode)]; !ok {
+				return fmt.Errorf("Invalid dns response code `%s`", this.DNS.ExpectedRcode)
+			}
+		}
+		switch strings.ToLower(this.DNS.Transport) {
+		case "", "udp", "tcp":
+		default:
+			return fmt.Errorf("Invalid dns transport `%s`", this.DNS.Transport)
+		}
+	}
+	return nil
+}
+
+//region DeepCopy
+// DeepCopy methods let kubernetes objects contain health checks
+
+func (in *HealthCheck) DeepCopyInto(out *HealthCheck) {
+	*out = *in
+	if in.HTTP != nil {
+		out.HTTP = in.HTTP.DeepCopy()
+	}
+	if in.TLS != nil {
+		tls := *in.TLS
+		out.TLS = &tls
+	}
+	if in.TCP != nil {
+		tcp := *in.TCP
+		out.TCP = &tcp
+	}
+	if in.DNS != nil {
+		query := *in.DNS
+		out.DNS = &query
+	}
+	if in.GRPC != nil {
+		grpc := *in.GRPC
+		out.GRPC = &grpc
+	}
+}
+func (in *HealthCheck) DeepCopy() *HealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+func (in *HTTPHealthCheck) DeepCopy() *HTTPHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Headers != nil {
+		out.Headers = make(map[string]string, len(in.Headers))
+		for key, value := range in.Headers {
+			out.Headers[key] = value
+		}
+	}
+	if in.ExpectedStatus != nil {
+		out.ExpectedStatus = append([]int{}, in.ExpectedStatus...)
+	}
+	return &out
+}
+
+//endregion
+
+// HealthEvent is an event that published when health of an address changed
+type HealthEvent struct {
+	Key     string    `json:"key"`
+	Kind    string    `json:"kind"`
+	Value   string    `json:"value"`
+	Healthy bool      `json:"healthy"`
+	Time    time.Time `json:"time"`
+}
@@ -0,0 +1,34 @@
+package definitions
+
+import "testing"
+
+func TestHealthCheckGetTarget(t *testing.T) {
+	cases := []struct {
+		check  HealthCheck
+		value  string
+		target string
+	}{
+		{HealthCheck{Type: HealthCheck_HTTP, Target: "http://192.0.2.1:8080/healthz"}, "192.0.2.1", "http://192.0.2.1:8080/healthz"},
+		{HealthCheck{Type: HealthCheck_HTTP}, "192.0.2.1", "http://192.0.2.1/"},
+		{HealthCheck{Type: HealthCheck_HTTP}, "2001:db8::1", "http://[2001:db8::1]/"},
+		{HealthCheck{Type: HealthCheck_HTTP, TLS: &TLSHealthCheck{}}, "www.example.com", "https://www.example.com/"},
+		{HealthCheck{Type: HealthCheck_TLS}, "192.0.2.1", "192.0.2.1:443"},
+		{HealthCheck{Type: HealthCheck_TLS}, "2001:db8::1", "[2001:db8::1]:443"},
+		{HealthCheck{Type: HealthCheck_GRPC}, "192.0.2.1", "192.0.2.1:80"},
+		{HealthCheck{Type: HealthCheck_GRPC, TLS: &TLSHealthCheck{}}, "192.0.2.1", "192.0.2.1:443"},
+		{HealthCheck{Type: HealthCheck_TCP}, "sip.example.com:5060", "sip.example.com:5060"},
+		{HealthCheck{Type: HealthCheck_DNS}, "192.0.2.1", "192.0.2.1"},
+		{HealthCheck{Type: HealthCheck_ICMP}, "192.0.2.1", "192.0.2.1"},
+	}
+	for _, c := range cases {
+		target, err := c.check.GetTarget(c.value)
+		if err != nil || target != c.target {
+			t.Errorf("%s check of %s: got (%q, %v), expected %q", c.check.Type, c.value, target, err, c.target)
+		}
+	}
+
+	check := HealthCheck{Type: HealthCheck_TCP}
+	if _, err := check.GetTarget("192.0.2.1"); err == nil {
+		t.Error("Expected an error for tcp check of an address without port")
+	}
+}
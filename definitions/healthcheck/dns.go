@@ -0,0 +1,65 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+//region DNS HealthCheck
+type dnsHealthCheck struct{}
+
+func (this dnsHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	query := check.DNS
+	if query == nil || query.Name == "" {
+		return errors.New("Missing name of the dns query")
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "53")
+	}
+
+	qtype := dns.TypeA
+	if query.Type != "" {
+		var ok bool
+		qtype, ok = dns.StringToType[strings.ToUpper(query.Type)]
+		if !ok {
+			return fmt.Errorf("Invalid dns query type `%s`", query.Type)
+		}
+	}
+	rcode := dns.RcodeSuccess
+	if query.ExpectedRcode != "" {
+		var ok bool
+		rcode, ok = dns.StringToRcode[strings.ToUpper(query.ExpectedRcode)]
+		if !ok {
+			return fmt.Errorf("Invalid dns response code `%s`", query.ExpectedRcode)
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(query.Name), qtype)
+	client := &dns.Client{Net: strings.ToLower(query.Transport)}
+	resp, _, err := client.ExchangeContext(ctx, m, target)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != rcode {
+		return fmt.Errorf("Unexpected response code: %s", dns.RcodeToString[resp.Rcode])
+	}
+	if query.Expected == "" {
+		return nil
+	}
+	for _, rr := range resp.Answer {
+		if strings.Contains(rr.String(), query.Expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("No answer contain `%s`", query.Expected)
+}
+
+//endregion
@@ -0,0 +1,176 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/http2"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+//region GRPC HealthCheck
+// grpcHealthCheck call `grpc.health.v1.Health/Check` of the target, messages of the protocol are
+// small enough that we encode them by hand instead of depending on the whole grpc stack
+
+const (
+	grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+	grpcServing         = 1
+)
+
+var grpcStatusNames = map[uint64]string{0: "UNKNOWN", 1: "SERVING", 2: "NOT_SERVING", 3: "SERVICE_UNKNOWN"}
+
+type grpcHealthCheck struct{}
+
+func (this grpcHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+
+	scheme := "https"
+	transport := &http2.Transport{}
+	if check.TLS != nil {
+		transport.TLSClientConfig = tlsConfig(check, host)
+	} else {
+		// h2c, HTTP/2 without TLS
+		scheme = "http"
+		transport.AllowHTTP = true
+		transport.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	defer transport.CloseIdleConnections()
+
+	var service string
+	if check.GRPC != nil {
+		service = check.GRPC.Service
+	}
+	req, err := http.NewRequest(http.MethodPost, scheme+"://"+target+grpcHealthCheckPath,
+		bytes.NewReader(grpcFrame(grpcHealthCheckRequest(service))))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected HTTP status: %s", resp.Status)
+	}
+	if err = checkCertificate(check, resp.TLS); err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxReadSize))
+	if err != nil {
+		return err
+	}
+	// a response without a message only contain headers
+	trailer := resp.Trailer
+	if trailer.Get("Grpc-Status") == "" {
+		trailer = resp.Header
+	}
+	if grpcStatus := trailer.Get("Grpc-Status"); grpcStatus != "0" {
+		return fmt.Errorf("grpc call failed with status %s: %s", grpcStatus, trailer.Get("Grpc-Message"))
+	}
+
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return errors.New("Invalid grpc response")
+	}
+	status, err := grpcHealthCheckStatus(body[5:])
+	if err != nil {
+		return err
+	}
+	if status != grpcServing {
+		name, ok := grpcStatusNames[status]
+		if !ok {
+			name = strconv.FormatUint(status, 10)
+		}
+		return fmt.Errorf("Service is %s", name)
+	}
+	return nil
+}
+
+// grpcFrame add the length prefix of an uncompressed grpc message
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// grpcHealthCheckRequest encode `HealthCheckRequest{service}`
+func grpcHealthCheckRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	message := []byte{0x0a} // field 1, length delimited
+	message = appendVarint(message, uint64(len(service)))
+	return append(message, service...)
+}
+
+// grpcHealthCheckStatus decode `status` of a `HealthCheckResponse`
+func grpcHealthCheckStatus(message []byte) (uint64, error) {
+	var status uint64
+	for len(message) != 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("Invalid grpc health check response")
+		}
+		message = message[n:]
+
+		switch tag & 7 {
+		case 0: // varint
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, errors.New("Invalid grpc health check response")
+			}
+			message = message[n:]
+			if tag>>3 == 1 {
+				status = value
+			}
+		case 1: // 64 bit
+			if len(message) < 8 {
+				return 0, errors.New("Invalid grpc health check response")
+			}
+			message = message[8:]
+		case 2: // length delimited
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return 0, errors.New("Invalid grpc health check response")
+			}
+			message = message[n+int(length):]
+		case 5: // 32 bit
+			if len(message) < 4 {
+				return 0, errors.New("Invalid grpc health check response")
+			}
+			message = message[4:]
+		default:
+			return 0, errors.New("Invalid grpc health check response")
+		}
+	}
+	return status, nil
+}
+
+func appendVarint(buffer []byte, value uint64) []byte {
+	var temp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(temp[:], value)
+	return append(buffer, temp[:n]...)
+}
+
+//endregion
@@ -0,0 +1,265 @@
+// Package healthcheck contain the probes that used to check health of the addresses
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+const (
+	// maxReadSize is the maximum size of the data that read from the targets to match the expectations
+	maxReadSize = 64 * 1024
+)
+
+type HealthChecker interface {
+	// Check probe the target using settings of the check, it returns nil if the target is healthy.
+	// Deadline of the context is the timeout of the check
+	Check(ctx context.Context, check *definitions.HealthCheck, target string) error
+}
+
+// Measurer is a checker that also measure the round trip time of the target
+type Measurer interface {
+	// Measure probe the target like `Check` and return the round trip time of the successful probe
+	Measure(ctx context.Context, check *definitions.HealthCheck, target string) (time.Duration, error)
+}
+
+// tlsConfig return the client TLS configuration of a check
+func tlsConfig(check *definitions.HealthCheck, host string) *tls.Config {
+	config := &tls.Config{ServerName: host}
+	if check.TLS != nil {
+		if check.TLS.ServerName != "" {
+			config.ServerName = check.TLS.ServerName
+		}
+		config.InsecureSkipVerify = check.TLS.InsecureSkipVerify
+	}
+	return config
+}
+
+// checkCertificate check expiry of the certificate of the server
+func checkCertificate(check *definitions.HealthCheck, state *tls.ConnectionState) error {
+	if check.TLS == nil || check.TLS.MinValidDays == 0 || state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	notAfter := state.PeerCertificates[0].NotAfter
+	if time.Until(notAfter) < time.Duration(check.TLS.MinValidDays)*24*time.Hour {
+		return fmt.Errorf("Certificate expire at %v, less than %d days", notAfter, check.TLS.MinValidDays)
+	}
+	return nil
+}
+
+// converse write the data that should be sent to a connection and read from it until it see the
+// expected data
+func converse(ctx context.Context, c net.Conn, check *definitions.HealthCheck) error {
+	if check.TCP == nil || (check.TCP.Send == "" && check.TCP.Expect == "") {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	if check.TCP.Send != "" {
+		_, err := c.Write([]byte(check.TCP.Send))
+		if err != nil {
+			return err
+		}
+	}
+	if check.TCP.Expect == "" {
+		return nil
+	}
+
+	expect := []byte(check.TCP.Expect)
+	var received []byte
+	buffer := make([]byte, 4096)
+	for len(received) < maxReadSize {
+		n, err := c.Read(buffer)
+		received = append(received, buffer[:n]...)
+		if bytes.Contains(received, expect) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Did not receive `%s`: %v", check.TCP.Expect, err)
+		}
+	}
+	return fmt.Errorf("Did not receive `%s`", check.TCP.Expect)
+}
+
+//region TCP HealthCheck
+type tcpHealthCheck struct{}
+
+func (this tcpHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return converse(ctx, c, check)
+}
+
+//endregion
+
+//region TLS HealthCheck
+type tlsHealthCheck struct{}
+
+func (this tlsHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	raw, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+
+	c := tls.Client(raw, tlsConfig(check, host))
+	err = c.Handshake()
+	if err != nil {
+		return err
+	}
+	state := c.ConnectionState()
+	if err = checkCertificate(check, &state); err != nil {
+		return err
+	}
+	return converse(ctx, c, check)
+}
+
+//endregion
+
+//region HTTP HealthCheck
+type httpHealthCheck struct{}
+
+func (this httpHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, value string) error {
+	settings := check.HTTP
+	if settings == nil {
+		settings = &definitions.HTTPHealthCheck{}
+	}
+
+	method := settings.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), value, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, headerValue := range settings.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = headerValue
+		} else {
+			req.Header.Set(name, headerValue)
+		}
+	}
+
+	// every check use its own transport, so TLS settings of the checks does not affect each other
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig(check, req.URL.Hostname()),
+		DisableKeepAlives: true,
+	}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !expectedStatus(settings.ExpectedStatus, resp.StatusCode) {
+		return fmt.Errorf("Unexpected status: %s", resp.Status)
+	}
+	if err = checkCertificate(check, resp.TLS); err != nil {
+		return err
+	}
+	if settings.BodyRegex != "" {
+		pattern, err := compileBodyRegex(settings.BodyRegex)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxReadSize))
+		if err != nil {
+			return err
+		}
+		if !pattern.Match(body) {
+			return errors.New("Body of the response does not match the expected regex")
+		}
+	}
+	return nil
+}
+
+// bodyRegexes cache the compiled body regexes of the checks, so a regex is compiled once and not on
+// every probe. Regexes only change with the records, so the cache remain small.
+var bodyRegexes sync.Map
+
+func compileBodyRegex(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := bodyRegexes.Load(pattern); ok {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	bodyRegexes.Store(pattern, compiled)
+	return compiled, nil
+}
+
+func expectedStatus(expected []int, status int) bool {
+	if len(expected) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range expected {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+//endregion
+
+var (
+	TCP  HealthChecker = tcpHealthCheck{}
+	TLS  HealthChecker = tlsHealthCheck{}
+	ICMP HealthChecker = icmpHealthCheck{}
+	HTTP HealthChecker = httpHealthCheck{}
+	DNS  HealthChecker = dnsHealthCheck{}
+	GRPC HealthChecker = grpcHealthCheck{}
+)
+
+// Get return the checker of a type of health check, it returns nil for unknown types
+func Get(checkType string) HealthChecker {
+	switch strings.ToLower(checkType) {
+	case definitions.HealthCheck_TCP:
+		return TCP
+	case definitions.HealthCheck_TLS:
+		return TLS
+	case definitions.HealthCheck_ICMP:
+		return ICMP
+	case definitions.HealthCheck_HTTP:
+		return HTTP
+	case definitions.HealthCheck_DNS:
+		return DNS
+	case definitions.HealthCheck_GRPC:
+		return GRPC
+	default:
+		return nil
+	}
+}
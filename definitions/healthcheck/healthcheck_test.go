@@ -0,0 +1,229 @@
+package healthcheck
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+type probeTest struct {
+	name    string
+	check   definitions.HealthCheck
+	target  string
+	healthy bool
+}
+
+func runProbeTests(t *testing.T, tests []probeTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.check.Validate(); err != nil {
+				t.Fatalf("Invalid check: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err := Get(test.check.Type).Check(ctx, &test.check, test.target)
+			if test.healthy && err != nil {
+				t.Fatalf("Expected a healthy target, got %v", err)
+			} else if !test.healthy && err == nil {
+				t.Fatal("Expected an unhealthy target")
+			}
+		})
+	}
+}
+
+// closedAddress return an address of the loopback interface that nothing listen on it
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	return listener.Addr().String()
+}
+
+// serveConversation accept the connections of a listener and answer every read with `reply`
+func serveConversation(listener net.Listener, reply string) {
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer c.Close()
+			buffer := make([]byte, 1024)
+			if _, err := c.Read(buffer); err == nil {
+				io.WriteString(c, reply)
+			}
+		}()
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			io.WriteString(w, `{"status":"ok"}`)
+		case "/vhost":
+			if r.Host != "api.example.com" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	runProbeTests(t, []probeTest{
+		{name: "Healthy", check: definitions.HealthCheck{Type: "http"}, target: server.URL + "/health", healthy: true},
+		{name: "UnexpectedStatus", check: definitions.HealthCheck{Type: "http"}, target: server.URL + "/down"},
+		{name: "ExpectedStatus", target: server.URL + "/down", healthy: true, check: definitions.HealthCheck{
+			Type: "http", HTTP: &definitions.HTTPHealthCheck{ExpectedStatus: []int{503}}}},
+		{name: "BodyMatch", target: server.URL + "/health", healthy: true, check: definitions.HealthCheck{
+			Type: "http", HTTP: &definitions.HTTPHealthCheck{BodyRegex: `"status":\s*"ok"`}}},
+		{name: "BodyMismatch", target: server.URL + "/health", check: definitions.HealthCheck{
+			Type: "http", HTTP: &definitions.HTTPHealthCheck{BodyRegex: `"status":\s*"down"`}}},
+		{name: "HostHeader", target: server.URL + "/vhost", healthy: true, check: definitions.HealthCheck{
+			Type: "http", HTTP: &definitions.HTTPHealthCheck{Headers: map[string]string{"Host": "api.example.com"}}}},
+		{name: "Refused", check: definitions.HealthCheck{Type: "http"}, target: "http://" + closedAddress(t) + "/"},
+		{name: "UntrustedCertificate", check: definitions.HealthCheck{Type: "http"}, target: tlsServer.URL},
+		{name: "InsecureSkipVerify", target: tlsServer.URL, healthy: true, check: definitions.HealthCheck{
+			Type: "http", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true}}},
+		{name: "CertificateExpireSoon", target: tlsServer.URL, check: definitions.HealthCheck{
+			Type: "http", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true, MinValidDays: 365 * 100}}},
+	})
+}
+
+func TestBodyRegexIsCached(t *testing.T) {
+	first, err := compileBodyRegex("ok$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := compileBodyRegex("ok$")
+	if first != second {
+		t.Fatal("Body regex is compiled again")
+	}
+}
+
+func TestTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go serveConversation(listener, "+PONG\r\n")
+	addr := listener.Addr().String()
+
+	runProbeTests(t, []probeTest{
+		{name: "Connect", check: definitions.HealthCheck{Type: "tcp"}, target: addr, healthy: true},
+		{name: "Refused", check: definitions.HealthCheck{Type: "tcp"}, target: closedAddress(t)},
+		{name: "Expected", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "tcp", TCP: &definitions.TCPHealthCheck{Send: "PING\r\n", Expect: "+PONG"}}},
+		{name: "Unexpected", target: addr, check: definitions.HealthCheck{
+			Type: "tcp", TCP: &definitions.TCPHealthCheck{Send: "PING\r\n", Expect: "+OK"}}},
+	})
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	runProbeTests(t, []probeTest{
+		{name: "Untrusted", check: definitions.HealthCheck{Type: "tls"}, target: addr},
+		{name: "InsecureSkipVerify", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "tls", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true}}},
+		{name: "CertificateExpireSoon", target: addr, check: definitions.HealthCheck{
+			Type: "tls", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true, MinValidDays: 365 * 100}}},
+		{name: "Conversation", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "tls", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true},
+			TCP: &definitions.TCPHealthCheck{Send: "GET / HTTP/1.0\r\n\r\n", Expect: "200 OK"}}},
+		{name: "Refused", target: closedAddress(t), check: definitions.HealthCheck{
+			Type: "tls", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true}}},
+	})
+}
+
+func TestDNS(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Name != "www.example.com." {
+			m.Rcode = dns.RcodeNameError
+		} else if r.Question[0].Qtype == dns.TypeA {
+			rr, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.10")
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	addr := conn.LocalAddr().String()
+
+	runProbeTests(t, []probeTest{
+		{name: "Answer", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "dns", DNS: &definitions.DNSHealthCheck{Name: "www.example.com", Expected: "192.0.2.10"}}},
+		{name: "WrongAnswer", target: addr, check: definitions.HealthCheck{
+			Type: "dns", DNS: &definitions.DNSHealthCheck{Name: "www.example.com", Expected: "192.0.2.11"}}},
+		{name: "ExpectedRcode", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "dns", DNS: &definitions.DNSHealthCheck{Name: "missing.example.com", ExpectedRcode: "NXDOMAIN"}}},
+		{name: "UnexpectedRcode", target: addr, check: definitions.HealthCheck{
+			Type: "dns", DNS: &definitions.DNSHealthCheck{Name: "missing.example.com"}}},
+	})
+}
+
+// grpcHealthHandler answer grpc health checks, services other than `serving` are not serving
+func grpcHealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != grpcHealthCheckPath {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	status := byte(2)
+	if len(body) == 5 || strings.HasSuffix(string(body), "serving") {
+		status = grpcServing
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.Write(grpcFrame([]byte{0x08, status}))
+	w.Header().Set("Grpc-Status", "0")
+}
+
+func TestGRPC(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(grpcHealthHandler), &http2.Server{}))
+	defer server.Close()
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(grpcHealthHandler))
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	addr := server.Listener.Addr().String()
+
+	runProbeTests(t, []probeTest{
+		{name: "Server", check: definitions.HealthCheck{Type: "grpc"}, target: addr, healthy: true},
+		{name: "Service", target: addr, healthy: true, check: definitions.HealthCheck{
+			Type: "grpc", GRPC: &definitions.GRPCHealthCheck{Service: "serving"}}},
+		{name: "NotServing", target: addr, check: definitions.HealthCheck{
+			Type: "grpc", GRPC: &definitions.GRPCHealthCheck{Service: "stopped"}}},
+		{name: "TLS", target: tlsServer.Listener.Addr().String(), healthy: true, check: definitions.HealthCheck{
+			Type: "grpc", TLS: &definitions.TLSHealthCheck{InsecureSkipVerify: true}}},
+		{name: "Refused", check: definitions.HealthCheck{Type: "grpc"}, target: closedAddress(t)},
+	})
+}
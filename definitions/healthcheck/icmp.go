@@ -0,0 +1,196 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	log "github.com/golang/glog"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+//region ICMP HealthCheck
+const (
+	icmpProtocol     = 1
+	icmpv6Protocol   = 58
+	icmpMaxRetries   = 4
+	icmpMessageData  = "HealthCheck"
+	icmpReplyMaxSize = 1500
+)
+
+// icmpSequence is the last sequence number of the echo requests, every probe use a new sequence so
+// concurrent checks of the same target does not accept replies of each other
+var icmpSequence = uint32(rand.Int31())
+
+type icmpHealthCheck struct{}
+
+// icmpConn is a connection that echo requests sent over it
+type icmpConn struct {
+	*icmp.PacketConn
+	dst        net.Addr
+	protocol   int
+	echoType   icmp.Type
+	replyType  icmp.Type
+	privileged bool
+}
+
+// listenICMP open a connection for sending echo requests to an address. Unprivileged datagram
+// sockets are preferred and raw sockets(that require CAP_NET_RAW) are only used if they are not
+// permitted.
+func listenICMP(ip net.IP) (*icmpConn, error) {
+	conn := &icmpConn{
+		protocol:  icmpProtocol,
+		echoType:  ipv4.ICMPTypeEcho,
+		replyType: ipv4.ICMPTypeEchoReply,
+	}
+	udpNetwork, rawNetwork, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if ip.To4() == nil {
+		conn.protocol = icmpv6Protocol
+		conn.echoType = ipv6.ICMPTypeEchoRequest
+		conn.replyType = ipv6.ICMPTypeEchoReply
+		udpNetwork, rawNetwork, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	c, udpErr := icmp.ListenPacket(udpNetwork, address)
+	if udpErr == nil {
+		conn.PacketConn = c
+		conn.dst = &net.UDPAddr{IP: ip}
+		return conn, nil
+	}
+
+	c, err := icmp.ListenPacket(rawNetwork, address)
+	if err != nil {
+		return nil, fmt.Errorf("Error in listening for ICMP packets: %v(%s), %v(%s)",
+			udpErr, udpNetwork, err, rawNetwork)
+	}
+	conn.PacketConn = c
+	conn.dst = &net.IPAddr{IP: ip}
+	conn.privileged = true
+	return conn, nil
+}
+
+// resolveIP return IP address of a host, that may be an IPv4 or an IPv6 address
+func resolveIP(ctx context.Context, host string) (net.IP, error) {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("No address found for `%s`", host)
+	}
+	return addresses[0].IP, nil
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
+}
+
+func (this icmpHealthCheck) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	_, err := this.Measure(ctx, check, target)
+	return err
+}
+
+// Measure send echo requests to the target until one of them answered, timeout of the check is
+// shared between the retries
+func (this icmpHealthCheck) Measure(ctx context.Context, check *definitions.HealthCheck, target string) (time.Duration, error) {
+	ip, err := resolveIP(ctx, target)
+	if err != nil {
+		return 0, fmt.Errorf("Can't resolve `%s` as ICMP address: %v", target, err)
+	}
+
+	c, err := listenICMP(ip)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(icmpMaxRetries * 10 * time.Second)
+	}
+	attemptTimeout := time.Until(deadline) / icmpMaxRetries
+
+	// kernel replace ID of the requests of the datagram sockets with their local port and only
+	// deliver replies of that ID to them, but raw sockets receive all of the replies
+	id := rand.Intn(0xffff)
+	replyBuffer := make([]byte, icmpReplyMaxSize)
+	for i := 0; i < icmpMaxRetries && ctx.Err() == nil; i++ {
+		seq := int(atomic.AddUint32(&icmpSequence, 1) & 0xffff)
+		msg := icmp.Message{
+			Type: c.echoType,
+			Code: 0,
+			Body: &icmp.Echo{
+				ID:   id,
+				Seq:  seq,
+				Data: []byte(icmpMessageData),
+			},
+		}
+		buffer, err := msg.Marshal(nil)
+		if err != nil {
+			return 0, fmt.Errorf("Error in marshaling ICMP message: %v", err)
+		}
+
+		start := time.Now()
+		_, err = c.WriteTo(buffer, c.dst)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to send ICMP echo request to `%s`: %v", target, err)
+		}
+
+		err = c.SetReadDeadline(start.Add(attemptTimeout))
+		if err != nil {
+			return 0, err
+		}
+		for {
+			n, peer, err := c.ReadFrom(replyBuffer)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return 0, fmt.Errorf("Failed to read ICMP reply from `%s`: %v", target, err)
+			}
+			rtt := time.Since(start)
+
+			reply, err := icmp.ParseMessage(c.protocol, replyBuffer[:n])
+			if err != nil {
+				log.V(2).Infof("Ignore invalid ICMP message from %v: %v", peer, err)
+				continue
+			}
+			echo, ok := reply.Body.(*icmp.Echo)
+			if reply.Type != c.replyType || !ok {
+				continue
+			}
+			if echo.Seq != seq || (c.privileged && echo.ID != id) || !addrIP(peer).Equal(ip) {
+				log.V(2).Infof("Ignore ICMP echo reply of another request from %v", peer)
+				continue
+			}
+			return rtt, nil
+		}
+	}
+
+	return 0, fmt.Errorf("No ICMP echo reply from `%s`", target)
+}
+
+//endregion
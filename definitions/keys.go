@@ -0,0 +1,164 @@
+package definitions
+
+import "strings"
+
+const (
+	// WildcardLabel is the label that used in keys instead of `*`, so we does not mess with REDIS escape chars
+	WildcardLabel = "$"
+	// ZonesKey is the key of the REDIS set that hold the zones that servers are authoritative for
+	ZonesKey = "dns-server-zones"
+	// ZoneInfoKeyPrefix is prefix of the keys that hold settings(`ZoneInfo`) of the zones
+	ZoneInfoKeyPrefix = "dns-zone-info:"
+	// LockKeyPrefix is prefix of the keys that used to lock other keys for a read-modify-write
+	LockKeyPrefix = "dns-lock:"
+	// NonTerminalKeyPrefix is prefix of the keys that mark the names that have a descendant, so empty
+	// non-terminals can be found. A marker hold an empty record, so it is read along with the records.
+	NonTerminalKeyPrefix = "dns-ent:"
+	// RecordKeysKey is the key of the REDIS set that index keys of the records, so they can be listed
+	// without scanning the whole database. Keys that are written by the older versions are indexed by
+	// `redns_cli reindex`, or once they are written again.
+	RecordKeysKey = "dns-record-keys"
+	// DescendantsKeyPrefix is prefix of the REDIS sets that hold keys of the descendants of a name,
+	// that are used to remove its non-terminal marker once it has no descendant
+	DescendantsKeyPrefix = "dns-descendants:"
+)
+
+// GetRedisKey return the key that should be used to hold records of a name in a domain. name may be `@`
+// for the domain itself or `*` for the wildcard of the domain
+func GetRedisKey(domain string, name string) string {
+	if name == "@" {
+		return domain
+	} else if name == "*" {
+		return WildcardLabel + "." + domain
+	} else {
+		return name + "." + domain
+	}
+}
+
+// GetZoneInfoKey return the key that hold settings of a zone
+func GetZoneInfoKey(zone string) string {
+	return ZoneInfoKeyPrefix + NameToRedisKey(zone)
+}
+
+// IsRecordKey return `true` if a key may hold records of a name, all other keys that used by the
+// servers contain a `:` or they are not a name with multiple labels
+func IsRecordKey(key string) bool {
+	return strings.IndexByte(key, '.') != -1 && strings.IndexByte(key, ':') == -1
+}
+
+// NameToRedisKey convert a DNS name(possibly fully qualified) to the key that hold its records
+func NameToRedisKey(name string) string {
+	key := strings.ToLower(strings.TrimSuffix(name, "."))
+	if key == "*" {
+		return WildcardLabel
+	} else if strings.HasPrefix(key, "*.") {
+		return WildcardLabel + key[1:]
+	}
+	return key
+}
+
+// RedisKeyToName convert a key to the DNS name(without the trailing dot) that it hold its records
+func RedisKeyToName(key string) string {
+	if key == WildcardLabel {
+		return "*"
+	} else if strings.HasPrefix(key, WildcardLabel+".") {
+		return "*" + key[len(WildcardLabel):]
+	}
+	return key
+}
+
+// GetNonTerminalKey return the key that mark a name(by its key) as a non-terminal
+func GetNonTerminalKey(key string) string {
+	return NonTerminalKeyPrefix + key
+}
+
+// GetAncestorKeys return keys of the ancestors of a key from the closest one to the farthest one.
+// Top level domains are never used as an ancestor.
+func GetAncestorKeys(key string) []string {
+	var result []string
+	ancestor := key
+	for {
+		i := strings.IndexByte(ancestor, '.')
+		if i == -1 {
+			break
+		}
+		ancestor = ancestor[i+1:]
+		if strings.IndexByte(ancestor, '.') == -1 {
+			break
+		}
+		result = append(result, ancestor)
+	}
+	return result
+}
+
+// GetLookupKeys return the keys that should be read to find records of a name in a zone. Keys are
+// triples of (name, wildcard of the name, non-terminal marker of the name), first triple is for the
+// name itself and it is followed by triples of its ancestors from the closest one to the zone apex,
+// so wildcards of a parent zone are never used for the names of a child zone. If `zone` is empty
+// all of the ancestors are used.
+func GetLookupKeys(name string, zone string) []string {
+	key := NameToRedisKey(name)
+	zone = NameToRedisKey(zone)
+	keys := []string{key, WildcardLabel + "." + key, GetNonTerminalKey(key)}
+	if key == zone {
+		return keys
+	}
+	for _, ancestor := range GetAncestorKeys(key) {
+		keys = append(keys, ancestor, WildcardLabel+"."+ancestor, GetNonTerminalKey(ancestor))
+		if ancestor == zone {
+			break
+		}
+	}
+	return keys
+}
+
+// SelectLookupKey select index of the key that hold records of a name, according to RFC 4592, from
+// the keys that returned by `GetLookupKeys` and existence of each of them. It returns -1 if there is
+// no key for the name, in that case `exists` indicate that name exists as an empty non-terminal.
+//
+// A wildcard is only used when its parent is the closest existing ancestor(closest encloser) of the name,
+// so wildcards never shadow names that exist, including empty non-terminals(RFC 4592 section 2.2.2).
+// Empty non-terminals are found by their marker, that writers add for every ancestor of a key.
+func SelectLookupKey(keys []string, found []bool) (index int, exists bool) {
+	if len(keys) < 3 {
+		return -1, false
+	}
+	if found[0] {
+		return 0, true
+	}
+	if found[1] || found[2] {
+		// name has a descendant, so it exists but it does not have any record
+		return -1, true
+	}
+
+	for i := 3; i+2 < len(keys); i += 3 {
+		if found[i] || found[i+1] || found[i+2] {
+			// keys[i] is the closest encloser, existence of its wildcard also means that it exists
+			if found[i+1] {
+				return i + 1, true
+			}
+			return -1, false
+		}
+	}
+
+	return -1, false
+}
+
+// GetDelegationKeys return keys of the names that may be a delegation point for a name in a zone, from
+// the closest one to the zone apex to the name itself. Zone apex is never a delegation point.
+func GetDelegationKeys(name string, zone string) []string {
+	key := NameToRedisKey(name)
+	zone = NameToRedisKey(zone)
+	if !strings.HasSuffix(key, "."+zone) {
+		return nil
+	}
+
+	labels := strings.Split(key[:len(key)-len(zone)-1], ".")
+	keys := make([]string, len(labels))
+	ancestor := zone
+	for i := len(labels) - 1; i >= 0; i-- {
+		ancestor = labels[i] + "." + ancestor
+		keys[len(labels)-1-i] = ancestor
+	}
+	return keys
+}
@@ -0,0 +1,164 @@
+package definitions
+
+import (
+	"errors"
+	"testing"
+)
+
+// lookupIn select the key of a name in a zone from a set of record keys, non-terminal markers are
+// added for ancestors of the keys like the writers do
+func lookupIn(records []string, name string, zone string) (string, bool) {
+	existing := make(map[string]bool)
+	for _, key := range records {
+		existing[key] = true
+		for _, ancestor := range GetAncestorKeys(key) {
+			existing[GetNonTerminalKey(ancestor)] = true
+		}
+	}
+
+	keys := GetLookupKeys(name, zone)
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		found[i] = existing[key]
+	}
+	index, exists := SelectLookupKey(keys, found)
+	if index == -1 {
+		return "", exists
+	}
+	return keys[index], exists
+}
+
+func TestSelectLookupKey(t *testing.T) {
+	records := []string{"example.com", "$.example.com", "x.example.com", "$.y.example.com", "c.d.example.com"}
+	cases := []struct {
+		name   string
+		key    string
+		exists bool
+	}{
+		{"example.com", "example.com", true},
+		{"x.example.com", "x.example.com", true},
+		{"Z.Example.COM.", "$.example.com", true},
+		{"a.b.example.com.", "$.example.com", true},
+		{"*.example.com", "$.example.com", true},
+		// x.example.com is the closest encloser and it has no wildcard
+		{"a.x.example.com", "", false},
+		{"q.y.example.com", "$.y.example.com", true},
+		// empty non-terminals exist and they block the wildcards of their ancestors
+		{"y.example.com", "", true},
+		{"d.example.com", "", true},
+		{"z.d.example.com", "", false},
+	}
+	for _, c := range cases {
+		key, exists := lookupIn(records, c.name, "example.com")
+		if key != c.key || exists != c.exists {
+			t.Errorf("%s: got (%q, %v), expected (%q, %v)", c.name, key, exists, c.key, c.exists)
+		}
+	}
+}
+
+func TestSelectLookupKeyStopAtZoneApex(t *testing.T) {
+	records := []string{"example.com", "$.example.com", "www.example.com"}
+	// child.example.com is a zone without any record, so it has no non-terminal marker
+	if key, exists := lookupIn(records, "x.child.example.com", "child.example.com"); key != "" || exists {
+		t.Errorf("Child zone is answered from the parent zone: (%q, %v)", key, exists)
+	}
+	if key, exists := lookupIn(records, "x.child.example.com", "example.com"); key != "$.example.com" || !exists {
+		t.Errorf("Expected wildcard of the zone, got (%q, %v)", key, exists)
+	}
+	if key, exists := lookupIn(records, "Example.com.", "example.com"); key != "example.com" || !exists {
+		t.Errorf("Expected zone apex, got (%q, %v)", key, exists)
+	}
+}
+
+// memoryNonTerminalStore is a NonTerminalStore and a LockStore that keep the keys in memory
+type memoryNonTerminalStore struct {
+	values map[string][]byte
+	sets   map[string]map[string]bool
+}
+
+func newMemoryStore() *memoryNonTerminalStore {
+	return &memoryNonTerminalStore{values: make(map[string][]byte), sets: make(map[string]map[string]bool)}
+}
+func (this *memoryNonTerminalStore) Get(key string) ([]byte, error) {
+	value, ok := this.values[key]
+	if !ok {
+		return nil, errors.New("Nonexistent key")
+	}
+	return value, nil
+}
+func (this *memoryNonTerminalStore) Setnx(key string, val []byte) (bool, error) {
+	if _, ok := this.values[key]; ok {
+		return false, nil
+	}
+	this.values[key] = val
+	return true, nil
+}
+func (this *memoryNonTerminalStore) Getset(key string, val []byte) ([]byte, error) {
+	old := this.values[key]
+	this.values[key] = val
+	return old, nil
+}
+
+func (this *memoryNonTerminalStore) Set(key string, val []byte) error {
+	this.values[key] = val
+	return nil
+}
+func (this *memoryNonTerminalStore) Del(key string) (bool, error) {
+	_, ok := this.values[key]
+	delete(this.values, key)
+	return ok, nil
+}
+func (this *memoryNonTerminalStore) Sadd(key string, value []byte) (bool, error) {
+	if this.sets[key] == nil {
+		this.sets[key] = make(map[string]bool)
+	}
+	added := !this.sets[key][string(value)]
+	this.sets[key][string(value)] = true
+	return added, nil
+}
+func (this *memoryNonTerminalStore) Srem(key string, value []byte) (bool, error) {
+	removed := this.sets[key][string(value)]
+	delete(this.sets[key], string(value))
+	return removed, nil
+}
+func (this *memoryNonTerminalStore) Scard(key string) (int, error) {
+	return len(this.sets[key]), nil
+}
+
+func TestNonTerminals(t *testing.T) {
+	store := newMemoryStore()
+	for _, key := range []string{"a.b.example.com", "c.b.example.com"} {
+		if err := AddNonTerminals(store, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ancestor := range []string{"b.example.com", "example.com"} {
+		if store.values[GetNonTerminalKey(ancestor)] == nil {
+			t.Fatalf("%s is not marked", ancestor)
+		}
+	}
+	if _, ok := store.values[GetNonTerminalKey("com")]; ok {
+		t.Fatal("Top level domain is marked")
+	}
+
+	RemoveNonTerminals(store, "a.b.example.com")
+	if store.values[GetNonTerminalKey("b.example.com")] == nil {
+		t.Fatal("Marker is removed while the name has a descendant")
+	}
+	RemoveNonTerminals(store, "c.b.example.com")
+	if len(store.values) != 0 {
+		t.Fatalf("Markers are not removed: %v", store.values)
+	}
+}
+
+func TestRecordKeys(t *testing.T) {
+	store := newMemoryStore()
+	AddRecordKey(store, "www.example.com")
+	if !store.sets[RecordKeysKey]["www.example.com"] || store.values[GetNonTerminalKey("example.com")] == nil {
+		t.Fatal("Key is not indexed or its ancestor is not marked")
+	}
+	RemoveRecordKey(store, "www.example.com")
+	if len(store.sets[RecordKeysKey]) != 0 || len(store.values) != 0 {
+		t.Fatal("Key is not removed from the index")
+	}
+}
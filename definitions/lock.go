@@ -0,0 +1,94 @@
+package definitions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// LockTimeout is the time that a lock is held before other writers may take it over
+	LockTimeout     = 10 * time.Second
+	lockRetries     = 50
+	lockRetryDelay  = 100 * time.Millisecond
+	lockTokenLength = 8
+)
+
+// LockStore is the part of a REDIS client that is used to lock the keys
+type LockStore interface {
+	Get(key string) ([]byte, error)
+	Setnx(key string, val []byte) (bool, error)
+	Getset(key string, val []byte) ([]byte, error)
+	Del(key string) (bool, error)
+}
+
+// KeyLock is the lock of a key for a read-modify-write. Every writer of the records(servers, the
+// controller and the CLI) must hold it while it update a record.
+type KeyLock struct {
+	store LockStore
+	key   string
+	value []byte
+}
+
+// LockKey acquire the lock of a key, the lock expire after `timeout` so a crashed owner can't hold it
+// forever(see the SETNX locking algorithm in REDIS documentation). Value of the lock is its expire
+// time and a random token of the owner, so an owner never release a lock that is taken over.
+func LockKey(store LockStore, key string, timeout time.Duration) (*KeyLock, error) {
+	token := make([]byte, lockTokenLength)
+	_, err := rand.Read(token)
+	if err != nil {
+		return nil, err
+	}
+
+	lockKey := LockKeyPrefix + key
+	for i := 0; i < lockRetries; i++ {
+		value := []byte(strconv.FormatInt(time.Now().Add(timeout).UnixNano(), 10) + ":" + hex.EncodeToString(token))
+		ok, err := store.Setnx(lockKey, value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &KeyLock{store: store, key: lockKey, value: value}, nil
+		}
+
+		// take over the lock if its owner did not release it in time
+		current, err := store.Get(lockKey)
+		if err == nil && isLockExpired(current) {
+			old, err := store.Getset(lockKey, value)
+			if err != nil {
+				return nil, err
+			}
+			if isLockExpired(old) {
+				return &KeyLock{store: store, key: lockKey, value: value}, nil
+			}
+		}
+		time.Sleep(lockRetryDelay)
+	}
+	return nil, fmt.Errorf("Failed to lock %s", key)
+}
+
+// Unlock release the lock, if it is not taken over by another writer. REDIS client does not support
+// scripts, so the lock may still be taken over between the check and the removal, that only happen
+// if the owner held the lock for the whole timeout.
+func (this *KeyLock) Unlock() error {
+	current, err := this.store.Get(this.key)
+	if err != nil || !bytes.Equal(current, this.value) {
+		// lock expired or taken over
+		return nil
+	}
+	_, err = this.store.Del(this.key)
+	return err
+}
+
+// isLockExpired check expire time of a lock value, values of the older versions only contain the
+// expire time
+func isLockExpired(value []byte) bool {
+	if i := bytes.IndexByte(value, ':'); i != -1 {
+		value = value[:i]
+	}
+	expires, err := strconv.ParseInt(string(value), 10, 64)
+	return err != nil || time.Now().UnixNano() > expires
+}
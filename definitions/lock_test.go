@@ -0,0 +1,49 @@
+package definitions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	store := newMemoryStore()
+	lock, err := LockKey(store, "www.example.com", LockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	if _, ok := store.values[LockKeyPrefix+"www.example.com"]; ok {
+		t.Fatal("Lock is not released")
+	}
+}
+
+func TestLockTakeOver(t *testing.T) {
+	store := newMemoryStore()
+	expired, err := LockKey(store, "www.example.com", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := LockKey(store, "www.example.com", LockTimeout)
+	if err != nil {
+		t.Fatalf("Expired lock is not taken over: %v", err)
+	}
+
+	// the expired owner must not release the lock of the new owner
+	expired.Unlock()
+	if string(store.values[LockKeyPrefix+"www.example.com"]) != string(owner.value) {
+		t.Fatal("Lock of the new owner is released by the expired owner")
+	}
+	owner.Unlock()
+	if _, ok := store.values[LockKeyPrefix+"www.example.com"]; ok {
+		t.Fatal("Lock is not released")
+	}
+}
+
+func TestLockOfOlderVersions(t *testing.T) {
+	if isLockExpired([]byte("9000000000000000000")) {
+		t.Fatal("Lock value without a token is expired")
+	}
+	if !isLockExpired([]byte("1:abcd")) {
+		t.Fatal("Expired lock is not expired")
+	}
+}
@@ -0,0 +1,84 @@
+package definitions
+
+// NonTerminalStore is the part of a REDIS client that is used to maintain the non-terminal markers
+type NonTerminalStore interface {
+	Set(key string, val []byte) error
+	Del(key string) (bool, error)
+	Sadd(key string, value []byte) (bool, error)
+	Srem(key string, value []byte) (bool, error)
+	Scard(key string) (int, error)
+}
+
+// nonTerminalMarker is the value of the non-terminal markers, an empty record
+var nonTerminalMarker = []byte("{}")
+
+// AddNonTerminals mark ancestors of a key as non-terminals, it should be called whenever a key is
+// written. It is cheap for the keys that are already marked.
+func AddNonTerminals(store NonTerminalStore, key string) error {
+	for _, ancestor := range GetAncestorKeys(key) {
+		added, err := store.Sadd(DescendantsKeyPrefix+ancestor, []byte(key))
+		if err != nil {
+			return err
+		}
+		if !added {
+			continue
+		}
+		err = store.Set(GetNonTerminalKey(ancestor), nonTerminalMarker)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveNonTerminals remove a key from the descendants of its ancestors and remove the marker of the
+// ancestors that have no other descendant, it should be called whenever a key is removed
+func RemoveNonTerminals(store NonTerminalStore, key string) error {
+	for _, ancestor := range GetAncestorKeys(key) {
+		descendantsKey := DescendantsKeyPrefix + ancestor
+		_, err := store.Srem(descendantsKey, []byte(key))
+		if err != nil {
+			return err
+		}
+		count, err := store.Scard(descendantsKey)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			continue
+		}
+		_, err = store.Del(GetNonTerminalKey(ancestor))
+		if err != nil {
+			return err
+		}
+		// a descendant that is added meanwhile may have written the marker before we removed it
+		count, err = store.Scard(descendantsKey)
+		if err == nil && count != 0 {
+			err = store.Set(GetNonTerminalKey(ancestor), nonTerminalMarker)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddRecordKey add a key to the index of the record keys and mark its ancestors as non-terminals, it
+// should be called whenever a record is written
+func AddRecordKey(store NonTerminalStore, key string) error {
+	_, err := store.Sadd(RecordKeysKey, []byte(key))
+	if err != nil {
+		return err
+	}
+	return AddNonTerminals(store, key)
+}
+
+// RemoveRecordKey remove a key from the index of the record keys and remove the markers that are
+// only needed by the key, it should be called whenever a record is removed
+func RemoveRecordKey(store NonTerminalStore, key string) error {
+	_, err := store.Srem(RecordKeysKey, []byte(key))
+	if err != nil {
+		return err
+	}
+	return RemoveNonTerminals(store, key)
+}
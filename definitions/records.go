@@ -1,6 +1,12 @@
 package definitions
 
-import "github.com/miekg/dns"
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
 
 const (
 	Kind_A     = "A"
@@ -12,8 +18,60 @@ const (
 	Kind_SRV   = "SRV"
 )
 
+const (
+	// Strategy_All return all active addresses of the record
+	Strategy_All = "all"
+	// Strategy_Weighted return one random address, selected by weight
+	Strategy_Weighted = "weighted"
+	// Strategy_RoundRobin return all active addresses, rotated on each query
+	Strategy_RoundRobin = "round-robin"
+	// Strategy_TopN return `TopN` active addresses that have the highest weight
+	Strategy_TopN = "top-n"
+	// Strategy_ClientHash return one address, selected by consistent hashing of the client IP
+	Strategy_ClientHash = "client-hash"
+	// Strategy_Failover return active addresses of the lowest tier that has any active address
+	Strategy_Failover = "failover"
+)
+
+var (
+	Strategies = []string{
+		Strategy_All,
+		Strategy_Weighted,
+		Strategy_RoundRobin,
+		Strategy_TopN,
+		Strategy_ClientHash,
+		Strategy_Failover,
+	}
+)
+
+// IsValidStrategy check if a value is a known load balancing strategy
+func IsValidStrategy(strategy string) bool {
+	for _, s := range Strategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveStrategy get the strategy of a record, records that written before strategies was introduced
+// only have the `Weighted` flag
+func resolveStrategy(strategy string, weighted bool) string {
+	if strategy != "" {
+		return strategy
+	} else if weighted {
+		return Strategy_Weighted
+	} else {
+		return Strategy_All
+	}
+}
+
 type IDNSAddressRecord interface {
 	IsWeighted() bool
+	// GetStrategy get load balancing strategy of this record
+	GetStrategy() string
+	// GetTopN get number of addresses that should returned in `Strategy_TopN`
+	GetTopN() uint16
 	GetItemKind() string
 	Length() int
 	IsEmpty() bool
@@ -25,6 +83,8 @@ type IDNSAddressRecord interface {
 //region DNS_A_Record
 type DNS_A_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_A_Address
 }
 
@@ -36,6 +96,20 @@ func (this *DNS_A_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_A_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_A_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_A_Record) Length() int {
 	if this == nil {
 		return 0
@@ -59,12 +133,12 @@ func (this *DNS_A_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_A_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_A_Record{Weighted: this.Weighted}
+		return &DNS_A_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_A_Record{Weighted: this.Weighted}
+		return &DNS_A_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_A_Address, 0, length)
@@ -73,7 +147,7 @@ func (this *DNS_A_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_A_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_A_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_A_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -97,6 +171,8 @@ func (this *DNS_A_Record) ToRRList(name string) []dns.RR {
 //region DNS_AAAA_Record
 type DNS_AAAA_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_AAAA_Address
 }
 
@@ -108,6 +184,20 @@ func (this *DNS_AAAA_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_AAAA_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_AAAA_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_AAAA_Record) Length() int {
 	if this == nil {
 		return 0
@@ -131,12 +221,12 @@ func (this *DNS_AAAA_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_AAAA_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_AAAA_Record{Weighted: this.Weighted}
+		return &DNS_AAAA_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_AAAA_Record{Weighted: this.Weighted}
+		return &DNS_AAAA_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_AAAA_Address, 0, length)
@@ -145,7 +235,7 @@ func (this *DNS_AAAA_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_AAAA_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_AAAA_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_AAAA_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -169,6 +259,8 @@ func (this *DNS_AAAA_Record) ToRRList(name string) []dns.RR {
 //region DNS_NS_Record
 type DNS_NS_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_NS_Address
 }
 
@@ -180,6 +272,20 @@ func (this *DNS_NS_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_NS_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_NS_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_NS_Record) Length() int {
 	if this == nil {
 		return 0
@@ -203,12 +309,12 @@ func (this *DNS_NS_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_NS_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_NS_Record{Weighted: this.Weighted}
+		return &DNS_NS_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_NS_Record{Weighted: this.Weighted}
+		return &DNS_NS_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_NS_Address, 0, length)
@@ -217,7 +323,7 @@ func (this *DNS_NS_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_NS_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_NS_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_NS_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -241,6 +347,8 @@ func (this *DNS_NS_Record) ToRRList(name string) []dns.RR {
 //region DNS_TXT_Record
 type DNS_TXT_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_TXT_Address
 }
 
@@ -252,6 +360,20 @@ func (this *DNS_TXT_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_TXT_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_TXT_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_TXT_Record) Length() int {
 	if this == nil {
 		return 0
@@ -275,12 +397,12 @@ func (this *DNS_TXT_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_TXT_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_TXT_Record{Weighted: this.Weighted}
+		return &DNS_TXT_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_TXT_Record{Weighted: this.Weighted}
+		return &DNS_TXT_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_TXT_Address, 0, length)
@@ -289,7 +411,7 @@ func (this *DNS_TXT_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_TXT_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_TXT_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_TXT_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -313,6 +435,8 @@ func (this *DNS_TXT_Record) ToRRList(name string) []dns.RR {
 //region DNS_CNAME_Record
 type DNS_CNAME_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_CNAME_Address
 }
 
@@ -324,6 +448,20 @@ func (this *DNS_CNAME_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_CNAME_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_CNAME_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_CNAME_Record) Length() int {
 	if this == nil {
 		return 0
@@ -347,12 +485,12 @@ func (this *DNS_CNAME_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_CNAME_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_CNAME_Record{Weighted: this.Weighted}
+		return &DNS_CNAME_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_CNAME_Record{Weighted: this.Weighted}
+		return &DNS_CNAME_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_CNAME_Address, 0, length)
@@ -361,7 +499,7 @@ func (this *DNS_CNAME_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_CNAME_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_CNAME_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_CNAME_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -385,6 +523,8 @@ func (this *DNS_CNAME_Record) ToRRList(name string) []dns.RR {
 //region DNS_MX_Record
 type DNS_MX_Record struct {
 	Weighted  bool
+	Strategy  string `json:",omitempty"`
+	TopN      uint16 `json:",omitempty"`
 	Addresses []DNS_MX_Address
 }
 
@@ -396,6 +536,20 @@ func (this *DNS_MX_Record) IsWeighted() bool {
 		return this.Weighted
 	}
 }
+func (this *DNS_MX_Record) GetStrategy() string {
+	if this == nil {
+		return Strategy_All
+	} else {
+		return resolveStrategy(this.Strategy, this.Weighted)
+	}
+}
+func (this *DNS_MX_Record) GetTopN() uint16 {
+	if this == nil {
+		return 0
+	} else {
+		return this.TopN
+	}
+}
 func (this *DNS_MX_Record) Length() int {
 	if this == nil {
 		return 0
@@ -419,12 +573,12 @@ func (this *DNS_MX_Record) AddressList() []IDNSAddress {
 }
 func (this *DNS_MX_Record) LimitToActive() IDNSAddressRecord {
 	if this == nil {
-		return &DNS_MX_Record{Weighted: this.Weighted}
+		return &DNS_MX_Record{}
 	}
 
 	length := len(this.Addresses)
 	if length == 0 {
-		return &DNS_MX_Record{Weighted: this.Weighted}
+		return &DNS_MX_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN}
 	}
 
 	addresses := make([]DNS_MX_Address, 0, length)
@@ -433,7 +587,7 @@ func (this *DNS_MX_Record) LimitToActive() IDNSAddressRecord {
 			addresses = append(addresses, this.Addresses[i])
 		}
 	}
-	return &DNS_MX_Record{Weighted: this.Weighted, Addresses: addresses}
+	return &DNS_MX_Record{Weighted: this.Weighted, Strategy: this.Strategy, TopN: this.TopN, Addresses: addresses}
 }
 func (this *DNS_MX_Record) ToRRList(name string) []dns.RR {
 	if this == nil {
@@ -459,6 +613,8 @@ type DNS_SRV_Record []DNS_SRV_Address
 
 func (this DNS_SRV_Record) GetItemKind() string { return Kind_SRV }
 func (this DNS_SRV_Record) IsWeighted() bool    { return false }
+func (this DNS_SRV_Record) GetStrategy() string { return Strategy_All }
+func (this DNS_SRV_Record) GetTopN() uint16     { return 0 }
 func (this DNS_SRV_Record) Length() int         { return len(this) }
 func (this DNS_SRV_Record) IsEmpty() bool       { return len(this) == 0 }
 func (this DNS_SRV_Record) AddressList() []IDNSAddress {
@@ -538,3 +694,125 @@ func (this *DNSRecord) GetAddresses() []IDNSAddress {
 		return result
 	}
 }
+
+// FindAddress find the address of the record that have the kind and the value, it returns nil if
+// there is no such address
+func (this *DNSRecord) FindAddress(kind, value string) IDNSAddress {
+	for _, address := range this.GetAddresses() {
+		if address.GetKind() == kind && address.GetValue() == value {
+			return address
+		}
+	}
+	return nil
+}
+
+// AddAddress add an address of a kind to the record. Value of SRV addresses is in `target:port` format
+// and `priority` is only used by MX and SRV addresses
+func (this *DNSRecord) AddAddress(kind, value string, base DNS_Address, priority uint16) error {
+	switch kind {
+	case Kind_A:
+		if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("Invalid IPv4 address `%s`", value)
+		}
+		if this.ARecords == nil {
+			this.ARecords = &DNS_A_Record{}
+		}
+		this.ARecords.Addresses = append(this.ARecords.Addresses,
+			DNS_A_Address{DNS_IP_Address{DNS_Address: base, IP: value}})
+	case Kind_AAAA:
+		if ip := net.ParseIP(value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("Invalid IPv6 address `%s`", value)
+		}
+		if this.AAAARecords == nil {
+			this.AAAARecords = &DNS_AAAA_Record{}
+		}
+		this.AAAARecords.Addresses = append(this.AAAARecords.Addresses,
+			DNS_AAAA_Address{DNS_IP_Address{DNS_Address: base, IP: value}})
+	case Kind_NS:
+		if this.NSRecords == nil {
+			this.NSRecords = &DNS_NS_Record{}
+		}
+		this.NSRecords.Addresses = append(this.NSRecords.Addresses,
+			DNS_NS_Address{DNS_STR_Address{DNS_Address: base, Value: value}})
+	case Kind_TXT:
+		if this.TXTRecords == nil {
+			this.TXTRecords = &DNS_TXT_Record{}
+		}
+		this.TXTRecords.Addresses = append(this.TXTRecords.Addresses,
+			DNS_TXT_Address{DNS_STR_Address{DNS_Address: base, Value: value}})
+	case Kind_CNAME:
+		if this.CNameRecords == nil {
+			this.CNameRecords = &DNS_CNAME_Record{}
+		}
+		this.CNameRecords.Addresses = append(this.CNameRecords.Addresses,
+			DNS_CNAME_Address{DNS_STR_Address{DNS_Address: base, Value: value}})
+	case Kind_MX:
+		if this.MXRecords == nil {
+			this.MXRecords = &DNS_MX_Record{}
+		}
+		this.MXRecords.Addresses = append(this.MXRecords.Addresses,
+			DNS_MX_Address{DNS_Address: base, Value: value, Priority: priority})
+	case Kind_SRV:
+		target, portValue, err := net.SplitHostPort(value)
+		if err != nil {
+			return fmt.Errorf("Invalid SRV value `%s`, it must be in `target:port` format", value)
+		}
+		port, err := strconv.ParseUint(portValue, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("Invalid port in SRV value `%s`", value)
+		}
+		this.SRVRecords = append(this.SRVRecords,
+			DNS_SRV_Address{DNS_Address: base, Value: target, Port: uint16(port), Priority: priority})
+	default:
+		return fmt.Errorf("Invalid kind `%s`", kind)
+	}
+	return nil
+}
+
+// SupportsStrategy check if the addresses of a kind may have a load balancing strategy, SRV records
+// are balanced by their own priority and weight
+func SupportsStrategy(kind string) bool {
+	switch kind {
+	case Kind_A, Kind_AAAA, Kind_NS, Kind_TXT, Kind_CNAME, Kind_MX:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetStrategy set load balancing strategy of the addresses of a kind, it fails for the kinds that
+// does not support strategies(see `SupportsStrategy`)
+func (this *DNSRecord) SetStrategy(kind, strategy string, topN uint16) error {
+	if !SupportsStrategy(kind) {
+		return fmt.Errorf("Load balancing strategy is not supported by %s records", kind)
+	}
+	// keep `Weighted` in sync, so servers that does not know about strategies still work
+	weighted := strategy == Strategy_Weighted
+	switch kind {
+	case Kind_A:
+		if this.ARecords != nil {
+			this.ARecords.Weighted, this.ARecords.Strategy, this.ARecords.TopN = weighted, strategy, topN
+		}
+	case Kind_AAAA:
+		if this.AAAARecords != nil {
+			this.AAAARecords.Weighted, this.AAAARecords.Strategy, this.AAAARecords.TopN = weighted, strategy, topN
+		}
+	case Kind_NS:
+		if this.NSRecords != nil {
+			this.NSRecords.Weighted, this.NSRecords.Strategy, this.NSRecords.TopN = weighted, strategy, topN
+		}
+	case Kind_TXT:
+		if this.TXTRecords != nil {
+			this.TXTRecords.Weighted, this.TXTRecords.Strategy, this.TXTRecords.TopN = weighted, strategy, topN
+		}
+	case Kind_CNAME:
+		if this.CNameRecords != nil {
+			this.CNameRecords.Weighted, this.CNameRecords.Strategy, this.CNameRecords.TopN = weighted, strategy, topN
+		}
+	case Kind_MX:
+		if this.MXRecords != nil {
+			this.MXRecords.Weighted, this.MXRecords.Strategy, this.MXRecords.TopN = weighted, strategy, topN
+		}
+	}
+	return nil
+}
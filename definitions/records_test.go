@@ -0,0 +1,23 @@
+package definitions
+
+import "testing"
+
+func TestSetStrategy(t *testing.T) {
+	record := &DNSRecord{}
+	if err := record.AddAddress(Kind_A, "192.0.2.1", DNS_Address{Enabled: true, Healthy: true}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := record.AddAddress(Kind_SRV, "sip.example.com:5060", DNS_Address{Enabled: true, Healthy: true}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := record.SetStrategy(Kind_A, Strategy_TopN, 2); err != nil {
+		t.Fatalf("Unexpected error for A records: %v", err)
+	}
+	if record.ARecords.GetStrategy() != Strategy_TopN || record.ARecords.GetTopN() != 2 {
+		t.Fatalf("Strategy of A records is not set: %+v", record.ARecords)
+	}
+	if err := record.SetStrategy(Kind_SRV, Strategy_Weighted, 0); err == nil {
+		t.Fatal("Expected an error for SRV records")
+	}
+}
@@ -0,0 +1,60 @@
+package definitions
+
+import "strings"
+
+// ZoneInfo is settings of a zone(zone metadata) that servers use to serve it. It is stored as JSON in
+// the key that returned by `GetZoneInfoKey`, servers are only authoritative for the zones that have it.
+type ZoneInfo struct {
+	// Nameserver is the primary nameserver of the zone
+	Nameserver string `json:"nameserver,omitempty"`
+	// Nameservers are the authoritative nameservers of the zone, they are served as NS records of the
+	// zone apex if it has no NS record
+	Nameservers []string `json:"nameservers,omitempty"`
+	// Mailbox is the mailbox of the person responsible for the zone, in DNS name format
+	Mailbox string `json:"mailbox,omitempty"`
+	// Refresh, Retry and Expire are the timers of the SOA record in seconds, 0 use the server defaults
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	// DefaultTTL is TTL of the records that have no TTL, 0 use the server default
+	DefaultTTL uint32 `json:"defaultTTL,omitempty"`
+	// MinTTL and MaxTTL limit TTL of the records of the zone, 0 use the server defaults
+	MinTTL uint32 `json:"minTTL,omitempty"`
+	MaxTTL uint32 `json:"maxTTL,omitempty"`
+	// NegativeTTL is TTL of the negative answers of the zone, 0 use the server default
+	NegativeTTL uint32 `json:"negativeTTL,omitempty"`
+	// AllowedTypes are the types of the records(A, AAAA, ...) that are served in the zone, empty allow
+	// all of the types
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// TransferACL is the networks(CIDR) that may transfer the zone. It is only stored for the tools
+	// that set up secondaries of the zone, servers do not support zone transfers and ignore it.
+	TransferACL []string `json:"transferACL,omitempty"`
+	// DNSSEC is `true` if the zone should be signed. It is only stored for the tools that sign the
+	// zone, servers do not sign the answers and ignore it.
+	DNSSEC bool `json:"dnssec,omitempty"`
+}
+
+// PrimaryNameserver return the primary nameserver of the zone, that is `Nameserver` or the first of
+// `Nameservers` if it is empty
+func (this *ZoneInfo) PrimaryNameserver() string {
+	if this == nil {
+		return ""
+	}
+	if this.Nameserver == "" && len(this.Nameservers) != 0 {
+		return this.Nameservers[0]
+	}
+	return this.Nameserver
+}
+
+// AllowsType return `true` if records of a type may be served in the zone, SOA is always allowed
+func (this *ZoneInfo) AllowsType(kind string) bool {
+	if this == nil || len(this.AllowedTypes) == 0 || kind == "SOA" {
+		return true
+	}
+	for _, allowed := range this.AllowedTypes {
+		if strings.EqualFold(allowed, kind) {
+			return true
+		}
+	}
+	return false
+}
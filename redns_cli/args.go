@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/devops-simba/redns/definitions"
 	"github.com/hoisie/redis"
@@ -24,6 +26,15 @@ type CommandArgs struct {
 	Priority Word
 	Enabled  Bool3
 	Healthy  Bool3
+	Tier     Word
+
+	Strategy Strategy
+	TopN     Word
+
+	HealthCheck HealthCheckValue
+
+	Nameserver string
+	Mailbox    string
 }
 
 func NewCommandArgs() CommandArgs {
@@ -33,6 +44,8 @@ func NewCommandArgs() CommandArgs {
 		Priority: InvalidWord,
 		Enabled:  None,
 		Healthy:  None,
+		Tier:     InvalidWord,
+		TopN:     InvalidWord,
 	}
 }
 
@@ -54,6 +67,16 @@ func (this *CommandArgs) BindFlags(flagset *flag.FlagSet) {
 	flagset.Var(&this.Healthy, "healthy", "Is this address healthy?")
 	flagset.Var(&this.Priority, "priority",
 		"For addresses that support this, it is priority of the address")
+	flagset.Var(&this.Tier, "tier",
+		"Tier of the address, this will be used in failover mode and lower tiers are preferred")
+	flagset.Var(&this.Strategy, "strategy",
+		"Load balancing strategy of the record. Available strategies are: "+strings.Join(definitions.Strategies, ","))
+	flagset.Var(&this.TopN, "topn", "Number of addresses that should returned by the `top-n` strategy")
+	flagset.Var(&this.HealthCheck, "health-check",
+		"Health check of the address in JSON format, for example {\"type\":\"http\",\"target\":\"http://192.0.2.10:8080/healthz\",\"http\":{\"expectedStatus\":[200]}}. "+
+			"Without a target the value is checked on the default port of the check(http://value/ for http). `none` remove the health check")
+	flagset.StringVar(&this.Nameserver, "nameserver", "", "Primary nameserver of the zone, that is used in its SOA record")
+	flagset.StringVar(&this.Mailbox, "mailbox", "", "Mailbox of the person responsible for the zone, in DNS name format")
 }
 
 // ReadRecordByKey Read a record using its key
@@ -91,20 +114,62 @@ func (this CommandArgs) ReadRecord(domain string, name string) (*DNSRecordWithKe
 	return &DNSRecordWithKey{Key: key, DNSRecord: *rec}, nil
 }
 
-// WriteRecordByKey Write content of the record to Redis server
+// WriteRecordByKey Write content of the record to Redis server, the key should be locked
 func (this CommandArgs) WriteRecordByKey(rec *definitions.DNSRecord, key string) error {
 	content, err := json.Marshal(rec)
 	if err != nil {
 		return err
 	}
 
-	return this.Redis.Set(key, content)
+	err = this.Redis.Set(key, content)
+	if err != nil {
+		return err
+	}
+	return definitions.AddRecordKey(&this.Redis, key)
 }
 
-//
-func (this CommandArgs) WriteRecord(rec *definitions.DNSRecord, domain string, name string) error {
-	key := GetRedisKey(domain, name)
-	return this.WriteRecordByKey(rec, key)
+// UpdateRecordByKey lock a key and replace its record with the result of `update`, a nil result
+// remove the key. The lock is the same lock that servers and the controller use to update the
+// records, so their updates are not lost. It returns `false` if the record did not change.
+func (this CommandArgs) UpdateRecordByKey(
+	key string,
+	update func(current *definitions.DNSRecord) (*definitions.DNSRecord, error)) (bool, error) {
+	lock, err := definitions.LockKey(&this.Redis, key, definitions.LockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Unlock()
+
+	current, err := this.ReadRecordByKey(key)
+	if err != nil {
+		return false, err
+	}
+	var currentContent []byte
+	if current != nil {
+		// update may change the current record
+		currentContent, _ = json.Marshal(current)
+	}
+
+	rec, err := update(current)
+	if err != nil {
+		return false, err
+	}
+	if rec == nil {
+		if current == nil {
+			return false, nil
+		}
+		_, err = this.Redis.Del(key)
+		if err != nil {
+			return false, err
+		}
+		return true, definitions.RemoveRecordKey(&this.Redis, key)
+	}
+
+	content, err := json.Marshal(rec)
+	if err == nil && bytes.Equal(content, currentContent) {
+		return false, nil
+	}
+	return true, this.WriteRecordByKey(rec, key)
 }
 
 // GetRecordKeyAndSelector get the key that we must pass to redis to select keys that match the parameters
@@ -169,15 +234,14 @@ func (this CommandArgs) FindRecords(context DisplayContext) ([]DNSRecordWithKey,
 		if err != nil {
 			return nil, err
 		}
-		if keySelector != nil {
-			selected_keys := make([]string, 0, len(keys))
-			for _, key := range keys {
-				if keySelector.MatchString(key) {
-					selected_keys = append(selected_keys, key)
-				}
+		// the pattern may also match the other keys of the servers, like the non-terminal markers
+		selected_keys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if definitions.IsRecordKey(key) && (keySelector == nil || keySelector.MatchString(key)) {
+				selected_keys = append(selected_keys, key)
 			}
-			keys = selected_keys
 		}
+		keys = selected_keys
 	} else {
 		keys = []string{pattern}
 	}
@@ -226,13 +290,25 @@ func (this CommandArgs) NewDnsAddress() definitions.DNS_Address {
 }
 func (this CommandArgs) UpdatedDnsAddress(src *definitions.DNS_Address) definitions.DNS_Address {
 	return definitions.DNS_Address{
-		TTL:     this.TTL.ValueOr(src.TTL),
-		Weight:  this.Weight.ValueOr(src.Weight),
-		Enabled: this.Enabled.BoolOr(src.Enabled),
-		Healthy: this.Enabled.BoolOr(src.Healthy),
+		TTL:         this.TTL.ValueOr(src.TTL),
+		Weight:      this.Weight.ValueOr(src.Weight),
+		Enabled:     this.Enabled.BoolOr(src.Enabled),
+		Healthy:     this.Enabled.BoolOr(src.Healthy),
+		Tier:        this.Tier.ValueOr(src.Tier),
+		HealthCheck: this.HealthCheck.CheckOr(src.HealthCheck),
 	}
 }
 
+// UpdatedStrategy return load balancing properties of a record after applying the arguments
+func (this CommandArgs) UpdatedStrategy(weighted bool, strategy string, topN uint16) (bool, string, uint16) {
+	if this.Strategy != "" {
+		strategy = string(this.Strategy)
+		// keep `Weighted` in sync, so servers that does not know about strategies still work
+		weighted = strategy == definitions.Strategy_Weighted
+	}
+	return weighted, strategy, this.TopN.ValueOr(topN)
+}
+
 func (this CommandArgs) NewIPAddress(value string) definitions.DNS_IP_Address {
 	return definitions.DNS_IP_Address{
 		DNS_Address: this.NewDnsAddress(),
@@ -258,13 +334,14 @@ func (this CommandArgs) AddRecord_A(rec *definitions.DNS_A_Record, value string)
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_A_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_A_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].IP == value {
@@ -286,9 +363,11 @@ func RemoveRecord_A(rec *definitions.DNS_A_Record, index int) *definitions.DNS_A
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_A_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -298,7 +377,12 @@ func RemoveRecord_A(rec *definitions.DNS_A_Record, index int) *definitions.DNS_A
 	addresses := make([]definitions.DNS_A_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_A_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_A_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_AAAA(rec *definitions.DNS_AAAA_Record, value string) (
@@ -312,13 +396,14 @@ func (this CommandArgs) AddRecord_AAAA(rec *definitions.DNS_AAAA_Record, value s
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_AAAA_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_AAAA_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].IP == value {
 				// already exists
@@ -338,9 +423,11 @@ func RemoveRecord_AAAA(rec *definitions.DNS_AAAA_Record, index int) *definitions
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_AAAA_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -350,7 +437,12 @@ func RemoveRecord_AAAA(rec *definitions.DNS_AAAA_Record, index int) *definitions
 	addresses := make([]definitions.DNS_AAAA_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_AAAA_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_AAAA_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_NS(rec *definitions.DNS_NS_Record, value string) (
@@ -364,13 +456,14 @@ func (this CommandArgs) AddRecord_NS(rec *definitions.DNS_NS_Record, value strin
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_NS_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_NS_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].Value == value {
 				// already exists
@@ -390,9 +483,11 @@ func RemoveRecord_NS(rec *definitions.DNS_NS_Record, index int) *definitions.DNS
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_NS_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -402,7 +497,12 @@ func RemoveRecord_NS(rec *definitions.DNS_NS_Record, index int) *definitions.DNS
 	addresses := make([]definitions.DNS_NS_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_NS_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_NS_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_TXT(rec *definitions.DNS_TXT_Record, value string) (
@@ -416,13 +516,14 @@ func (this CommandArgs) AddRecord_TXT(rec *definitions.DNS_TXT_Record, value str
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_TXT_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_TXT_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].Value == value {
 				// already exists
@@ -442,9 +543,11 @@ func RemoveRecord_TXT(rec *definitions.DNS_TXT_Record, index int) *definitions.D
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_TXT_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -454,7 +557,12 @@ func RemoveRecord_TXT(rec *definitions.DNS_TXT_Record, index int) *definitions.D
 	addresses := make([]definitions.DNS_TXT_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_TXT_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_TXT_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_CNAME(rec *definitions.DNS_CNAME_Record, value string) (
@@ -468,13 +576,14 @@ func (this CommandArgs) AddRecord_CNAME(rec *definitions.DNS_CNAME_Record, value
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_CNAME_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_CNAME_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].Value == value {
 				// already exists
@@ -494,9 +603,11 @@ func RemoveRecord_CNAME(rec *definitions.DNS_CNAME_Record, index int) *definitio
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_CNAME_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -506,7 +617,12 @@ func RemoveRecord_CNAME(rec *definitions.DNS_CNAME_Record, index int) *definitio
 	addresses := make([]definitions.DNS_CNAME_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_CNAME_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_CNAME_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_MX(rec *definitions.DNS_MX_Record, value string) (
@@ -522,13 +638,14 @@ func (this CommandArgs) AddRecord_MX(rec *definitions.DNS_MX_Record, value strin
 				},
 			},
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(false, "", 0)
 		return result, &result.Addresses[0], true
 	} else {
 		// search for this IP
 		result = &definitions.DNS_MX_Record{
-			Weighted:  rec.Weighted,
 			Addresses: append([]definitions.DNS_MX_Address{}, rec.Addresses...),
 		}
+		result.Weighted, result.Strategy, result.TopN = this.UpdatedStrategy(rec.Weighted, rec.Strategy, rec.TopN)
 		for i := 0; i < len(rec.Addresses); i++ {
 			if rec.Addresses[i].Value == value {
 				// already exists
@@ -551,9 +668,11 @@ func RemoveRecord_MX(rec *definitions.DNS_MX_Record, index int) *definitions.DNS
 		panic("Invalid index")
 	}
 	if rec.Length() == 1 {
-		if rec.Weighted {
+		if rec.Weighted || rec.Strategy != "" {
 			return &definitions.DNS_MX_Record{
-				Weighted: true,
+				Weighted: rec.Weighted,
+				Strategy: rec.Strategy,
+				TopN:     rec.TopN,
 			}
 		} else {
 			return nil
@@ -563,7 +682,12 @@ func RemoveRecord_MX(rec *definitions.DNS_MX_Record, index int) *definitions.DNS
 	addresses := make([]definitions.DNS_MX_Address, 0, rec.Length()-1)
 	addresses = append(addresses, rec.Addresses[:index]...)
 	addresses = append(addresses, rec.Addresses[index+1:]...)
-	return &definitions.DNS_MX_Record{Weighted: rec.Weighted, Addresses: addresses}
+	return &definitions.DNS_MX_Record{
+		Weighted:  rec.Weighted,
+		Strategy:  rec.Strategy,
+		TopN:      rec.TopN,
+		Addresses: addresses,
+	}
 }
 
 func (this CommandArgs) AddRecord_SRV(rec definitions.DNS_SRV_Record, server string, port uint16) (
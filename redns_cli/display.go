@@ -130,13 +130,18 @@ func (this DefaultDisplayContext) PrintAddress(addr definitions.IDNSAddress, ind
 		priority = "PRI:" + strconv.Itoa(int(nPriority))
 	}
 
+	tier := ""
+	if baseAddr.Tier != 0 {
+		tier = " TIER:" + strconv.Itoa(int(baseAddr.Tier))
+	}
+
 	value := addr.GetValue()
 	if len(value) < 30 {
 		value += strings.Repeat(" ", 30-len(value))
 	}
 
 	kind := addr.GetKind()
-	this.Printf("%s%s%s %s E:%s H:%s W:%d TTL:%d%s\n",
+	this.Printf("%s%s%s %s E:%s H:%s W:%d TTL:%d%s%s\n",
 		strings.Repeat(" ", indent),
 		kind,
 		strings.Repeat(" ", 5-len(kind)),
@@ -145,6 +150,7 @@ func (this DefaultDisplayContext) PrintAddress(addr definitions.IDNSAddress, ind
 		healthy,
 		int(baseAddr.Weight),
 		baseAddr.TTL,
+		tier,
 		priority)
 }
 func (this DefaultDisplayContext) PrintAddressRecord(rec definitions.IDNSAddressRecord, indent int) {
@@ -155,8 +161,11 @@ func (this DefaultDisplayContext) PrintAddressRecord(rec definitions.IDNSAddress
 		strings.Repeat(" ", 5-len(kind)),
 	)
 
-	if rec.IsWeighted() {
-		this.Print(" [LOAD BALANCED]")
+	strategy := rec.GetStrategy()
+	if strategy == definitions.Strategy_TopN {
+		this.Printf(" [LOAD BALANCED: %s(%d)]", strategy, rec.GetTopN())
+	} else if strategy != definitions.Strategy_All {
+		this.Printf(" [LOAD BALANCED: %s]", strategy)
 	}
 
 	addresses := rec.AddressList()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/devops-simba/redns/definitions"
@@ -108,10 +109,16 @@ func (this InsertCommand) normalizeValue(context DisplayContext, args *CommandAr
 				return errors.New("Invalid MX(must be a domain name)")
 			}
 		case definitions.Kind_SRV:
-			_, _, err := ParseSRV(value)
+			server, port, err := ParseSRV(value)
 			if err != nil {
 				return err
 			}
+			value = fmt.Sprintf("%s:%d", server, port)
+		}
+		if args.HealthCheck.Check != nil {
+			if _, err := args.HealthCheck.Check.GetTarget(value); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -134,6 +141,20 @@ func (this InsertCommand) normalizePriority(context DisplayContext, args *Comman
 
 	return nil
 }
+func (this InsertCommand) normalizeStrategy(context DisplayContext, args *CommandArgs) error {
+	if args.Strategy != "" || args.TopN != InvalidWord {
+		for _, kind := range args.Kind {
+			if !definitions.SupportsStrategy(kind) {
+				return fmt.Errorf("Load balancing strategy is not supported by %s records", kind)
+			}
+		}
+	}
+	if args.TopN != InvalidWord && args.Strategy != "" && args.Strategy != definitions.Strategy_TopN {
+		context.Warnf("TopN is only used by the `%s` strategy", definitions.Strategy_TopN)
+	}
+
+	return nil
+}
 func (this InsertCommand) Normalize(context DisplayContext, args *CommandArgs) error {
 	err := this.normalizeDomain(context, args)
 	if err != nil {
@@ -160,47 +181,46 @@ func (this InsertCommand) Normalize(context DisplayContext, args *CommandArgs) e
 		return err
 	}
 
+	err = this.normalizeStrategy(context, args)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 func (this InsertCommand) Execute(context DisplayContext, args CommandArgs) error {
-	var rec definitions.DNSRecord
-	if this {
-		// we should add all information to current record
-		prec, err := args.ReadRecord(args.Domain[0], args.Name[0])
-		if err != nil {
-			return err
-		}
-		if prec != nil {
-			rec = prec.DNSRecord
-		} else {
-			rec.Domain = args.Domain[0]
+	domain, name := args.Domain[0], args.Name[0]
+	_, err := args.UpdateRecordByKey(GetRedisKey(domain, name), func(current *definitions.DNSRecord) (*definitions.DNSRecord, error) {
+		rec := definitions.DNSRecord{Domain: domain}
+		if this && current != nil {
+			// we should add all information to current record
+			if current.Domain != domain {
+				return nil, fmt.Errorf("Record belong to another domain(Expected: %s, Found: %s)", domain, current.Domain)
+			}
+			rec = *current
 		}
-	} else {
-		rec.Domain = args.Domain[0]
-	}
 
-	for i, kind := range args.Kind {
-		value := args.Value[i]
-		switch kind {
-		case definitions.Kind_A:
-			rec.ARecords, _, _ = args.AddRecord_A(rec.ARecords, value)
-		case definitions.Kind_AAAA:
-			rec.AAAARecords, _, _ = args.AddRecord_AAAA(rec.AAAARecords, value)
-		case definitions.Kind_NS:
-			rec.NSRecords, _, _ = args.AddRecord_NS(rec.NSRecords, value)
-		case definitions.Kind_TXT:
-			rec.TXTRecords, _, _ = args.AddRecord_TXT(rec.TXTRecords, value)
-		case definitions.Kind_CNAME:
-			rec.CNameRecords, _, _ = args.AddRecord_CNAME(rec.CNameRecords, value)
-		case definitions.Kind_MX:
-			rec.MXRecords, _, _ = args.AddRecord_MX(rec.MXRecords, value)
-		case definitions.Kind_SRV:
-			server, port, _ := ParseSRV(value) // its already validated so it should never fail
-			rec.SRVRecords, _, _ = args.AddRecord_SRV(rec.SRVRecords, server, port)
+		for i, kind := range args.Kind {
+			value := args.Value[i]
+			switch kind {
+			case definitions.Kind_A:
+				rec.ARecords, _, _ = args.AddRecord_A(rec.ARecords, value)
+			case definitions.Kind_AAAA:
+				rec.AAAARecords, _, _ = args.AddRecord_AAAA(rec.AAAARecords, value)
+			case definitions.Kind_NS:
+				rec.NSRecords, _, _ = args.AddRecord_NS(rec.NSRecords, value)
+			case definitions.Kind_TXT:
+				rec.TXTRecords, _, _ = args.AddRecord_TXT(rec.TXTRecords, value)
+			case definitions.Kind_CNAME:
+				rec.CNameRecords, _, _ = args.AddRecord_CNAME(rec.CNameRecords, value)
+			case definitions.Kind_MX:
+				rec.MXRecords, _, _ = args.AddRecord_MX(rec.MXRecords, value)
+			case definitions.Kind_SRV:
+				server, port, _ := ParseSRV(value) // its already validated so it should never fail
+				rec.SRVRecords, _, _ = args.AddRecord_SRV(rec.SRVRecords, server, port)
+			}
 		}
-	}
-
-	args.WriteRecord(&rec, args.Domain[0], args.Name[0])
-
-	return nil
+		return &rec, nil
+	})
+	return err
 }
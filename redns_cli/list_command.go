@@ -1,8 +1,6 @@
 package main
 
 import (
-	"strings"
-
 	"github.com/devops-simba/redns/definitions"
 )
 
@@ -55,6 +53,9 @@ func (this ListCommand) Execute(context DisplayContext, args CommandArgs) error
 			if args.Priority != InvalidWord && address.GetPriority() != uint16(args.Priority) {
 				continue
 			}
+			if args.Tier != InvalidWord && dnsAddress.Tier != uint16(args.Tier) {
+				continue
+			}
 			if len(args.Value) != 0 && !args.Value.Contains(address.GetValue()) {
 				continue
 			}
@@ -72,11 +73,7 @@ func (this ListCommand) Execute(context DisplayContext, args CommandArgs) error
 		// if this is a new record, print its header
 		if addr.Rec != last_rec {
 			last_rec = addr.Rec
-			key := last_rec.Key
-			if strings.HasPrefix(key, "$.") {
-				key = "*." + key[2:]
-			}
-			context.Printf("%s(%s):\n", key, last_rec.Domain)
+			context.Printf("%s(%s):\n", definitions.RedisKeyToName(last_rec.Key), last_rec.Domain)
 		}
 
 		// now print the address
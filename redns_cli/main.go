@@ -11,10 +11,14 @@ import (
 func main() {
 	flag.Usage = func() {
 		fmt.Println("action Action that should executed by this tool. Available actions are:")
-		fmt.Println("	list    List records and addresses based on enetered criteria")
-		fmt.Println("	add     Add one or more addresses to a record")
-		fmt.Println("	set     Replace content of a record with addresses that specified in this command")
-		fmt.Println("	remove  Remove addresses or records")
+		fmt.Println("	list        List records and addresses based on enetered criteria")
+		fmt.Println("	add         Add one or more addresses to a record")
+		fmt.Println("	set         Replace content of a record with addresses that specified in this command")
+		fmt.Println("	remove      Remove addresses or records")
+		fmt.Println("	zones       List zones that servers are authoritative for")
+		fmt.Println("	add-zone    Add one or more domains to the authoritative zones or update their nameserver and mailbox")
+		fmt.Println("	remove-zone Remove one or more domains from the authoritative zones")
+		fmt.Println("	reindex     Index the records that are written by the older versions, so servers check their health")
 		flag.PrintDefaults()
 	}
 
@@ -34,6 +38,14 @@ func main() {
 		command = SetCommand
 	case "remove":
 		command = RemoveCommand{}
+	case "zones":
+		command = ListZonesCommand
+	case "add-zone":
+		command = AddZoneCommand
+	case "remove-zone":
+		command = RemoveZoneCommand
+	case "reindex":
+		command = ReindexCommand{}
 	default:
 		flag.Parse()
 		log.Error("Unknown command.")
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// reindexBatchSize is the number of the keys that are read at once
+const reindexBatchSize = 500
+
+// ReindexCommand add every record of the database to the index of the record keys and mark their
+// ancestors as non-terminals. Records that are written by the older versions are not indexed, so
+// servers do not check their health and their empty non-terminals are shadowed by the wildcards
+// until this command is executed.
+type ReindexCommand struct{}
+
+func (this ReindexCommand) Normalize(context DisplayContext, args *CommandArgs) error {
+	return nil
+}
+func (this ReindexCommand) Execute(context DisplayContext, args CommandArgs) error {
+	keys, err := args.Redis.Keys("*")
+	if err != nil {
+		return err
+	}
+	recordKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if definitions.IsRecordKey(key) {
+			recordKeys = append(recordKeys, key)
+		}
+	}
+
+	indexed := 0
+	for start := 0; start < len(recordKeys); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(recordKeys) {
+			end = len(recordKeys)
+		}
+		batch := recordKeys[start:end]
+		values, err := args.Redis.Mget(batch...)
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			// the key may be removed meanwhile or it may belong to another application
+			var rec definitions.DNSRecord
+			if value == nil || json.Unmarshal(value, &rec) != nil {
+				context.Warnf("Ignoring key '%s', it does not hold a record", batch[i])
+				continue
+			}
+			err = definitions.AddRecordKey(&args.Redis, batch[i])
+			if err != nil {
+				return err
+			}
+			indexed++
+		}
+	}
+	context.Infof("Indexed %d records\n", indexed)
+	return nil
+}
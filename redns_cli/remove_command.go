@@ -29,7 +29,7 @@ func (this RemoveCommand) Execute(context DisplayContext, args CommandArgs) erro
 	if !args.Kind.Any() || args.Enabled != None ||
 		args.Healthy != None || len(args.Value) != 0 ||
 		args.TTL != InvalidDWord || args.Priority != InvalidWord ||
-		args.Weight != InvalidWord {
+		args.Weight != InvalidWord || args.Tier != InvalidWord {
 		return removeAddresses(context, args, records)
 	} else {
 		return removeRecords(context, args, records)
@@ -57,85 +57,97 @@ func shouldRemove(args CommandArgs, addr definitions.IDNSAddress) bool {
 	if args.Priority != InvalidWord && uint16(args.Priority) != addr.GetPriority() {
 		return false
 	}
+	if args.Tier != InvalidWord && uint16(args.Tier) != baseAddr.Tier {
+		return false
+	}
 	if len(args.Value) != 0 && !Contains(args.Value, addr.GetValue()) {
 		return false
 	}
 
 	return true
 }
-func removeAddresses(context DisplayContext, args CommandArgs, records []DNSRecordWithKey) error {
-	for i := 0; i < len(records); i++ {
-		changed := false
-		rec := records[i]
-		for j := 0; j < rec.ARecords.Length(); j++ {
-			if shouldRemove(args, &rec.ARecords.Addresses[j]) {
-				rec.ARecords = RemoveRecord_A(rec.ARecords, j)
-				changed = true
-				j--
-			}
-		}
-		for j := 0; j < rec.AAAARecords.Length(); j++ {
-			if shouldRemove(args, &rec.AAAARecords.Addresses[j]) {
-				rec.AAAARecords = RemoveRecord_AAAA(rec.AAAARecords, j)
-				changed = true
-				j--
-			}
+
+// removeMatchingAddresses remove the addresses of a record that match the arguments, it returns
+// `false` if no address is removed
+func removeMatchingAddresses(args CommandArgs, rec *definitions.DNSRecord) bool {
+	changed := false
+	for j := 0; j < rec.ARecords.Length(); j++ {
+		if shouldRemove(args, &rec.ARecords.Addresses[j]) {
+			rec.ARecords = RemoveRecord_A(rec.ARecords, j)
+			changed = true
+			j--
 		}
-		for j := 0; j < rec.NSRecords.Length(); j++ {
-			if shouldRemove(args, &rec.NSRecords.Addresses[j]) {
-				rec.NSRecords = RemoveRecord_NS(rec.NSRecords, j)
-				changed = true
-				j--
-			}
+	}
+	for j := 0; j < rec.AAAARecords.Length(); j++ {
+		if shouldRemove(args, &rec.AAAARecords.Addresses[j]) {
+			rec.AAAARecords = RemoveRecord_AAAA(rec.AAAARecords, j)
+			changed = true
+			j--
 		}
-		for j := 0; j < rec.TXTRecords.Length(); j++ {
-			if shouldRemove(args, &rec.TXTRecords.Addresses[j]) {
-				rec.TXTRecords = RemoveRecord_TXT(rec.TXTRecords, j)
-				changed = true
-				j--
-			}
+	}
+	for j := 0; j < rec.NSRecords.Length(); j++ {
+		if shouldRemove(args, &rec.NSRecords.Addresses[j]) {
+			rec.NSRecords = RemoveRecord_NS(rec.NSRecords, j)
+			changed = true
+			j--
 		}
-		for j := 0; j < rec.CNameRecords.Length(); j++ {
-			if shouldRemove(args, &rec.CNameRecords.Addresses[j]) {
-				rec.CNameRecords = RemoveRecord_CNAME(rec.CNameRecords, j)
-				changed = true
-				j--
-			}
+	}
+	for j := 0; j < rec.TXTRecords.Length(); j++ {
+		if shouldRemove(args, &rec.TXTRecords.Addresses[j]) {
+			rec.TXTRecords = RemoveRecord_TXT(rec.TXTRecords, j)
+			changed = true
+			j--
 		}
-		for j := 0; j < rec.MXRecords.Length(); j++ {
-			if shouldRemove(args, &rec.MXRecords.Addresses[j]) {
-				rec.MXRecords = RemoveRecord_MX(rec.MXRecords, j)
-				changed = true
-				j--
-			}
+	}
+	for j := 0; j < rec.CNameRecords.Length(); j++ {
+		if shouldRemove(args, &rec.CNameRecords.Addresses[j]) {
+			rec.CNameRecords = RemoveRecord_CNAME(rec.CNameRecords, j)
+			changed = true
+			j--
 		}
-		for j := 0; j < rec.SRVRecords.Length(); j++ {
-			if shouldRemove(args, &rec.SRVRecords[j]) {
-				rec.SRVRecords = RemoveRecord_SRV(rec.SRVRecords, j)
-				changed = true
-				j--
-			}
+	}
+	for j := 0; j < rec.MXRecords.Length(); j++ {
+		if shouldRemove(args, &rec.MXRecords.Addresses[j]) {
+			rec.MXRecords = RemoveRecord_MX(rec.MXRecords, j)
+			changed = true
+			j--
 		}
-
-		if !changed {
-			continue
+	}
+	for j := 0; j < rec.SRVRecords.Length(); j++ {
+		if shouldRemove(args, &rec.SRVRecords[j]) {
+			rec.SRVRecords = RemoveRecord_SRV(rec.SRVRecords, j)
+			changed = true
+			j--
 		}
-		if rec.ARecords == nil && rec.AAAARecords == nil &&
-			rec.NSRecords == nil && rec.TXTRecords == nil && rec.CNameRecords == nil &&
-			rec.MXRecords == nil && rec.SRVRecords == nil {
-			ok, err := args.Redis.Del(rec.Key)
-			if err != nil {
-				context.Errorf("Failed to remove `%s`: %v\n", rec.Key, err)
-			} else if ok {
-				context.Infof("Removed `%s`\n", rec.Key)
+	}
+	return changed
+}
+func isEmptyRecord(rec *definitions.DNSRecord) bool {
+	return rec.ARecords == nil && rec.AAAARecords == nil &&
+		rec.NSRecords == nil && rec.TXTRecords == nil && rec.CNameRecords == nil &&
+		rec.MXRecords == nil && rec.SRVRecords == nil
+}
+func removeAddresses(context DisplayContext, args CommandArgs, records []DNSRecordWithKey) error {
+	for i := 0; i < len(records); i++ {
+		key := records[i].Key
+		removed := false
+		// record is read again under the lock, it may be changed since it is found
+		changed, err := args.UpdateRecordByKey(key, func(current *definitions.DNSRecord) (*definitions.DNSRecord, error) {
+			if current == nil || !removeMatchingAddresses(args, current) {
+				return current, nil
 			}
-		} else {
-			err := args.WriteRecordByKey(&rec.DNSRecord, rec.Key)
-			if err == nil {
-				context.Infof("Updated `%s`\n", rec.Key)
-			} else {
-				context.Errorf("Failed to update `%s`: %v\n", rec.Key, err)
+			if isEmptyRecord(current) {
+				removed = true
+				return nil, nil
 			}
+			return current, nil
+		})
+		if err != nil {
+			context.Errorf("Failed to update `%s`: %v\n", key, err)
+		} else if changed && removed {
+			context.Infof("Removed `%s`\n", key)
+		} else if changed {
+			context.Infof("Updated `%s`\n", key)
 		}
 	}
 
@@ -144,7 +156,9 @@ func removeAddresses(context DisplayContext, args CommandArgs, records []DNSReco
 func removeRecords(context DisplayContext, args CommandArgs, records []DNSRecordWithKey) error {
 	for i := 0; i < len(records); i++ {
 		rec := records[i]
-		ok, err := args.Redis.Del(rec.Key)
+		ok, err := args.UpdateRecordByKey(rec.Key, func(*definitions.DNSRecord) (*definitions.DNSRecord, error) {
+			return nil, nil
+		})
 		if err != nil {
 			context.Errorf("Failed to remove key `%s`: %v\n", rec.Key, err)
 		} else if ok {
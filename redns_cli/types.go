@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
@@ -8,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/devops-simba/redns/definitions"
 	"github.com/hoisie/redis"
 )
 
@@ -18,6 +20,13 @@ type Kind []string
 type Word uint16
 type DWord uint32
 type Bool3 uint8
+type Strategy string
+
+// HealthCheckValue is a health check in JSON format, `none` remove the health check
+type HealthCheckValue struct {
+	IsSet bool
+	Check *definitions.HealthCheck
+}
 
 const (
 	domainCharsWithWC       = "a-zA-Z0-9\\*\\?"
@@ -318,3 +327,53 @@ func (this Bool3) BoolOr(defaultValue bool) bool {
 }
 
 //endregion
+
+//region Strategy
+func (this *Strategy) String() string { return string(*this) }
+func (this *Strategy) Set(value string) error {
+	value = strings.ToLower(value)
+	if value != "" && !definitions.IsValidStrategy(value) {
+		return fmt.Errorf("'%s' is not a valid strategy. Accepted values are: [%s]",
+			value, strings.Join(definitions.Strategies, ","))
+	}
+
+	*this = Strategy(value)
+	return nil
+}
+
+//endregion
+
+//region HealthCheckValue
+func (this *HealthCheckValue) String() string {
+	if this.Check == nil {
+		return ""
+	}
+	content, _ := json.Marshal(this.Check)
+	return string(content)
+}
+func (this *HealthCheckValue) Set(value string) error {
+	if value == "" || strings.ToLower(value) == "none" {
+		this.IsSet, this.Check = true, nil
+		return nil
+	}
+
+	var check definitions.HealthCheck
+	err := json.Unmarshal([]byte(value), &check)
+	if err != nil {
+		return fmt.Errorf("Invalid health check: %v", err)
+	}
+	err = check.Validate()
+	if err != nil {
+		return err
+	}
+	this.IsSet, this.Check = true, &check
+	return nil
+}
+func (this HealthCheckValue) CheckOr(defaultValue *definitions.HealthCheck) *definitions.HealthCheck {
+	if this.IsSet {
+		return this.Check.DeepCopy()
+	}
+	return defaultValue
+}
+
+//endregion
@@ -25,17 +25,6 @@ var (
 			domainChars, domainChars, domainChars, domainChars, domainChars, domainChars))
 )
 
-// Merge a name and domain to create a key in the redis
-func GetKey(domain string, name string) string {
-	if name == "*" {
-		return "&." + domain
-	} else if name == "@" {
-		return domain
-	} else {
-		return name + "." + domain
-	}
-}
-
 // Check if an string contains wildcard syntax characters
 func IsWildcard(s string) bool { return strings.IndexAny(s, "*?") != -1 }
 
@@ -98,13 +87,7 @@ func Contains(collection []string, value string) bool { return FindString(collec
 
 // GetRedisKey return the key that we should use in REDIS to hold a record for a domain and a name
 func GetRedisKey(domain string, name string) string {
-	if name == "@" {
-		return domain
-	} else if name == "*" {
-		return "$." + domain
-	} else {
-		return name + "." + domain
-	}
+	return definitions.GetRedisKey(domain, name)
 }
 
 // IsDomainName check if a value is a domain name
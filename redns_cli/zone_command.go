@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+type ZoneCommand string
+
+const (
+	AddZoneCommand    = ZoneCommand("add")
+	RemoveZoneCommand = ZoneCommand("remove")
+	ListZonesCommand  = ZoneCommand("list")
+)
+
+func (this ZoneCommand) Normalize(context DisplayContext, args *CommandArgs) error {
+	if this == ListZonesCommand {
+		return nil
+	}
+
+	if len(args.Domain) == 0 {
+		return errors.New("Domain is required")
+	}
+	for _, domain := range args.Domain {
+		if IsWildcard(domain) {
+			return errors.New("Invalid domain name")
+		}
+	}
+	return nil
+}
+func (this ZoneCommand) Execute(context DisplayContext, args CommandArgs) error {
+	switch this {
+	case AddZoneCommand:
+		for _, domain := range args.Domain {
+			err := setZoneInfo(args, domain)
+			if err != nil {
+				context.Errorf("Failed to write settings of zone `%s`: %v\n", domain, err)
+				continue
+			}
+
+			_, err = args.Redis.Sadd(definitions.ZonesKey, []byte(domain))
+			if err != nil {
+				context.Errorf("Failed to add zone `%s`: %v\n", domain, err)
+			} else {
+				context.Infof("Added zone `%s`\n", domain)
+			}
+		}
+	case RemoveZoneCommand:
+		for _, domain := range args.Domain {
+			ok, err := args.Redis.Srem(definitions.ZonesKey, []byte(domain))
+			if err != nil {
+				context.Errorf("Failed to remove zone `%s`: %v\n", domain, err)
+				continue
+			} else if ok {
+				context.Infof("Removed zone `%s`\n", domain)
+			}
+
+			_, err = args.Redis.Del(definitions.GetZoneInfoKey(domain))
+			if err != nil {
+				context.Errorf("Failed to remove settings of zone `%s`: %v\n", domain, err)
+			}
+		}
+	default:
+		members, err := args.Redis.Smembers(definitions.ZonesKey)
+		if err != nil {
+			return err
+		}
+
+		zones := make([]string, len(members))
+		for i := 0; i < len(members); i++ {
+			zones[i] = string(members[i])
+		}
+		sort.Strings(zones)
+		for _, zone := range zones {
+			info, err := getZoneInfo(args, zone)
+			if err != nil {
+				context.Errorf("Failed to read settings of zone `%s`: %v\n", zone, err)
+			}
+			if info == nil || (info.Nameserver == "" && info.Mailbox == "") {
+				context.Printf("%s\n", zone)
+			} else {
+				context.Printf("%s NS:%s MAILBOX:%s\n", zone, info.Nameserver, info.Mailbox)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getZoneInfo(args CommandArgs, zone string) (*definitions.ZoneInfo, error) {
+	value, err := args.Redis.Get(definitions.GetZoneInfoKey(zone))
+	if err != nil {
+		// missing key
+		return nil, nil
+	}
+
+	info := &definitions.ZoneInfo{}
+	err = json.Unmarshal(value, info)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// setZoneInfo update settings of the zone with the values that are specified in the args. Settings
+// are always written, since servers are only authoritative for the zones that have settings.
+func setZoneInfo(args CommandArgs, zone string) error {
+	info, err := getZoneInfo(args, zone)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		info = &definitions.ZoneInfo{}
+	}
+	if args.Nameserver != "" {
+		info.Nameserver = args.Nameserver
+	}
+	if args.Mailbox != "" {
+		info.Mailbox = args.Mailbox
+	}
+
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return args.Redis.Set(definitions.GetZoneInfoKey(zone), value)
+}
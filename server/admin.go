@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// AdminHandler serve health, readiness and debug endpoints of a DNS server
+type AdminHandler struct {
+	server *DNSServer
+	health *HealthCheckRunner
+	mux    *http.ServeMux
+}
+
+type lookupResult struct {
+	Name          string                 `json:"name"`
+	Type          string                 `json:"type"`
+	Zone          string                 `json:"zone,omitempty"`
+	Record        *definitions.DNSRecord `json:"record,omitempty"`
+	RecordError   string                 `json:"recordError,omitempty"`
+	Rcode         string                 `json:"rcode"`
+	Authoritative bool                   `json:"authoritative"`
+	Answer        []string               `json:"answer"`
+	Authority     []string               `json:"authority"`
+	Additional    []string               `json:"additional"`
+}
+
+// NewAdminHandler create the admin handler of a server, `health` is nil if the server does not run
+// the health checks
+func NewAdminHandler(server *DNSServer, health *HealthCheckRunner) *AdminHandler {
+	handler := &AdminHandler{server: server, health: health, mux: http.NewServeMux()}
+	handler.mux.HandleFunc("/healthz", handler.healthz)
+	handler.mux.HandleFunc("/readyz", handler.readyz)
+	handler.mux.HandleFunc("/debug/lookup", handler.lookup)
+	handler.mux.HandleFunc("/debug/health", handler.healthChecks)
+	return handler
+}
+
+func (this *AdminHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	this.mux.ServeHTTP(w, req)
+}
+
+// healthz report that the process is alive
+func (this *AdminHandler) healthz(w http.ResponseWriter, req *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyz report that the server is able to answer the queries, that is the backend is reachable and
+// the zones are loaded. Zones are never cached, so reading them always reach the backend.
+func (this *AdminHandler) readyz(w http.ResponseWriter, req *http.Request) {
+	_, err := this.server.database.GetZones()
+	if err != nil {
+		http.Error(w, "database is not reachable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	// without any zone every query is refused
+	if this.server.zones.Len() == 0 {
+		http.Error(w, "no zone is loaded", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ok"))
+}
+
+// lookup report the record that found for a name and the response that server will send for it
+func (this *AdminHandler) lookup(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "`name` is required", http.StatusBadRequest)
+		return
+	}
+
+	qtypeName := strings.ToUpper(req.URL.Query().Get("type"))
+	if qtypeName == "" {
+		qtypeName = "A"
+	}
+	qtype, ok := dns.StringToType[qtypeName]
+	if !ok {
+		http.Error(w, "invalid `type`", http.StatusBadRequest)
+		return
+	}
+
+	result := lookupResult{Name: dns.Fqdn(name), Type: qtypeName}
+	result.Zone, _ = this.server.zones.FindZone(name)
+
+	var err error
+	result.Record, err = NewLookup(this.server.database).FindRecord(strings.TrimSuffix(name, "."), result.Zone)
+	if err != nil {
+		result.RecordError = err.Error()
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion(result.Name, qtype)
+	response := this.server.Resolve(query, nil)
+	result.Rcode = dns.RcodeToString[response.Rcode]
+	result.Authoritative = response.Authoritative
+	result.Answer = rrToStrings(response.Answer)
+	result.Authority = rrToStrings(response.Ns)
+	result.Additional = rrToStrings(response.Extra)
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(result)
+	if err != nil {
+		log.Printf("[ERR] Failed to write lookup result: %v", err)
+	}
+}
+
+// healthChecks report state of the health checks, including round trip time of the addresses
+func (this *AdminHandler) healthChecks(w http.ResponseWriter, req *http.Request) {
+	if this.health == nil {
+		http.Error(w, "health checks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(this.health.Status())
+	if err != nil {
+		log.Printf("[ERR] Failed to write health check status: %v", err)
+	}
+}
+
+func rrToStrings(rrs []dns.RR) []string {
+	result := make([]string, len(rrs))
+	for i := 0; i < len(rrs); i++ {
+		result[i] = rrs[i].String()
+	}
+	return result
+}
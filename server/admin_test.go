@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+func TestReadyz(t *testing.T) {
+	database := NewMemoryDNSDatabase()
+	zones := NewZoneSet()
+	handler := NewAdminHandler(NewDNSServer(database, zones, DefaultConfig().SOA), nil)
+	ready := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected not ready before the zones are loaded, got %d", code)
+	}
+	// zones without metadata are not loaded
+	database.SetZone("example.com", nil)
+	if err := LoadZones(database, zones); err != nil {
+		t.Fatal(err)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected not ready without any served zone, got %d", code)
+	}
+
+	database.SetZone("example.com", &definitions.ZoneInfo{Nameserver: "ns1.example.com"})
+	if err := LoadZones(database, zones); err != nil {
+		t.Fatal(err)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("Expected ready, got %d", code)
+	}
+}
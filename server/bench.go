@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	stdlog "log"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// benchQuery is a query that should be sent by the benchmark
+type benchQuery struct {
+	name  string
+	qtype uint16
+}
+
+// benchResult is the result of the queries that sent by a benchmark worker
+type benchResult struct {
+	latencies []time.Duration
+	rcodes    map[int]int
+	errors    map[string]int
+}
+
+// benchQueryMix generate the queries of a benchmark
+type benchQueryMix struct {
+	names       []benchQuery
+	types       []uint16
+	typeWeights []int
+	totalWeight int
+	missRatio   float64
+	zone        string
+}
+
+func (this *benchQueryMix) Next(random *rand.Rand) benchQuery {
+	if random.Float64() < this.missRatio {
+		return benchQuery{
+			name:  fmt.Sprintf("miss-%d.%s.", random.Int63(), this.zone),
+			qtype: this.nextType(random),
+		}
+	}
+
+	query := this.names[random.Intn(len(this.names))]
+	if query.qtype == 0 {
+		query.qtype = this.nextType(random)
+	}
+	return query
+}
+func (this *benchQueryMix) nextType(random *rand.Rand) uint16 {
+	n := random.Intn(this.totalWeight)
+	for i, weight := range this.typeWeights {
+		if n < weight {
+			return this.types[i]
+		}
+		n -= weight
+	}
+	return this.types[len(this.types)-1]
+}
+
+// parseTypeMix parse a comma separated list of `TYPE:weight`
+func parseTypeMix(value string) ([]uint16, []int, int, error) {
+	var types []uint16
+	var weights []int
+	total := 0
+	for _, item := range splitList(value) {
+		typeName, weight := item, 1
+		if i := strings.IndexByte(item, ':'); i != -1 {
+			typeName = item[:i]
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 0 {
+				return nil, nil, 0, fmt.Errorf("Invalid weight in `%s`", item)
+			}
+			weight = n
+		}
+
+		qtype, ok := dns.StringToType[strings.ToUpper(typeName)]
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("Invalid query type `%s`", typeName)
+		}
+		types = append(types, qtype)
+		weights = append(weights, weight)
+		total += weight
+	}
+	if total == 0 {
+		return nil, nil, 0, errors.New("At least one query type with a positive weight is required")
+	}
+	return types, weights, total, nil
+}
+
+// readBenchNames read names of the queries from a file, each line contain a name and optionally
+// type of the query
+func readBenchNames(path string) ([]benchQuery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var result []benchQuery
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		query := benchQuery{name: dns.Fqdn(fields[0])}
+		if len(fields) > 1 {
+			qtype, ok := dns.StringToType[strings.ToUpper(fields[1])]
+			if !ok {
+				return nil, fmt.Errorf("Invalid query type `%s` for %s", fields[1], fields[0])
+			}
+			query.qtype = qtype
+		}
+		result = append(result, query)
+	}
+	return result, scanner.Err()
+}
+
+// newBenchDatabase create an in-memory database with `count` hosts in the zone, each host
+// has A, AAAA and TXT records
+func newBenchDatabase(zone string, count int) (*MemoryDNSDatabase, []benchQuery) {
+	db := NewMemoryDNSDatabase()
+	db.SetSerialNumber(1)
+	db.SetZone(zone, &definitions.ZoneInfo{Nameserver: "ns." + zone})
+
+	names := make([]benchQuery, count)
+	for i := 0; i < count; i++ {
+		key := definitions.GetRedisKey(zone, "host-"+strconv.Itoa(i))
+		record := &definitions.DNSRecord{
+			ARecords:    &definitions.DNS_A_Record{Weighted: i%2 == 0},
+			AAAARecords: &definitions.DNS_AAAA_Record{},
+			TXTRecords:  &definitions.DNS_TXT_Record{},
+		}
+		for j := 0; j < 1+i%3; j++ {
+			record.ARecords.Addresses = append(record.ARecords.Addresses, definitions.DNS_A_Address{
+				DNS_IP_Address: definitions.DNS_IP_Address{
+					DNS_Address: definitions.DNS_Address{TTL: 60, Enabled: true, Healthy: true, Weight: uint16(j + 1)},
+					IP:          fmt.Sprintf("10.%d.%d.%d", (i>>8)&0xFF, i&0xFF, j+1),
+				},
+			})
+		}
+		record.AAAARecords.Addresses = append(record.AAAARecords.Addresses, definitions.DNS_AAAA_Address{
+			DNS_IP_Address: definitions.DNS_IP_Address{
+				DNS_Address: definitions.DNS_Address{TTL: 60, Enabled: true, Healthy: true},
+				IP:          fmt.Sprintf("fd00::%x", i+1),
+			},
+		})
+		record.TXTRecords.Addresses = append(record.TXTRecords.Addresses, definitions.DNS_TXT_Address{
+			DNS_STR_Address: definitions.DNS_STR_Address{
+				DNS_Address: definitions.DNS_Address{TTL: 60, Enabled: true, Healthy: true},
+				Value:       "host " + strconv.Itoa(i),
+			},
+		})
+
+		db.SetRecord(key, record)
+		names[i] = benchQuery{name: dns.Fqdn(key)}
+	}
+	return db, names
+}
+
+// startBenchServer start a DNS server on an ephemeral port of the loopback interface and return its address
+func startBenchServer(database DNSDatabase, network string) (*DNSServer, string, error) {
+	zones := NewZoneSet()
+	err := LoadZones(database, zones)
+	if err != nil {
+		return nil, "", err
+	}
+
+	server := NewDNSServer(database, zones, DefaultConfig().SOA)
+	var addr string
+	if network == "tcp" {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, "", err
+		}
+		server.AddConnListener(nil, listener)
+		addr = listener.Addr().String()
+	} else {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, "", err
+		}
+		server.AddConnListener(conn, nil)
+		addr = conn.LocalAddr().String()
+	}
+
+	go func() {
+		err := server.Start()
+		if err != nil {
+			log.Errorf("Benchmark server stopped: %v", err)
+		}
+	}()
+	return server, addr, nil
+}
+
+// runBenchWorker send the queries that it receive from `queries` until it closed
+func runBenchWorker(client *dns.Client, addr string, queries <-chan benchQuery) benchResult {
+	result := benchResult{rcodes: make(map[int]int), errors: make(map[string]int)}
+
+	var conn *dns.Conn
+	for query := range queries {
+		var err error
+		if conn == nil {
+			conn, err = client.Dial(addr)
+			if err != nil {
+				result.errors["dial"]++
+				conn = nil
+				continue
+			}
+		}
+
+		msg := new(dns.Msg)
+		msg.SetQuestion(query.name, query.qtype)
+		response, rtt, err := client.ExchangeWithConn(msg, conn)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				result.errors["timeout"]++
+			} else {
+				result.errors["exchange"]++
+			}
+			// connection may be in an unknown state, for example a late answer may be read as the next answer
+			conn.Close()
+			conn = nil
+			continue
+		}
+
+		result.latencies = append(result.latencies, rtt)
+		result.rcodes[response.Rcode]++
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	return result
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// runBench is the `bench` command, it generate a query mix at a target rate against a server and
+// report latency percentiles, rcodes and errors
+func runBench(args []string) {
+	flagset := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := flagset.String("target", "", "Address of the server that should be benchmarked, empty start a server on the loopback interface")
+	backendUrl := flagset.String("backend", "", "Backend of the started server, a redis URL or `file://path` of a JSON fixture, empty generate an in-memory database")
+	zone := flagset.String("zone", "bench.test", "Zone of the generated records and missing names")
+	records := flagset.Int("records", 1000, "Number of the hosts that generated in the in-memory database")
+	namesFile := flagset.String("names", "", "File that contain names(and optionally types) of the queries, one per line")
+	typeMix := flagset.String("types", "A:80,AAAA:10,TXT:10", "Distribution of the query types, as a comma separated list of `TYPE:weight`")
+	missRatio := flagset.Float64("miss", 0.1, "Ratio of the queries for the names that does not exist")
+	network := flagset.String("net", "udp", "Transport of the queries, udp or tcp")
+	qps := flagset.Int("qps", 1000, "Target number of queries per second")
+	duration := flagset.Duration("duration", 10*time.Second, "Duration of the benchmark")
+	concurrency := flagset.Int("concurrency", 16, "Number of the concurrent clients")
+	timeout := flagset.Duration("timeout", 2*time.Second, "Timeout of each query")
+	logLevelName := flagset.String("log-level", "error", "Level of the logs of the started server, one of error, warning or info")
+	flagset.Parse(args)
+
+	level, err := ParseLogLevel(*logLevelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logWriter := NewLevelWriter(os.Stderr, level)
+	stdlog.SetOutput(logWriter)
+	logWriter.SetLevel(level)
+
+	if *network != "udp" && *network != "tcp" {
+		log.Fatalf("Invalid transport: %s", *network)
+	}
+	if *qps <= 0 || *concurrency <= 0 || *duration <= 0 {
+		log.Fatal("qps, concurrency and duration must be positive")
+	}
+	if *missRatio < 0 || *missRatio > 1 {
+		log.Fatal("miss ratio must be between 0 and 1")
+	}
+
+	mix := &benchQueryMix{missRatio: *missRatio, zone: strings.TrimSuffix(*zone, ".")}
+	mix.types, mix.typeWeights, mix.totalWeight, err = parseTypeMix(*typeMix)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *namesFile != "" {
+		mix.names, err = readBenchNames(*namesFile)
+		if err != nil {
+			log.Fatalf("Error in reading names: %v", err)
+		}
+	}
+
+	addr := *target
+	if addr == "" {
+		var database DNSDatabase
+		if *backendUrl != "" {
+			database, err = OpenDatabase(*backendUrl)
+			if err != nil {
+				log.Fatalf("Error in opening the database: %v", err)
+			}
+		} else {
+			var names []benchQuery
+			database, names = newBenchDatabase(mix.zone, *records)
+			if len(mix.names) == 0 {
+				mix.names = names
+			}
+		}
+
+		var server *DNSServer
+		server, addr, err = startBenchServer(database, *network)
+		if err != nil {
+			log.Fatalf("Error in starting the server: %v", err)
+		}
+		defer server.Shutdown()
+	}
+	if len(mix.names) == 0 && mix.missRatio < 1 {
+		log.Fatal("Names of the queries are required, use `-names` to specify them")
+	}
+
+	client := &dns.Client{Net: *network, Timeout: *timeout}
+	queries := make(chan benchQuery, *concurrency)
+	results := make(chan benchResult, *concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- runBenchWorker(client, addr, queries)
+		}()
+	}
+
+	// send queries at the target rate, queries that can't be sent because all of the clients are busy are skipped
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sent, skipped := 0, 0
+	start := time.Now()
+	ticker := time.NewTicker(time.Millisecond)
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		if elapsed >= *duration {
+			break
+		}
+
+		due := int(elapsed.Seconds()*float64(*qps)) - sent - skipped
+		for ; due > 0; due-- {
+			select {
+			case queries <- mix.Next(random):
+				sent++
+			default:
+				skipped++
+			}
+		}
+	}
+	ticker.Stop()
+	close(queries)
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(results)
+
+	total := benchResult{rcodes: make(map[int]int), errors: make(map[string]int)}
+	for result := range results {
+		total.latencies = append(total.latencies, result.latencies...)
+		for rcode, count := range result.rcodes {
+			total.rcodes[rcode] += count
+		}
+		for kind, count := range result.errors {
+			total.errors[kind] += count
+		}
+	}
+	sort.Slice(total.latencies, func(i, j int) bool { return total.latencies[i] < total.latencies[j] })
+
+	fmt.Printf("Target:     %s://%s\n", *network, addr)
+	fmt.Printf("Duration:   %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("Sent:       %d (%.0f qps), skipped: %d\n", sent, float64(sent)/elapsed.Seconds(), skipped)
+	fmt.Printf("Answered:   %d (%.0f qps)\n", len(total.latencies), float64(len(total.latencies))/elapsed.Seconds())
+	fmt.Println("Latency:")
+	for _, p := range []float64{0.5, 0.9, 0.99, 0.999, 1} {
+		fmt.Printf("  p%-6v %v\n", p*100, percentile(total.latencies, p))
+	}
+	fmt.Println("Rcodes:")
+	rcodes := make([]int, 0, len(total.rcodes))
+	for rcode := range total.rcodes {
+		rcodes = append(rcodes, rcode)
+	}
+	sort.Ints(rcodes)
+	for _, rcode := range rcodes {
+		fmt.Printf("  %-10s %d\n", dns.RcodeToString[rcode], total.rcodes[rcode])
+	}
+	if len(total.errors) != 0 {
+		fmt.Println("Errors:")
+		for kind, count := range total.errors {
+			fmt.Printf("  %-10s %d\n", kind, count)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+type cacheEntry struct {
+	expires time.Time
+	record  *definitions.DNSRecord
+}
+
+// CachedDatabase is a DNSDatabase that cache records that read from another database for a
+// short time, missing keys are cached too. Cache is disabled until it configured with an enabled config.
+type CachedDatabase struct {
+	DNSDatabase
+
+	mutex   sync.Mutex
+	config  CacheConfig
+	records map[string]cacheEntry
+}
+
+func NewCachedDatabase(database DNSDatabase, config CacheConfig) *CachedDatabase {
+	result := &CachedDatabase{DNSDatabase: database}
+	result.Configure(config)
+	return result
+}
+
+// Configure change settings of the cache, it also flush the cache
+func (this *CachedDatabase) Configure(config CacheConfig) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.config = config
+	this.records = make(map[string]cacheEntry)
+}
+
+// Flush remove all of the cached records
+func (this *CachedDatabase) Flush() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.records = make(map[string]cacheEntry)
+}
+func (this *CachedDatabase) GetRecords(keys []string) ([]*definitions.DNSRecord, error) {
+	records := make([]*definitions.DNSRecord, len(keys))
+	var missing []string
+	var missingIndexes []int
+
+	this.mutex.Lock()
+	enabled := this.config.Enabled
+	if enabled {
+		now := time.Now()
+		for i, key := range keys {
+			entry, ok := this.records[key]
+			if ok && now.Before(entry.expires) {
+				records[i] = entry.record
+			} else {
+				missing = append(missing, key)
+				missingIndexes = append(missingIndexes, i)
+			}
+		}
+	}
+	this.mutex.Unlock()
+
+	if !enabled {
+		return this.DNSDatabase.GetRecords(keys)
+	}
+	if len(missing) == 0 {
+		return records, nil
+	}
+
+	missingRecords, err := this.DNSDatabase.GetRecords(missing)
+	if err != nil {
+		return nil, err
+	}
+	for i, index := range missingIndexes {
+		records[index] = missingRecords[i]
+	}
+	this.put(missing, missingRecords)
+	return records, nil
+}
+func (this *CachedDatabase) put(keys []string, records []*definitions.DNSRecord) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if !this.config.Enabled {
+		return
+	}
+
+	now := time.Now()
+	if len(this.records)+len(keys) > this.config.Size {
+		for k, v := range this.records {
+			if now.After(v.expires) {
+				delete(this.records, k)
+			}
+		}
+		// still full, drop random entries(map iteration order is random) to make room
+		for k := range this.records {
+			if len(this.records)+len(keys) <= this.config.Size {
+				break
+			}
+			delete(this.records, k)
+		}
+	}
+
+	expires := now.Add(this.config.TTL)
+	for i, key := range keys {
+		this.records[key] = cacheEntry{expires: expires, record: records[i]}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	Transport_UDP   = "udp"
+	Transport_TCP   = "tcp"
+	Transport_TLS   = "tls"
+	Transport_HTTPS = "https"
+	Transport_HTTP  = "http"
+
+	defaultDoHPath = "/dns-query"
+	envPrefix      = "REDNS_"
+)
+
+// ListenerConfig is configuration of a listener of the server
+type ListenerConfig struct {
+	// Transport of the listener, one of udp, tcp, tls(DNS over TLS), https(DNS over HTTPS)
+	// and http(DNS over HTTPS behind a TLS terminating proxy)
+	Transport string `yaml:"transport"`
+	// Address of the listener in `host:port` format, IPv6 hosts must be enclosed in brackets
+	Address string `yaml:"address"`
+	// Path of DNS over HTTPS requests
+	Path string `yaml:"path,omitempty"`
+}
+
+type TLSConfig struct {
+	CertFile string        `yaml:"cert"`
+	KeyFile  string        `yaml:"key"`
+	Reload   time.Duration `yaml:"reload"`
+}
+
+type CacheConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+type SOAConfig struct {
+	// Nameserver is the default primary nameserver of the zones, it is required unless all of
+	// the zones have a nameserver in their settings
+	Nameserver string `yaml:"nameserver"`
+	// Mailbox is the default hostmaster mailbox of the zones, `hostmaster.<zone>` if it is empty
+	Mailbox string `yaml:"mailbox"`
+	TTL     uint32 `yaml:"ttl"`
+	Refresh uint32 `yaml:"refresh"`
+	Retry   uint32 `yaml:"retry"`
+	Expire  uint32 `yaml:"expire"`
+	MinTTL  uint32 `yaml:"minttl"`
+}
+
+// Config is the configuration of the server, fields that are marked as reloadable may be changed by
+// reloading the configuration, others require a restart
+type Config struct {
+	Listeners []ListenerConfig `yaml:"listeners"`
+	// Backend is the URL of the redis server in `redis://[:password@]host:port[/db-number]` format, or
+	// `file://path` of a JSON fixture that loaded into memory
+	Backend string `yaml:"backend"`
+	// Zones is not supported, we are only authoritative for the zones that have their settings in
+	// the backend(DNSDomain objects). It is only kept to reject the old configurations.
+	Zones        []string      `yaml:"zones"`
+	ZonesRefresh time.Duration `yaml:"zonesRefresh"`
+	// Admin is the address of the admin HTTP server, empty disable the server. Its debug endpoints are
+	// not authenticated, so it only listens on the loopback interface by default.
+	Admin string    `yaml:"admin"`
+	TLS   TLSConfig `yaml:"tls"`
+	// Cache settings(reloadable)
+	Cache CacheConfig `yaml:"cache"`
+	// LogLevel is one of error, warning, info(reloadable)
+	LogLevel string `yaml:"logLevel"`
+	// SOA defaults(reloadable)
+	SOA SOAConfig `yaml:"soa"`
+	// TTL limits(reloadable)
+	TTL TTLConfig `yaml:"ttl"`
+	// HealthCheck is settings of the health check runner, it should only be enabled on one server
+	// of the servers that share a backend
+	HealthCheck HealthCheckConfig `yaml:"healthCheck"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Listeners:    []ListenerConfig{{Transport: Transport_UDP, Address: "0.0.0.0:53"}},
+		ZonesRefresh: 30 * time.Second,
+		Admin:        "127.0.0.1:8080",
+		TLS:          TLSConfig{Reload: time.Minute},
+		Cache:        CacheConfig{Enabled: false, Size: 10000, TTL: 5 * time.Second},
+		LogLevel:     "info",
+		SOA: SOAConfig{
+			TTL:     60,
+			Refresh: 86400,
+			Retry:   7200,
+			Expire:  3600, // RFC1912 suggests 2-4 weeks 1209600-2419200
+			MinTTL:  60,
+		},
+		TTL: TTLConfig{Min: 5, Max: 86400, Failover: 30},
+		HealthCheck: HealthCheckConfig{
+			Enabled:      false,
+			ScanInterval: 30 * time.Second,
+			Interval:     10 * time.Second,
+			Timeout:      5 * time.Second,
+			Rise:         2,
+			Fall:         3,
+			Workers:      16,
+		},
+	}
+}
+
+// LoadConfig load configuration from a YAML file(if path is not empty) and apply overrides of the
+// environment variables to it
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.UnmarshalStrict(content, config)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid configuration file `%s`: %v", path, err)
+		}
+	}
+
+	err := config.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (this *Config) applyEnv() error {
+	var err error
+	if value, ok := os.LookupEnv(envPrefix + "LISTEN"); ok {
+		this.Listeners, err = ParseListeners(value)
+		if err != nil {
+			return err
+		}
+	}
+	if value, ok := os.LookupEnv(envPrefix + "BACKEND"); ok {
+		this.Backend = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "ZONES"); ok {
+		this.Zones = splitList(value)
+	}
+	if value, ok := os.LookupEnv(envPrefix + "ADMIN"); ok {
+		this.Admin = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "TLS_CERT"); ok {
+		this.TLS.CertFile = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "TLS_KEY"); ok {
+		this.TLS.KeyFile = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "CACHE_ENABLED"); ok {
+		this.Cache.Enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %sCACHE_ENABLED: %v", envPrefix, err)
+		}
+	}
+	if value, ok := os.LookupEnv(envPrefix + "CACHE_SIZE"); ok {
+		this.Cache.Size, err = strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %sCACHE_SIZE: %v", envPrefix, err)
+		}
+	}
+	if value, ok := os.LookupEnv(envPrefix + "CACHE_TTL"); ok {
+		this.Cache.TTL, err = time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %sCACHE_TTL: %v", envPrefix, err)
+		}
+	}
+	if value, ok := os.LookupEnv(envPrefix + "HEALTH_CHECK_ENABLED"); ok {
+		this.HealthCheck.Enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %sHEALTH_CHECK_ENABLED: %v", envPrefix, err)
+		}
+	}
+	if value, ok := os.LookupEnv(envPrefix + "LOG_LEVEL"); ok {
+		this.LogLevel = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "SOA_NAMESERVER"); ok {
+		this.SOA.Nameserver = value
+	}
+	if value, ok := os.LookupEnv(envPrefix + "SOA_MAILBOX"); ok {
+		this.SOA.Mailbox = value
+	}
+	return nil
+}
+
+// Validate check the configuration and normalize its values
+func (this *Config) Validate() error {
+	if this.Backend == "" {
+		return errors.New("Missing backend(redis db address)")
+	}
+	if len(this.Listeners) == 0 {
+		return errors.New("At least one listener is required")
+	}
+
+	needTLS := false
+	for i := 0; i < len(this.Listeners); i++ {
+		listener := &this.Listeners[i]
+		listener.Transport = strings.ToLower(listener.Transport)
+		switch listener.Transport {
+		case Transport_UDP, Transport_TCP:
+		case Transport_TLS:
+			needTLS = true
+		case Transport_HTTPS, Transport_HTTP:
+			needTLS = needTLS || listener.Transport == Transport_HTTPS
+			if listener.Path == "" {
+				listener.Path = defaultDoHPath
+			} else if !strings.HasPrefix(listener.Path, "/") {
+				return fmt.Errorf("Invalid path for listener %s: %s", listener.Address, listener.Path)
+			}
+		default:
+			return fmt.Errorf("Invalid transport for listener %s: %s", listener.Address, listener.Transport)
+		}
+
+		_, port, err := net.SplitHostPort(listener.Address)
+		if err != nil {
+			return fmt.Errorf("Invalid listener address `%s`: %v", listener.Address, err)
+		}
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("Invalid port in listener address `%s`", listener.Address)
+		}
+	}
+
+	if needTLS && (this.TLS.CertFile == "" || this.TLS.KeyFile == "") {
+		return errors.New("TLS certificate and key are required by tls and https listeners")
+	}
+	if this.TLS.Reload <= 0 {
+		return errors.New("Invalid TLS reload interval")
+	}
+	if len(this.Zones) != 0 {
+		return fmt.Errorf("Static zones(%s) are not supported, create a DNSDomain for them so their settings are written to the backend",
+			strings.Join(this.Zones, ", "))
+	}
+	if this.ZonesRefresh <= 0 {
+		return errors.New("Invalid zones refresh interval")
+	}
+	if this.Cache.Enabled && (this.Cache.Size <= 0 || this.Cache.TTL <= 0) {
+		return errors.New("Cache size and TTL must be positive")
+	}
+	if this.TTL.Max != 0 && this.TTL.Min > this.TTL.Max {
+		return errors.New("Minimum TTL must not be greater than the maximum TTL")
+	}
+	if this.TTL.Failover != 0 && this.TTL.Failover < this.TTL.Min {
+		return errors.New("Failover TTL must not be less than the minimum TTL")
+	}
+	if this.HealthCheck.Enabled {
+		health := this.HealthCheck
+		if health.ScanInterval <= 0 || health.Interval <= 0 || health.Timeout <= 0 || health.Workers <= 0 || health.Rise == 0 || health.Fall == 0 {
+			return errors.New("Health check intervals, timeout, thresholds and workers must be positive")
+		}
+	}
+	if _, err := ParseLogLevel(this.LogLevel); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestartRequired return names of the changed fields that can't be applied without a restart
+func (this *Config) RestartRequired(other *Config) []string {
+	var result []string
+	if fmt.Sprint(this.Listeners) != fmt.Sprint(other.Listeners) {
+		result = append(result, "listeners")
+	}
+	if this.Backend != other.Backend {
+		result = append(result, "backend")
+	}
+	if this.ZonesRefresh != other.ZonesRefresh {
+		result = append(result, "zonesRefresh")
+	}
+	if this.Admin != other.Admin {
+		result = append(result, "admin")
+	}
+	if this.TLS != other.TLS {
+		result = append(result, "tls")
+	}
+	if this.HealthCheck != other.HealthCheck {
+		result = append(result, "healthCheck")
+	}
+	return result
+}
+
+// ParseListeners parse a comma separated list of listeners in `transport://host:port[/path]` format
+func ParseListeners(value string) ([]ListenerConfig, error) {
+	var result []ListenerConfig
+	for _, item := range splitList(value) {
+		if !strings.Contains(item, "://") {
+			item = Transport_UDP + "://" + item
+		}
+
+		u, err := url.Parse(item)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid listener `%s`: %v", item, err)
+		}
+		result = append(result, ListenerConfig{
+			Transport: u.Scheme,
+			Address:   u.Host,
+			Path:      u.Path,
+		})
+	}
+	return result, nil
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dohMediaType      = "application/dns-message"
+	dohMaxMessageSize = 65535
+)
+
+// DoHHandler serve DNS over HTTPS(RFC 8484) requests using a DNS handler
+type DoHHandler struct {
+	Handler dns.Handler
+}
+
+func (this DoHHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var buffer []byte
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+		buffer, err = base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		if err != nil || len(buffer) == 0 {
+			http.Error(w, "Invalid or missing `dns` parameter", http.StatusBadRequest)
+			return
+		}
+	case http.MethodPost:
+		if req.Header.Get("Content-Type") != dohMediaType {
+			http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		buffer, err = ioutil.ReadAll(http.MaxBytesReader(w, req.Body, dohMaxMessageSize))
+		if err != nil {
+			http.Error(w, "Failed to read the request", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	msg := new(dns.Msg)
+	err = msg.Unpack(buffer)
+	if err != nil {
+		http.Error(w, "Invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	writer := &dohResponseWriter{
+		writer:     w,
+		localAddr:  localAddrOf(req),
+		remoteAddr: remoteAddrOf(req),
+	}
+	this.Handler.ServeDNS(writer, msg)
+	if !writer.written {
+		http.Error(w, "Failed to resolve the message", http.StatusInternalServerError)
+	}
+}
+
+// dohResponseWriter is a `dns.ResponseWriter` that write the response to an HTTP response
+type dohResponseWriter struct {
+	writer     http.ResponseWriter
+	localAddr  net.Addr
+	remoteAddr net.Addr
+	written    bool
+}
+
+func (this *dohResponseWriter) LocalAddr() net.Addr  { return this.localAddr }
+func (this *dohResponseWriter) RemoteAddr() net.Addr { return this.remoteAddr }
+func (this *dohResponseWriter) WriteMsg(m *dns.Msg) error {
+	buffer, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = this.Write(buffer)
+	return err
+}
+func (this *dohResponseWriter) Write(buffer []byte) (int, error) {
+	this.written = true
+	this.writer.Header().Set("Content-Type", dohMediaType)
+	this.writer.Header().Set("Content-Length", strconv.Itoa(len(buffer)))
+	return this.writer.Write(buffer)
+}
+func (this *dohResponseWriter) Close() error        { return nil }
+func (this *dohResponseWriter) TsigStatus() error   { return nil }
+func (this *dohResponseWriter) TsigTimersOnly(bool) {}
+func (this *dohResponseWriter) Hijack()             {}
+
+func localAddrOf(req *http.Request) net.Addr {
+	addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil
+	}
+	return addr
+}
+func remoteAddrOf(req *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr)
+	if err != nil {
+		log.Printf("[WRN] Invalid remote address of DoH request: %s", req.RemoteAddr)
+		return nil
+	}
+	return addr
+}
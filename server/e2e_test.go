@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startFixtureServer serve the example fixtures on ephemeral UDP and TCP ports of the loopback
+// interface, it returns address of the UDP port
+func startFixtureServer(t *testing.T) string {
+	addr, _ := startFixtureServers(t)
+	return addr
+}
+
+// startFixtureServers serve the example fixtures on ephemeral UDP and TCP ports of the loopback
+// interface and return their addresses
+func startFixtureServers(t *testing.T) (string, string) {
+	database, err := OpenDatabase("file://fixtures.example.json")
+	if err != nil {
+		t.Fatalf("Error in loading fixtures: %v", err)
+	}
+	zones := NewZoneSet()
+	if err = LoadZones(database, zones); err != nil {
+		t.Fatalf("Error in loading zones: %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	server := NewDNSServer(database, zones, DefaultConfig().SOA)
+	server.AddConnListener(conn, nil)
+	server.AddConnListener(nil, listener)
+	go server.Start()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String(), listener.Addr().String()
+}
+
+func exchange(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	return exchangeNet(t, "udp", addr, name, qtype)
+}
+
+func exchangeNet(t *testing.T, network, addr, name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	client := &dns.Client{Net: network}
+	var err error
+	// server may not be serving yet
+	for i := 0; i < 20; i++ {
+		var r *dns.Msg
+		r, _, err = client.Exchange(m, addr)
+		if err == nil {
+			return r
+		}
+	}
+	t.Fatalf("Error in querying %s: %v", name, err)
+	return nil
+}
+
+func TestE2E(t *testing.T) {
+	addr := startFixtureServer(t)
+	tests := []struct {
+		name     string
+		qtype    uint16
+		rcode    int
+		answers  int
+		authNs   int
+		answer   string // value of the first answer, if it is not empty
+		noAuthor bool   // answer is a referral, so it is not authoritative
+	}{
+		{name: "www.example.com.", qtype: dns.TypeA, answers: 1},
+		{name: "www.example.com.", qtype: dns.TypeAAAA, answers: 1, answer: "2001:db8::10"},
+		{name: "blog.example.com.", qtype: dns.TypeCNAME, answers: 1, answer: "www.example.com."},
+		{name: "blog.example.com.", qtype: dns.TypeA, answers: 1, answer: "www.example.com."},
+		{name: "example.com.", qtype: dns.TypeMX, answers: 1, answer: "mail.example.com."},
+		{name: "example.com.", qtype: dns.TypeNS, answers: 1, answer: "ns1.example.com."},
+		{name: "example.com.", qtype: dns.TypeTXT, answers: 1, answer: "v=spf1 mx -all"},
+		{name: "example.com.", qtype: dns.TypeSOA, answers: 1},
+		{name: "_sip._tcp.example.com.", qtype: dns.TypeSRV, answers: 1},
+
+		// A set without any active address fall back to the CNAME of the name
+		{name: "legacy.example.com.", qtype: dns.TypeA, answers: 1, answer: "www.example.com."},
+		{name: "legacy.example.com.", qtype: dns.TypeAAAA, answers: 1, answer: "www.example.com."},
+
+		// NXDOMAIN and NODATA carry SOA of the zone
+		{name: "missing.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, authNs: 1},
+		{name: "www.example.com.", qtype: dns.TypeTXT, authNs: 1},
+		{name: "www.other.org.", qtype: dns.TypeA, rcode: dns.RcodeRefused},
+
+		// wildcards match the names below them, but not the empty non-terminals and their children
+		{name: "x.apps.example.com.", qtype: dns.TypeA, answers: 1, answer: "192.0.2.20"},
+		{name: "api.team.apps.example.com.", qtype: dns.TypeA, answers: 1, answer: "192.0.2.30"},
+		{name: "team.apps.example.com.", qtype: dns.TypeA, authNs: 1},
+		{name: "x.team.apps.example.com.", qtype: dns.TypeA, rcode: dns.RcodeNameError, authNs: 1},
+
+		// names of a delegated zone are referred to its nameservers
+		{name: "www.sub.example.com.", qtype: dns.TypeA, authNs: 1, noAuthor: true},
+		{name: "sub.example.com.", qtype: dns.TypeA, authNs: 1, noAuthor: true},
+	}
+	for _, test := range tests {
+		r := exchange(t, addr, test.name, test.qtype)
+		qtype := dns.TypeToString[test.qtype]
+		if r.Rcode != test.rcode {
+			t.Errorf("%s %s: expected rcode %s, got %s", test.name, qtype,
+				dns.RcodeToString[test.rcode], dns.RcodeToString[r.Rcode])
+			continue
+		}
+		if len(r.Answer) != test.answers || len(r.Ns) != test.authNs {
+			t.Errorf("%s %s: expected %d answers and %d authority records, got %v", test.name, qtype,
+				test.answers, test.authNs, r)
+			continue
+		}
+		if test.rcode != dns.RcodeRefused && r.Authoritative == test.noAuthor {
+			t.Errorf("%s %s: unexpected authoritative flag %v", test.name, qtype, r.Authoritative)
+		}
+		if test.answer != "" && rrValue(r.Answer[0]) != test.answer {
+			t.Errorf("%s %s: expected %s, got %v", test.name, qtype, test.answer, r.Answer[0])
+		}
+	}
+}
+
+func TestE2EReferralGlue(t *testing.T) {
+	addr := startFixtureServer(t)
+	r := exchange(t, addr, "www.sub.example.com.", dns.TypeA)
+	if len(r.Ns) != 1 || r.Ns[0].Header().Name != "sub.example.com." || rrValue(r.Ns[0]) != "ns1.sub.example.com." {
+		t.Fatalf("Expected a referral to ns1.sub.example.com, got %v", r)
+	}
+	if len(r.Extra) != 1 || r.Extra[0].Header().Name != "ns1.sub.example.com." || rrValue(r.Extra[0]) != "192.0.2.53" {
+		t.Fatalf("Expected glue of ns1.sub.example.com, got %v", r.Extra)
+	}
+}
+
+func TestE2EWeightedSet(t *testing.T) {
+	addr := startFixtureServer(t)
+	// www has a weighted A set, so every answer has one of its addresses selected by weight(3:1)
+	counts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		r := exchange(t, addr, "www.example.com.", dns.TypeA)
+		if len(r.Answer) != 1 {
+			t.Fatalf("Expected one address of the weighted set, got %v", r.Answer)
+		}
+		counts[rrValue(r.Answer[0])]++
+	}
+	if len(counts) != 2 || counts["192.0.2.10"] <= counts["192.0.2.11"] {
+		t.Fatalf("Expected both addresses, selected by their weight, got %v", counts)
+	}
+}
+
+func TestE2ETCP(t *testing.T) {
+	_, addr := startFixtureServers(t)
+	r := exchangeNet(t, "tcp", addr, "www.example.com.", dns.TypeAAAA)
+	if len(r.Answer) != 1 || rrValue(r.Answer[0]) != "2001:db8::10" || !r.Authoritative {
+		t.Fatalf("Expected the AAAA record over TCP, got %v", r)
+	}
+	r = exchangeNet(t, "tcp", addr, "missing.example.com.", dns.TypeA)
+	if r.Rcode != dns.RcodeNameError || len(r.Ns) != 1 {
+		t.Fatalf("Expected NXDOMAIN over TCP, got %v", r)
+	}
+}
+
+func TestE2EWildcardOwnerName(t *testing.T) {
+	addr := startFixtureServer(t)
+	r := exchange(t, addr, "x.apps.example.com.", dns.TypeA)
+	if len(r.Answer) != 1 || r.Answer[0].Header().Name != "x.apps.example.com." {
+		t.Fatalf("Expected wildcard answer to be owned by the query name, got %v", r.Answer)
+	}
+}
+
+func rrValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.CNAME:
+		return rr.Target
+	case *dns.NS:
+		return rr.Ns
+	case *dns.MX:
+		return rr.Mx
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	default:
+		return rr.String()
+	}
+}
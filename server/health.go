@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devops-simba/redns/definitions"
+	"github.com/devops-simba/redns/definitions/healthcheck"
+)
+
+// HealthStore is a database that the health check runner read the addresses from it and write
+// their health back to it
+type HealthStore interface {
+	// GetRecordKeys return keys of all of the records
+	GetRecordKeys() ([]string, error)
+	// GetRecords read records of the keys in a single round trip, records of the missing keys are nil
+	GetRecords(keys []string) ([]*definitions.DNSRecord, error)
+	// SetHealthy atomically set healthy flag of the addresses of a record that have the kind and
+	// the value, it returns `false` if no address changed
+	SetHealthy(key, kind, value string, healthy bool) (bool, error)
+	// PublishHealthEvent publish a change of the health of an address
+	PublishHealthEvent(event definitions.HealthEvent) error
+}
+
+type HealthCheckConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ScanInterval is the interval of reading the records to find the addresses that should be checked
+	ScanInterval time.Duration `yaml:"scanInterval"`
+	// Interval is the default interval between checks of an address
+	Interval time.Duration `yaml:"interval"`
+	// Timeout is the default timeout of a check
+	Timeout time.Duration `yaml:"timeout"`
+	// Rise and Fall are the default thresholds of the checks
+	Rise uint16 `yaml:"rise"`
+	Fall uint16 `yaml:"fall"`
+	// Workers is the maximum number of the concurrent checks
+	Workers int `yaml:"workers"`
+}
+
+// setHealthy set healthy flag of the addresses of a record that have the kind and the value
+func setHealthy(record *definitions.DNSRecord, kind, value string, healthy bool) bool {
+	changed := false
+	now := time.Now().UTC()
+	for _, address := range record.GetAddresses() {
+		base := address.BaseAddress()
+		if address.GetKind() == kind && address.GetValue() == value && base.Healthy != healthy {
+			base.Healthy, base.HealthChanged = healthy, &now
+			changed = true
+		}
+	}
+	return changed
+}
+
+// healthTarget is an address that should be checked
+type healthTarget struct {
+	key     string
+	kind    string
+	value   string
+	check   definitions.HealthCheck
+	checker healthcheck.HealthChecker
+
+	healthy   bool
+	lastCheck time.Time
+	lastError error
+	rtt       time.Duration
+	successes uint16
+	failures  uint16
+	nextCheck time.Time
+	running   bool
+}
+
+// HealthStatus is the state of the checks of an address
+type HealthStatus struct {
+	Key       string    `json:"key"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Type      string    `json:"type"`
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"lastCheck,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	// RTT is the round trip time of the last successful check in milliseconds
+	RTT float64 `json:"rttMs"`
+}
+
+func (this *healthTarget) id() string {
+	return this.key + "|" + this.kind + "|" + this.value
+}
+
+// checkTarget return the target of the check, the check is validated by the scan
+func (this *healthTarget) checkTarget() string {
+	target, _ := this.check.GetTarget(this.value)
+	return target
+}
+
+// HealthCheckRunner periodically check the addresses that have a health check and update their
+// healthy flag, after `Rise` consecutive successes or `Fall` consecutive failures
+type HealthCheckRunner struct {
+	store   HealthStore
+	config  HealthCheckConfig
+	workers chan struct{}
+
+	mutex   sync.Mutex
+	targets map[string]*healthTarget
+	// emptyIndexLogged is `true` if it is logged that there is no record key to check
+	emptyIndexLogged bool
+}
+
+func NewHealthCheckRunner(store HealthStore, config HealthCheckConfig) *HealthCheckRunner {
+	return &HealthCheckRunner{
+		store:   store,
+		config:  config,
+		workers: make(chan struct{}, config.Workers),
+		targets: make(map[string]*healthTarget),
+	}
+}
+
+// Run check the addresses until `stop` closed
+func (this *HealthCheckRunner) Run(stop <-chan struct{}) {
+	err := this.Scan()
+	if err != nil {
+		log.Printf("[ERR] Error in reading health checks: %v", err)
+	}
+
+	scanTicker := time.NewTicker(this.config.ScanInterval)
+	defer scanTicker.Stop()
+	checkTicker := time.NewTicker(time.Second)
+	defer checkTicker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-scanTicker.C:
+			err := this.Scan()
+			if err != nil {
+				log.Printf("[ERR] Error in reading health checks: %v", err)
+			}
+		case now := <-checkTicker.C:
+			this.checkDue(now, stop)
+		}
+	}
+}
+
+// Scan read the records and update the targets, state of the targets that still exist is kept
+func (this *HealthCheckRunner) Scan() error {
+	keys, err := this.store.GetRecordKeys()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 && !this.emptyIndexLogged {
+		log.Printf("[WRN] There is no record to check, records that are written by the older versions " +
+			"are only checked after `redns_cli reindex`")
+		this.emptyIndexLogged = true
+	}
+	records, err := this.store.GetRecords(keys)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]*healthTarget)
+	for i, record := range records {
+		for _, address := range record.GetAddresses() {
+			base := address.BaseAddress()
+			if base.HealthCheck == nil {
+				continue
+			}
+
+			target := &healthTarget{
+				key:     keys[i],
+				kind:    address.GetKind(),
+				value:   address.GetValue(),
+				check:   *base.HealthCheck,
+				healthy: base.Healthy,
+			}
+			err := target.check.Validate()
+			if err == nil {
+				_, err = target.check.GetTarget(target.value)
+			}
+			if err != nil {
+				log.Printf("[WRN] Invalid health check for %s(%s) of %s: %v",
+					target.value, target.kind, target.key, err)
+				continue
+			}
+			target.checker = healthcheck.Get(target.check.Type)
+			if target.check.Rise == 0 {
+				target.check.Rise = this.config.Rise
+			}
+			if target.check.Fall == 0 {
+				target.check.Fall = this.config.Fall
+			}
+			found[target.id()] = target
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for id, target := range found {
+		if current, ok := this.targets[id]; ok {
+			current.check = target.check
+			current.checker = target.checker
+			// somebody else(for example an operator) may change the flag
+			if !current.running {
+				current.healthy = target.healthy
+			}
+			found[id] = current
+		}
+	}
+	this.targets = found
+	return nil
+}
+
+// Status return state of the checks of all of the addresses
+func (this *HealthCheckRunner) Status() []HealthStatus {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	result := make([]HealthStatus, 0, len(this.targets))
+	for _, target := range this.targets {
+		status := HealthStatus{
+			Key:       target.key,
+			Kind:      target.kind,
+			Value:     target.value,
+			Type:      target.check.Type,
+			Healthy:   target.healthy,
+			LastCheck: target.lastCheck,
+			RTT:       float64(target.rtt) / float64(time.Millisecond),
+		}
+		if target.lastError != nil {
+			status.LastError = target.lastError.Error()
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Key != result[j].Key {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result
+}
+
+func (this *HealthCheckRunner) interval(target *healthTarget) time.Duration {
+	if target.check.Interval != 0 {
+		return time.Duration(target.check.Interval) * time.Second
+	}
+	return this.config.Interval
+}
+func (this *HealthCheckRunner) timeout(check *definitions.HealthCheck) time.Duration {
+	if check.Timeout != 0 {
+		return time.Duration(check.Timeout) * time.Second
+	}
+	return this.config.Timeout
+}
+func (this *HealthCheckRunner) checkDue(now time.Time, stop <-chan struct{}) {
+	var due []*healthTarget
+	this.mutex.Lock()
+	for _, target := range this.targets {
+		if !target.running && !now.Before(target.nextCheck) {
+			target.running = true
+			due = append(due, target)
+		}
+	}
+	this.mutex.Unlock()
+
+	for _, target := range due {
+		select {
+		case this.workers <- struct{}{}:
+		case <-stop:
+			return
+		}
+		go func(target *healthTarget) {
+			defer func() { <-this.workers }()
+			this.check(target)
+		}(target)
+	}
+}
+
+// check run the check of a target and update its health if a threshold reached
+func (this *HealthCheckRunner) check(target *healthTarget) {
+	// check settings may be changed by a scan while we are checking
+	this.mutex.Lock()
+	checker, check, checkTarget := target.checker, target.check, target.checkTarget()
+	this.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), this.timeout(&check))
+	start := time.Now()
+	var rtt time.Duration
+	var err error
+	if measurer, ok := checker.(healthcheck.Measurer); ok {
+		rtt, err = measurer.Measure(ctx, &check, checkTarget)
+	} else {
+		err = checker.Check(ctx, &check, checkTarget)
+		rtt = time.Since(start)
+	}
+	cancel()
+	ok := err == nil
+
+	this.mutex.Lock()
+	target.lastCheck = start
+	target.lastError = err
+	if ok {
+		target.rtt = rtt
+	}
+	target.nextCheck = time.Now().Add(this.interval(target))
+	changed := false
+	if ok {
+		target.failures = 0
+		target.successes++
+		changed = !target.healthy && target.successes >= target.check.Rise
+	} else {
+		target.successes = 0
+		target.failures++
+		changed = target.healthy && target.failures >= target.check.Fall
+	}
+	if changed {
+		target.healthy = ok
+		target.successes = 0
+		target.failures = 0
+	}
+	this.mutex.Unlock()
+
+	if changed {
+		this.update(target, ok, err)
+	}
+
+	this.mutex.Lock()
+	target.running = false
+	this.mutex.Unlock()
+}
+func (this *HealthCheckRunner) update(target *healthTarget, healthy bool, checkErr error) {
+	updated, err := this.store.SetHealthy(target.key, target.kind, target.value, healthy)
+	if err != nil {
+		log.Printf("[ERR] Error in updating health of %s(%s) of %s: %v", target.value, target.kind, target.key, err)
+		return
+	}
+	if !updated {
+		return
+	}
+
+	if healthy {
+		log.Printf("[INF] %s(%s) of %s is now healthy", target.value, target.kind, target.key)
+	} else {
+		log.Printf("[INF] %s(%s) of %s is now unhealthy: %v", target.value, target.kind, target.key, checkErr)
+	}
+	err = this.store.PublishHealthEvent(definitions.HealthEvent{
+		Key:     target.key,
+		Kind:    target.kind,
+		Value:   target.value,
+		Healthy: healthy,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		log.Printf("[ERR] Error in publishing health event of %s(%s) of %s: %v", target.value, target.kind, target.key, err)
+	}
+}
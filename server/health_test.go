@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// fakeChecker is a health checker that return a result that is set by the test
+type fakeChecker struct {
+	mutex   sync.Mutex
+	healthy bool
+	calls   int
+	targets []string
+}
+
+func (this *fakeChecker) Check(ctx context.Context, check *definitions.HealthCheck, target string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.calls++
+	this.targets = append(this.targets, target)
+	if !this.healthy {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+func (this *fakeChecker) set(healthy bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.healthy = healthy
+}
+func (this *fakeChecker) callCount() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.calls
+}
+
+// eventRecorder is a health store that keep the published events
+type eventRecorder struct {
+	*MemoryDNSDatabase
+	mutex  sync.Mutex
+	events []definitions.HealthEvent
+}
+
+func (this *eventRecorder) PublishHealthEvent(event definitions.HealthEvent) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.events = append(this.events, event)
+	return nil
+}
+func (this *eventRecorder) eventCount() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return len(this.events)
+}
+
+// newTestRunner create a runner for a record with a single health checked address, checks of the
+// address are done by the returned checker
+func newTestRunner(t *testing.T, address definitions.DNS_Address) (*HealthCheckRunner, *eventRecorder, *fakeChecker) {
+	store := &eventRecorder{MemoryDNSDatabase: NewMemoryDNSDatabase()}
+	store.SetRecord("www.example.com", &definitions.DNSRecord{Domain: "example.com", ARecords: &definitions.DNS_A_Record{
+		Addresses: []definitions.DNS_A_Address{{DNS_IP_Address: definitions.DNS_IP_Address{IP: "192.0.2.1", DNS_Address: address}}},
+	}})
+	config := DefaultConfig().HealthCheck
+	config.Interval = time.Hour
+	runner := NewHealthCheckRunner(store, config)
+	if err := runner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.targets) != 1 {
+		t.Fatalf("Expected one target, got %d", len(runner.targets))
+	}
+	checker := &fakeChecker{healthy: address.Healthy}
+	for _, target := range runner.targets {
+		target.checker = checker
+	}
+	return runner, store, checker
+}
+
+// runDue run the checks that are due at `now` and wait for them to finish
+func runDue(t *testing.T, runner *HealthCheckRunner, now time.Time) {
+	runner.checkDue(now, nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		running := false
+		runner.mutex.Lock()
+		for _, target := range runner.targets {
+			running = running || target.running
+		}
+		runner.mutex.Unlock()
+		if !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Checks did not finish in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func isHealthy(store *eventRecorder) bool {
+	record, _ := store.GetRecords([]string{"www.example.com"})
+	return record[0].ARecords.Addresses[0].Healthy
+}
+
+func TestHealthRunnerRiseAndFall(t *testing.T) {
+	runner, store, checker := newTestRunner(t, definitions.DNS_Address{Enabled: true, Healthy: true,
+		HealthCheck: &definitions.HealthCheck{Type: "tcp", Target: "192.0.2.1:80", Rise: 2, Fall: 3}})
+	now := time.Now()
+	next := func() time.Time {
+		now = now.Add(2 * time.Hour)
+		return now
+	}
+
+	checker.set(false)
+	for i := 0; i < 2; i++ {
+		runDue(t, runner, next())
+		if !isHealthy(store) || store.eventCount() != 0 {
+			t.Fatalf("Address became unhealthy after %d failures", i+1)
+		}
+	}
+	// a success reset the failures
+	checker.set(true)
+	runDue(t, runner, next())
+	checker.set(false)
+	for i := 0; i < 2; i++ {
+		runDue(t, runner, next())
+		if !isHealthy(store) {
+			t.Fatalf("Address became unhealthy after %d failures", i+1)
+		}
+	}
+	runDue(t, runner, next())
+	if isHealthy(store) || store.eventCount() != 1 || store.events[0].Healthy {
+		t.Fatalf("Expected the address to be unhealthy after 3 failures, events: %v", store.events)
+	}
+
+	checker.set(true)
+	runDue(t, runner, next())
+	if isHealthy(store) || store.eventCount() != 1 {
+		t.Fatal("Address became healthy after 1 success")
+	}
+	runDue(t, runner, next())
+	if !isHealthy(store) || store.eventCount() != 2 {
+		t.Fatalf("Expected the address to be healthy after 2 successes, events: %v", store.events)
+	}
+	event := store.events[1]
+	if event.Key != "www.example.com" || event.Kind != definitions.Kind_A || event.Value != "192.0.2.1" || !event.Healthy {
+		t.Fatalf("Unexpected event: %+v", event)
+	}
+	if record, _ := store.GetRecords([]string{"www.example.com"}); record[0].ARecords.Addresses[0].HealthChanged == nil {
+		t.Fatal("Change time of the health is not set")
+	}
+}
+
+func TestHealthRunnerCheckDue(t *testing.T) {
+	runner, _, checker := newTestRunner(t, definitions.DNS_Address{Enabled: true, Healthy: true,
+		HealthCheck: &definitions.HealthCheck{Type: "tcp", Target: "192.0.2.1:80", Interval: 60}})
+	now := time.Now()
+	runDue(t, runner, now)
+	if checker.callCount() != 1 {
+		t.Fatalf("Expected the first check to be due, got %d checks", checker.callCount())
+	}
+	runDue(t, runner, now.Add(30*time.Second))
+	if checker.callCount() != 1 {
+		t.Fatal("Address is checked before its interval")
+	}
+	runDue(t, runner, now.Add(2*time.Minute))
+	if checker.callCount() != 2 {
+		t.Fatalf("Expected the check to be due after its interval, got %d checks", checker.callCount())
+	}
+}
+
+func TestHealthRunnerDefaultTarget(t *testing.T) {
+	runner, _, checker := newTestRunner(t, definitions.DNS_Address{Enabled: true, Healthy: true,
+		HealthCheck: &definitions.HealthCheck{Type: "http"}})
+	runDue(t, runner, time.Now())
+	if len(checker.targets) != 1 || checker.targets[0] != "http://192.0.2.1/" {
+		t.Fatalf("Expected the check to use URL of the address, got %v", checker.targets)
+	}
+
+	// tcp has no default port, so the check is ignored
+	store := NewMemoryDNSDatabase()
+	store.SetRecord("www.example.com", &definitions.DNSRecord{Domain: "example.com", ARecords: &definitions.DNS_A_Record{
+		Addresses: []definitions.DNS_A_Address{{DNS_IP_Address: definitions.DNS_IP_Address{IP: "192.0.2.1",
+			DNS_Address: definitions.DNS_Address{Enabled: true, Healthy: true, HealthCheck: &definitions.HealthCheck{Type: "tcp"}}}}},
+	}})
+	runner = NewHealthCheckRunner(store, DefaultConfig().HealthCheck)
+	if err := runner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.targets) != 0 {
+		t.Fatal("Expected tcp check without a port to be ignored")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+type LogLevel int32
+
+const (
+	LogLevel_Error LogLevel = iota
+	LogLevel_Warning
+	LogLevel_Info
+)
+
+var logLevelTags = []string{"[ERR]", "[WRN]", "[INF]"}
+var glogThresholds = []string{"ERROR", "WARNING", "INFO"}
+
+func ParseLogLevel(value string) (LogLevel, error) {
+	switch strings.ToLower(value) {
+	case "error", "err":
+		return LogLevel_Error, nil
+	case "warning", "warn", "wrn":
+		return LogLevel_Warning, nil
+	case "info", "inf", "":
+		return LogLevel_Info, nil
+	default:
+		return LogLevel_Info, fmt.Errorf("Invalid log level: %s", value)
+	}
+}
+
+// LevelWriter is a writer for the standard logger that drop messages that their level(that specified
+// by a tag like `[WRN]` at start of the message) is above the current level
+type LevelWriter struct {
+	writer io.Writer
+	level  int32
+}
+
+func NewLevelWriter(writer io.Writer, level LogLevel) *LevelWriter {
+	return &LevelWriter{writer: writer, level: int32(level)}
+}
+
+// SetLevel change level of this writer and threshold of the glog messages that written to stderr
+func (this *LevelWriter) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&this.level, int32(level))
+	flag.Set("stderrthreshold", glogThresholds[level])
+}
+func (this *LevelWriter) Write(buffer []byte) (int, error) {
+	level := LogLevel(atomic.LoadInt32(&this.level))
+	for i := level + 1; int(i) < len(logLevelTags); i++ {
+		if bytes.Contains(buffer, []byte(logLevelTags[i])) {
+			return len(buffer), nil
+		}
+	}
+	return this.writer.Write(buffer)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/devops-simba/redns/definitions"
+)
+
+// Lookup hold the records that read from a database while resolving a message, so every key is
+// read at most once and keys of all of the questions can be read in a single round trip
+type Lookup struct {
+	database DNSDatabase
+	records  map[string]*definitions.DNSRecord
+}
+
+func NewLookup(database DNSDatabase) *Lookup {
+	return &Lookup{
+		database: database,
+		records:  make(map[string]*definitions.DNSRecord),
+	}
+}
+
+// Prefetch read the keys that are not read yet in a single round trip
+func (this *Lookup) Prefetch(keys ...string) error {
+	var missing []string
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := this.records[key]; ok {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		missing = append(missing, key)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	records, err := this.database.GetRecords(missing)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(missing); i++ {
+		this.records[missing[i]] = records[i]
+	}
+	return nil
+}
+
+// FindRecord find records of a name in a zone, using wildcards of the zone if the name does not exist.
+// It returns `nil` if the name does not exist and an empty record if the name only exists
+// as an empty non-terminal.
+func (this *Lookup) FindRecord(name string, zone string) (*definitions.DNSRecord, error) {
+	keys := definitions.GetLookupKeys(name, zone)
+	err := this.Prefetch(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]bool, len(keys))
+	for i := 0; i < len(keys); i++ {
+		found[i] = this.records[keys[i]] != nil
+	}
+
+	index, exists := definitions.SelectLookupKey(keys, found)
+	if index == -1 {
+		if exists {
+			return &definitions.DNSRecord{}, nil
+		}
+		return nil, nil
+	}
+	return this.records[keys[index]], nil
+}
+
+// FindExactRecord find records of a name without using the wildcards, it returns `nil` if the name
+// does not have any record
+func (this *Lookup) FindExactRecord(name string) (*definitions.DNSRecord, error) {
+	key := definitions.NameToRedisKey(name)
+	err := this.Prefetch(key)
+	if err != nil {
+		return nil, err
+	}
+	return this.records[key], nil
+}
+
+// FindDelegation find the delegation point(a name below the zone apex that has NS records) that
+// the name belong to, it returns an empty key if name is not delegated
+func (this *Lookup) FindDelegation(name string, zone string) (string, *definitions.DNSRecord, error) {
+	keys := definitions.GetDelegationKeys(name, zone)
+	err := this.Prefetch(keys...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, key := range keys {
+		record := this.records[key]
+		if record != nil && !record.NSRecords.LimitToActive().IsEmpty() {
+			return key, record, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// QuestionKeys return all of the keys that may be required to answer a question about a name in a zone
+func QuestionKeys(name string, zone string) []string {
+	return append(definitions.GetDelegationKeys(name, zone), definitions.GetLookupKeys(name, zone)...)
+}
@@ -2,43 +2,309 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	stdlog "log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 
 	log "github.com/golang/glog"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+var (
+	configPath     = flag.String("config", "", "Path of the YAML configuration file, settings may be overridden by `REDNS_*` environment variables and flags")
+	port           = flag.Uint("port", 53, "Port that we should listen on it(UDP on all IPv4 addresses), replaces the configured listeners")
+	listen         = flag.String("listen", "", "Comma separated list of listeners in `transport://host:port[/path]` format, transport may be udp, tcp, tls, https or http")
+	redisServerUrl = flag.String("redis", "", "Address of the redis server in format `redis://[:password]@]host:port[/db-number][?option=value]`")
+	zoneList       = flag.String("zones", "", "Not supported, zones are the DNSDomain objects that their settings are in the redis")
+	adminAddr      = flag.String("admin", "", "Address of the admin HTTP server(health, readiness and debug endpoints), empty disable the server")
+	tlsCert        = flag.String("tls-cert", "", "Path of the TLS certificate file, required by DNS over TLS and DNS over HTTPS")
+	tlsKey         = flag.String("tls-key", "", "Path of the TLS private key file, required by DNS over TLS and DNS over HTTPS")
+	tlsReload      = flag.Duration("tls-reload", 0, "Interval of checking TLS certificate files for changes")
+	zonesRefresh   = flag.Duration("zones-refresh", 0, "Interval of reloading the zones from the redis")
+	dotPort        = flag.Uint("dot-port", 0, "Port of DNS over TLS listener(on all IPv4 addresses), replaces the configured DNS over TLS listeners and 0 remove them")
+	dohPort        = flag.Uint("doh-port", 0, "Port of DNS over HTTPS listener(on all IPv4 addresses), replaces the configured DNS over HTTPS listeners and 0 remove them")
+	dohPath        = flag.String("doh-path", defaultDoHPath, "Path that DNS over HTTPS requests will be served on it")
+	dohPlain       = flag.Bool("doh-plain", false, "Serve DNS over HTTPS requests over plain HTTP, for use behind a TLS terminating proxy")
+	logLevel       = flag.String("log-level", "", "Level of the logs, one of error, warning or info")
 )
 
 func main() {
-	port := flag.Uint("port", 53, "Port that we should listen on it")
-	redisServerUrl := flag.String("redis", "", "Address of the redis server in format `redis://[:password]@]host:port[/db-number][?option=value]`")
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
-	if *port == 0 || *port > 65535 {
-		log.Fatalf("%v is not a valid port number", *port)
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Error in loading configuration: %v", err)
 	}
-	if len(*redisServerUrl) == 0 {
-		log.Fatal("Missing redis db address")
+
+	level, _ := ParseLogLevel(config.LogLevel)
+	logWriter := NewLevelWriter(os.Stderr, level)
+	stdlog.SetOutput(logWriter)
+	logWriter.SetLevel(level)
+
+	backend, err := OpenDatabase(config.Backend)
+	if err != nil {
+		log.Fatalf("Error in opening the database: %v", err)
 	}
+	db := NewCachedDatabase(backend, config.Cache)
 
-	db, err := NewRedisDNSDatabase(*redisServerUrl)
+	zones := NewZoneSet()
+	err = LoadZones(db, zones)
 	if err != nil {
-		log.Fatalf("Error in opening REDIS db: %v", err)
+		log.Fatalf("Error in loading zones: %v", err)
+	}
+	if zones.Len() == 0 {
+		log.Warningf("No zone is configured, all queries will be refused until a zone is added to `%s`",
+			definitions.ZonesKey)
+	}
+
+	var healthRunner *HealthCheckRunner
+	if config.HealthCheck.Enabled {
+		store, ok := backend.(HealthStore)
+		if !ok {
+			log.Fatal("Backend does not support health checks")
+		}
+
+		stopHealthCheck := make(chan struct{})
+		defer close(stopHealthCheck)
+		healthRunner = NewHealthCheckRunner(store, config.HealthCheck)
+		go healthRunner.Run(stopHealthCheck)
 	}
 
 	stopRequestedChan := make(chan os.Signal, 1)
 	signal.Notify(stopRequestedChan, syscall.SIGINT, syscall.SIGTERM)
+	reloadRequestedChan := make(chan os.Signal, 1)
+	signal.Notify(reloadRequestedChan, syscall.SIGHUP)
+
+	server := NewDNSServer(db, zones, config.SOA)
+	server.SetTTL(config.TTL)
+	err = server.CheckZones()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	stopZoneRefresh := make(chan struct{})
+	defer close(stopZoneRefresh)
+	go RefreshZones(db, zones, config.ZonesRefresh, server.CheckZones, stopZoneRefresh)
+
+	var certificate *CertificateReloader
+	if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+		certificate, err = NewCertificateReloader(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			log.Fatalf("Error in loading TLS certificate: %v", err)
+		}
+
+		stopCertificateWatch := make(chan struct{})
+		defer close(stopCertificateWatch)
+		go certificate.Watch(config.TLS.Reload, stopCertificateWatch)
+	}
+	addListeners(server, config.Listeners, certificate)
+
+	if config.Admin != "" {
+		adminServer := &http.Server{Addr: config.Admin, Handler: NewAdminHandler(server, healthRunner)}
+		defer adminServer.Close()
+		go func() {
+			err := adminServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.Errorf("Error in running admin server: %v", err)
+			}
+		}()
+	}
 
-	server := NewDNSServer(db, strconv.Itoa(int(*port)), "udp")
 	serverStopped := runServer(server)
-	select {
-	case <-stopRequestedChan:
-		log.Info("Got OS shutdown signal, shutting down DNS server gracefully...")
-		server.Shutdown()
+	for {
+		select {
+		case <-reloadRequestedChan:
+			newConfig, err := loadConfig()
+			if err != nil {
+				log.Errorf("Error in reloading configuration, keep using the current one: %v", err)
+				continue
+			}
+			if changed := config.RestartRequired(newConfig); len(changed) != 0 {
+				log.Warningf("Changes of %s are ignored, they require a restart", strings.Join(changed, ", "))
+			}
+
+			level, _ := ParseLogLevel(newConfig.LogLevel)
+			logWriter.SetLevel(level)
+			server.SetSOA(newConfig.SOA)
+			server.SetTTL(newConfig.TTL)
+			db.Configure(newConfig.Cache)
+			err = LoadZones(db, zones)
+			if err != nil {
+				log.Errorf("Error in reloading zones: %v", err)
+			}
+			err = server.CheckZones()
+			if err != nil {
+				log.Errorf("Invalid configuration: %v", err)
+			}
+
+			config.LogLevel = newConfig.LogLevel
+			config.SOA = newConfig.SOA
+			config.TTL = newConfig.TTL
+			config.Cache = newConfig.Cache
+			log.Info("Configuration reloaded")
+
+		case <-stopRequestedChan:
+			log.Info("Got OS shutdown signal, shutting down DNS server gracefully...")
+			server.Shutdown()
+			return
+
+		case err = <-serverStopped:
+			log.Warningf("Server stopped unexpectedly: %v", err)
+			return
+		}
+	}
+}
+
+// loadConfig load the configuration file and apply overrides of the flags that are set explicitly
+func loadConfig() (*Config, error) {
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "port":
+			if *port == 0 || *port > 65535 {
+				err = fmt.Errorf("%v is not a valid port number", *port)
+				return
+			}
+			config.Listeners = []ListenerConfig{{
+				Transport: Transport_UDP,
+				Address:   net.JoinHostPort("0.0.0.0", strconv.Itoa(int(*port))),
+			}}
+		case "listen":
+			config.Listeners, err = ParseListeners(*listen)
+		case "redis":
+			config.Backend = *redisServerUrl
+		case "zones":
+			config.Zones = splitList(*zoneList)
+		case "admin":
+			config.Admin = *adminAddr
+		case "tls-cert":
+			config.TLS.CertFile = *tlsCert
+		case "tls-key":
+			config.TLS.KeyFile = *tlsKey
+		case "tls-reload":
+			config.TLS.Reload = *tlsReload
+		case "zones-refresh":
+			config.ZonesRefresh = *zonesRefresh
+		case "log-level":
+			config.LogLevel = *logLevel
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// they are applied after `port` and `listen`, so they add to the listeners of those flags
+	err = applyEncryptedListenerFlags(config, set)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyEncryptedListenerFlags apply the DNS over TLS and DNS over HTTPS flags(`set` is the flags that
+// are set explicitly) to the listeners of a configuration. A port replaces the listeners of its
+// transport, `doh-path` and `doh-plain` change the DNS over HTTPS listeners.
+func applyEncryptedListenerFlags(config *Config, set map[string]bool) error {
+	if *dotPort > 65535 || *dohPort > 65535 {
+		return fmt.Errorf("Invalid port number for DNS over TLS or DNS over HTTPS")
+	}
+	if set["dot-port"] {
+		config.Listeners = withoutTransports(config.Listeners, Transport_TLS)
+		if *dotPort != 0 {
+			config.Listeners = append(config.Listeners, ListenerConfig{
+				Transport: Transport_TLS,
+				Address:   net.JoinHostPort("0.0.0.0", strconv.Itoa(int(*dotPort))),
+			})
+		}
+	}
+	if set["doh-port"] {
+		config.Listeners = withoutTransports(config.Listeners, Transport_HTTPS, Transport_HTTP)
+		if *dohPort != 0 {
+			config.Listeners = append(config.Listeners, ListenerConfig{
+				Transport: Transport_HTTPS,
+				Address:   net.JoinHostPort("0.0.0.0", strconv.Itoa(int(*dohPort))),
+			})
+		}
+	}
+	for i := range config.Listeners {
+		listener := &config.Listeners[i]
+		if transport := strings.ToLower(listener.Transport); transport != Transport_HTTPS && transport != Transport_HTTP {
+			continue
+		}
+		if set["doh-path"] || set["doh-port"] {
+			listener.Path = *dohPath
+		}
+		if set["doh-plain"] || set["doh-port"] {
+			listener.Transport = Transport_HTTPS
+			if *dohPlain {
+				listener.Transport = Transport_HTTP
+			}
+		}
+	}
+	return nil
+}
+func withoutTransports(listeners []ListenerConfig, transports ...string) []ListenerConfig {
+	var result []ListenerConfig
+outer:
+	for _, listener := range listeners {
+		for _, transport := range transports {
+			if strings.ToLower(listener.Transport) == transport {
+				continue outer
+			}
+		}
+		result = append(result, listener)
+	}
+	return result
+}
 
-	case err = <-serverStopped:
-		log.Warningf("Server stopped unexpectedly: %v", err)
+// OpenDatabase open the database that specified by a backend URL, `file://path` load an in-memory
+// database from a JSON fixture file and other URLs are REDIS servers
+func OpenDatabase(backend string) (DNSDatabase, error) {
+	if strings.HasPrefix(backend, "file://") {
+		return LoadMemoryDNSDatabase(strings.TrimPrefix(backend, "file://"))
+	}
+	return NewRedisDNSDatabase(backend)
+}
+
+func addListeners(server *DNSServer, listeners []ListenerConfig, certificate *CertificateReloader) {
+	for _, listener := range listeners {
+		switch listener.Transport {
+		case Transport_UDP:
+			server.AddListener(listener.Address, "udp", nil)
+		case Transport_TCP:
+			server.AddListener(listener.Address, "tcp", nil)
+		case Transport_TLS:
+			server.AddListener(listener.Address, "tcp-tls", certificate.TLSConfig())
+		case Transport_HTTPS:
+			server.AddDoHListener(listener.Address, listener.Path, certificate.TLSConfig())
+		case Transport_HTTP:
+			server.AddDoHListener(listener.Address, listener.Path, nil)
+		}
+		log.Infof("Listening on %s://%s%s", listener.Transport, listener.Address, listener.Path)
 	}
 }
 
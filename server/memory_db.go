@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// MemoryDNSDatabase is a DNSDatabase that keep its records in memory, records are keyed exactly
+// like the REDIS database
+type MemoryDNSDatabase struct {
+	mutex        sync.RWMutex
+	serialNumber uint32
+	records      map[string]*definitions.DNSRecord
+	zones        map[string]*definitions.ZoneInfo
+	// nonTerminals is the number of the descendants of the names that have one, by their key
+	nonTerminals map[string]int
+}
+
+func NewMemoryDNSDatabase() *MemoryDNSDatabase {
+	return &MemoryDNSDatabase{
+		records:      make(map[string]*definitions.DNSRecord),
+		zones:        make(map[string]*definitions.ZoneInfo),
+		nonTerminals: make(map[string]int),
+	}
+}
+
+// MemoryDNSFixture is the JSON format of the content of a MemoryDNSDatabase, records are keyed
+// exactly like the REDIS database and their values use the same format as REDIS values
+type MemoryDNSFixture struct {
+	SerialNumber uint32                            `json:"serialNumber"`
+	Zones        map[string]*definitions.ZoneInfo  `json:"zones"`
+	Records      map[string]*definitions.DNSRecord `json:"records"`
+}
+
+// LoadMemoryDNSDatabase create a database from a JSON fixture file
+func LoadMemoryDNSDatabase(path string) (*MemoryDNSDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := NewMemoryDNSDatabase()
+	err = db.Load(file)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid fixture `%s`: %v", path, err)
+	}
+	return db, nil
+}
+
+// Load add content of a JSON fixture to this database
+func (this *MemoryDNSDatabase) Load(reader io.Reader) error {
+	var fixture MemoryDNSFixture
+	err := json.NewDecoder(reader).Decode(&fixture)
+	if err != nil {
+		return err
+	}
+	for key, record := range fixture.Records {
+		if record == nil {
+			return fmt.Errorf("Missing value for `%s`", key)
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if fixture.SerialNumber != 0 {
+		this.serialNumber = fixture.SerialNumber
+	}
+	for zone, info := range fixture.Zones {
+		this.zones[zone] = info
+	}
+	for key, record := range fixture.Records {
+		this.setRecord(key, record)
+	}
+	return nil
+}
+
+// SetRecord add or replace records of a key, nil record remove the key
+func (this *MemoryDNSDatabase) SetRecord(key string, record *definitions.DNSRecord) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.setRecord(key, record)
+}
+func (this *MemoryDNSDatabase) setRecord(key string, record *definitions.DNSRecord) {
+	_, exists := this.records[key]
+	if record == nil {
+		if exists {
+			delete(this.records, key)
+			for _, ancestor := range definitions.GetAncestorKeys(key) {
+				if this.nonTerminals[ancestor]--; this.nonTerminals[ancestor] == 0 {
+					delete(this.nonTerminals, ancestor)
+				}
+			}
+		}
+		return
+	}
+	this.records[key] = record
+	if !exists {
+		for _, ancestor := range definitions.GetAncestorKeys(key) {
+			this.nonTerminals[ancestor]++
+		}
+	}
+}
+
+// SetZone add a zone with its settings, zones without settings(nil info) are not authoritative
+func (this *MemoryDNSDatabase) SetZone(zone string, info *definitions.ZoneInfo) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.zones[zone] = info
+}
+func (this *MemoryDNSDatabase) RemoveZone(zone string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.zones, zone)
+}
+func (this *MemoryDNSDatabase) SetSerialNumber(serialNumber uint32) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.serialNumber = serialNumber
+}
+func (this *MemoryDNSDatabase) GetSerialNumber() (uint32, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.serialNumber, nil
+}
+func (this *MemoryDNSDatabase) GetRecords(keys []string) ([]*definitions.DNSRecord, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	records := make([]*definitions.DNSRecord, len(keys))
+	for i, key := range keys {
+		if strings.HasPrefix(key, definitions.NonTerminalKeyPrefix) {
+			if this.nonTerminals[key[len(definitions.NonTerminalKeyPrefix):]] != 0 {
+				records[i] = &definitions.DNSRecord{}
+			}
+			continue
+		}
+		records[i] = this.records[key]
+	}
+	return records, nil
+}
+func (this *MemoryDNSDatabase) GetZones() (map[string]*definitions.ZoneInfo, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	zones := make(map[string]*definitions.ZoneInfo, len(this.zones))
+	for zone, info := range this.zones {
+		if info != nil {
+			zones[zone] = info
+		}
+	}
+	return zones, nil
+}
+func (this *MemoryDNSDatabase) GetRecordKeys() ([]string, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	keys := make([]string, 0, len(this.records))
+	for key := range this.records {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+func (this *MemoryDNSDatabase) SetHealthy(key, kind, value string, healthy bool) (bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	record, ok := this.records[key]
+	if !ok {
+		return false, nil
+	}
+	return setHealthy(record, kind, value, healthy), nil
+}
+func (this *MemoryDNSDatabase) PublishHealthEvent(event definitions.HealthEvent) error {
+	return nil
+}
@@ -6,7 +6,7 @@ import (
 	"log"
 	"net"
 	"strconv"
-	"strings"
+	"sync"
 
 	"github.com/elcuervo/redisurl"
 	"github.com/hoisie/redis"
@@ -14,10 +14,16 @@ import (
 	"github.com/devops-simba/redns/definitions"
 )
 
-const serialNumberKey = "dns-server-serial-no"
+const (
+	serialNumberKey = "dns-server-serial-no"
+)
 
 type RedisDNSDatabase struct {
 	redis.Client
+
+	mutex sync.Mutex
+	// zonesWithoutInfo are the zones that are logged for having no metadata, so they are logged once
+	zonesWithoutInfo map[string]bool
 }
 
 func NewRedisDNSDatabase(url string) (*RedisDNSDatabase, error) {
@@ -30,22 +36,14 @@ func NewRedisDNSDatabase(url string) (*RedisDNSDatabase, error) {
 	_, err := db.GetSerialNumber() // open connection
 	return db, err
 }
-func (this *RedisDNSDatabase) lookup(key string) (*definitions.DNSRecord, error) {
-	lowerKey := strings.ToLower(key)
-	bytearr, err := this.Get(lowerKey)
+func (this *RedisDNSDatabase) parseRecord(key string, value []byte) (*definitions.DNSRecord, error) {
+	r := &definitions.DNSRecord{}
+	err := json.Unmarshal(value, r)
 	if err != nil {
+		log.Printf("[ERR] Error in unmarshaling data that received from redis: %s: %v", key, err)
 		return nil, err
 	}
-	if bytearr != nil {
-		r := &definitions.DNSRecord{}
-		err = json.Unmarshal(bytearr, r)
-		if err != nil {
-			log.Printf("[ERR] Error in unmarshaling data that received from redis: %s: %v", key, err)
-			return nil, err
-		}
-		return r, nil
-	}
-	return nil, nil
+	return r, nil
 }
 func (this *RedisDNSDatabase) GetSerialNumber() (uint32, error) {
 	sn, err := this.Get(serialNumberKey)
@@ -57,26 +55,128 @@ func (this *RedisDNSDatabase) GetSerialNumber() (uint32, error) {
 	}
 	return binary.LittleEndian.Uint32(sn), nil
 }
-func (this *RedisDNSDatabase) FindRecord(key string, qType uint16) (*definitions.DNSRecord, error) {
-	record, err := this.lookup(key)
+func (this *RedisDNSDatabase) GetRecords(keys []string) ([]*definitions.DNSRecord, error) {
+	records := make([]*definitions.DNSRecord, len(keys))
+	if len(keys) == 0 {
+		return records, nil
+	}
+
+	values, err := this.Mget(keys...)
 	if err != nil {
 		return nil, err
 	}
-	if record != nil {
-		return record, nil
+	// an invalid value only hides its own record, parseRecord already logged it
+	for i := 0; i < len(keys) && i < len(values); i++ {
+		if values[i] == nil {
+			continue
+		}
+		records[i], _ = this.parseRecord(keys[i], values[i])
+	}
+	return records, nil
+}
+func (this *RedisDNSDatabase) GetZones() (map[string]*definitions.ZoneInfo, error) {
+	members, err := this.Smembers(definitions.ZonesKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return map[string]*definitions.ZoneInfo{}, nil
+	}
+
+	keys := make([]string, len(members))
+	for i := 0; i < len(members); i++ {
+		keys[i] = definitions.GetZoneInfoKey(string(members[i]))
+	}
+	values, err := this.Mget(keys...)
+	if err != nil {
+		return nil, err
 	}
 
-	parts := strings.Split(key, ".")
-	if len(parts) > 2 {
-		parts[0] = "$" // replace '*' with '$' so we does not mess with REDIS escape chars
-		record, err = this.lookup(strings.Join(parts, "."))
+	// we are only authoritative for the zones that have metadata
+	zones := make(map[string]*definitions.ZoneInfo, len(members))
+	withoutInfo := make(map[string]bool)
+	for i := 0; i < len(members); i++ {
+		if i >= len(values) || values[i] == nil {
+			withoutInfo[string(members[i])] = true
+			continue
+		}
+		info := &definitions.ZoneInfo{}
+		err = json.Unmarshal(values[i], info)
 		if err != nil {
-			return nil, err
+			log.Printf("[ERR] Error in unmarshaling settings of zone %s, ignoring the zone: %v", members[i], err)
+			continue
+		}
+		zones[string(members[i])] = info
+	}
+	this.logZonesWithoutInfo(withoutInfo)
+	return zones, nil
+}
+
+// logZonesWithoutInfo warn about the zones that are not served since they have no metadata, every
+// zone is logged when it is first seen without metadata
+func (this *RedisDNSDatabase) logZonesWithoutInfo(zones map[string]bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for zone := range zones {
+		if !this.zonesWithoutInfo[zone] {
+			log.Printf("[WRN] Zone %s has no settings(%s), it is not served until they are written",
+				zone, definitions.GetZoneInfoKey(zone))
 		}
-		if record != nil {
-			return record, nil
+	}
+	this.zonesWithoutInfo = zones
+}
+
+// GetRecordKeys return keys of the records from the index of the record keys, that writers maintain
+func (this *RedisDNSDatabase) GetRecordKeys() ([]string, error) {
+	members, err := this.Smembers(definitions.RecordKeysKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(members))
+	for _, member := range members {
+		result = append(result, string(member))
+	}
+	return result, nil
+}
+
+// SetHealthy set healthy flag of the addresses of a record that have the kind and the value, it
+// returns `false` if no address changed
+func (this *RedisDNSDatabase) SetHealthy(key, kind, value string, healthy bool) (bool, error) {
+	lock, err := definitions.LockKey(this, key, definitions.LockTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err := lock.Unlock()
+		if err != nil {
+			log.Printf("[ERR] Error in releasing lock of %s: %v", key, err)
 		}
+	}()
+
+	content, err := this.Get(key)
+	if err != nil {
+		// record removed
+		return false, nil
+	}
+	record, err := this.parseRecord(key, content)
+	if err != nil {
+		return false, err
 	}
 
-	return nil, nil
+	if !setHealthy(record, kind, value, healthy) {
+		return false, nil
+	}
+	content, err = json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	return true, this.Set(key, content)
+}
+func (this *RedisDNSDatabase) PublishHealthEvent(event definitions.HealthEvent) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return this.Publish(definitions.HealthEventsChannel, content)
 }
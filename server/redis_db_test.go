@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// newTestRedisDatabase connect to the redis in `REDNS_TEST_REDIS`(for example `redis://localhost:6379/15`),
+// the test is skipped when it is not set. Content of the database will be overwritten.
+func newTestRedisDatabase(tb testing.TB) *RedisDNSDatabase {
+	url := os.Getenv("REDNS_TEST_REDIS")
+	if url == "" {
+		tb.Skip("REDNS_TEST_REDIS is not set")
+	}
+	db, err := NewRedisDNSDatabase(url)
+	if err != nil {
+		tb.Fatalf("Error in connecting to redis: %v", err)
+	}
+	return db
+}
+
+func writeTestRecords(tb testing.TB, db *RedisDNSDatabase, count int) []string {
+	keys := make([]string, count)
+	for i := range keys {
+		address := definitions.DNS_A_Address{}
+		address.IP, address.Enabled = "10.0.0."+strconv.Itoa(i%250+1), true
+		record := &definitions.DNSRecord{
+			ARecords: &definitions.DNS_A_Record{Addresses: []definitions.DNS_A_Address{address}},
+		}
+		value, err := json.Marshal(record)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		keys[i] = definitions.NameToRedisKey("host-" + strconv.Itoa(i) + ".bench.example.com.")
+		if err = db.Set(keys[i], value); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestRedisGetRecordsSkipInvalidValue(t *testing.T) {
+	db := newTestRedisDatabase(t)
+	keys := writeTestRecords(t, db, 3)
+	if err := db.Set(keys[1], []byte("{invalid")); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := db.GetRecords(keys)
+	if err != nil {
+		t.Fatalf("An invalid value failed the batch: %v", err)
+	}
+	if records[0] == nil || records[1] != nil || records[2] == nil {
+		t.Fatalf("Expected only the invalid record to be missing, got %v", records)
+	}
+}
+
+// BenchmarkRedisGetRecords compare the batched lookup of the records of a query with looking up each key
+func BenchmarkRedisGetRecords(b *testing.B) {
+	db := newTestRedisDatabase(b)
+	keys := writeTestRecords(b, db, 6)
+
+	b.Run("Batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetRecords(keys); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("PerKey", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				value, err := db.Get(key)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if value != nil {
+					db.parseRecord(key, value)
+				}
+			}
+		}
+	})
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
-	"math/rand"
+	"net"
+	"net/http"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/dns"
 
@@ -14,23 +20,82 @@ type DNSRecordType string
 
 type DNSDatabase interface {
 	GetSerialNumber() (uint32, error)
-	FindRecord(name string, qType uint16) (*definitions.DNSRecord, error)
+	// GetRecords read records of the keys in a single round trip, records of the missing keys are nil
+	GetRecords(keys []string) ([]*definitions.DNSRecord, error)
+	// GetZones get the zones that this server is authoritative for along with their settings(zone
+	// metadata), zones that have no metadata are not returned
+	GetZones() (map[string]*definitions.ZoneInfo, error)
 }
 
 type DNSServer struct {
-	server   *dns.Server
-	database DNSDatabase
+	servers     []*dns.Server
+	httpServers []*http.Server
+	database    DNSDatabase
+	selector    *Selector
+	zones       *ZoneSet
+	soa         atomic.Value // SOAConfig
+	ttl         atomic.Value // TTLConfig
 }
 
-func NewDNSServer(database DNSDatabase, port, net string) *DNSServer {
+func NewDNSServer(database DNSDatabase, zones *ZoneSet, soa SOAConfig) *DNSServer {
 	server := &DNSServer{
-		server:   &dns.Server{Addr: "0.0.0.0:" + port, Net: net},
 		database: database,
+		selector: NewSelector(time.Now().UnixNano()),
+		zones:    zones,
 	}
-	server.server.Handler = server
+	server.SetSOA(soa)
+	server.SetTTL(DefaultConfig().TTL)
 	return server
 }
 
+// SetSOA change the defaults that used in SOA records, it is safe to call it while server is running
+func (this *DNSServer) SetSOA(soa SOAConfig) {
+	this.soa.Store(soa)
+}
+func (this *DNSServer) getSOA() SOAConfig {
+	return this.soa.Load().(SOAConfig)
+}
+
+// SetTTL change the limits of the TTLs, it is safe to call it while server is running
+func (this *DNSServer) SetTTL(ttl TTLConfig) {
+	this.ttl.Store(ttl)
+}
+func (this *DNSServer) getTTL(zone string) TTLConfig {
+	return this.ttl.Load().(TTLConfig).ForZone(this.zones.Info(zone))
+}
+
+// AddListener add a DNS listener to this server, `net` may be `udp`, `tcp` or `tcp-tls`
+func (this *DNSServer) AddListener(addr, net string, tlsConfig *tls.Config) {
+	this.servers = append(this.servers, &dns.Server{
+		Addr:      addr,
+		Net:       net,
+		TLSConfig: tlsConfig,
+		Handler:   this,
+	})
+}
+
+// AddConnListener add a DNS listener that serve requests of an already opened connection or
+// listener(only one of them should be provided). It is useful for listening on ephemeral ports.
+func (this *DNSServer) AddConnListener(conn net.PacketConn, listener net.Listener) {
+	this.servers = append(this.servers, &dns.Server{
+		PacketConn: conn,
+		Listener:   listener,
+		Handler:    this,
+	})
+}
+
+// AddDoHListener add a DNS over HTTPS listener to this server that serve the requests on `path`.
+// If `tlsConfig` is nil, listener use plain HTTP, that is useful behind a TLS terminating proxy.
+func (this *DNSServer) AddDoHListener(addr, path string, tlsConfig *tls.Config) {
+	mux := http.NewServeMux()
+	mux.Handle(path, DoHHandler{Handler: this})
+	this.httpServers = append(this.httpServers, &http.Server{
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	})
+}
+
 func (this *DNSServer) getSerialNumber() uint32 {
 	sn, err := this.database.GetSerialNumber()
 	if err != nil {
@@ -40,167 +105,340 @@ func (this *DNSServer) getSerialNumber() uint32 {
 	return sn
 }
 func (this *DNSServer) ServeDNS(w dns.ResponseWriter, msg *dns.Msg) {
+	m := this.Resolve(msg, getClientIP(w))
+	err := w.WriteMsg(m)
+	if err != nil {
+		log.Printf("[ERR] failed to write message: %v", err)
+	}
+}
+
+// Resolve create the response of a message
+func (this *DNSServer) Resolve(msg *dns.Msg, clientIP net.IP) *dns.Msg {
 	m := new(dns.Msg)
 	m.SetReply(msg)
 	m.Authoritative = true
 	m.RecursionAvailable = false
-	for _, question := range msg.Question {
+	nameExists := false
+	refused := false
+	negativeZone := ""
+
+	// read every key that any of the questions may need in a single round trip
+	lookup := NewLookup(this.database)
+	questionZones := make([]string, len(msg.Question))
+	var keys []string
+	for i, question := range msg.Question {
+		qName := strings.TrimSuffix(question.Name, ".")
+		zone, ok := this.zones.FindZone(qName)
+		if ok {
+			questionZones[i] = zone
+			keys = append(keys, QuestionKeys(qName, zone)...)
+		}
+	}
+	err := lookup.Prefetch(keys...)
+	if err != nil {
+		log.Printf("[ERR] Error in reading records: %v", err)
+	}
+
+	for i, question := range msg.Question {
 		qtype := dns.TypeToString[question.Qtype]
 		//log.Printf("[INF] %v %v", qtype, question.Name)
 
-		qName := question.Name
-		if strings.HasSuffix(qName, ".") {
-			qName = qName[:len(qName)-1]
+		qName := strings.TrimSuffix(question.Name, ".")
+		zone := questionZones[i]
+		if zone == "" {
+			refused = true
+			continue
 		}
-		record, err := this.database.FindRecord(qName, question.Qtype)
+		if negativeZone == "" {
+			negativeZone = zone
+		}
+
+		cut, delegation, err := lookup.FindDelegation(qName, zone)
+		if err != nil {
+			log.Printf("[ERR] Error in finding delegation of %s: %v", qName, err)
+			continue
+		}
+		if delegation != nil {
+			this.addReferral(m, lookup, cut, delegation, this.getTTL(zone))
+			nameExists = true
+			continue
+		}
+
+		record, err := lookup.FindRecord(qName, zone)
 		if err != nil {
 			log.Printf("[ERR] Error in finding record %s(%s): %v", qtype, qName, err)
 			continue
 		}
+		isApex := strings.ToLower(qName) == zone
 		if record == nil {
-			log.Printf("[WRN] No record found for %s(%s)", qtype, qName)
+			if !isApex {
+				log.Printf("[WRN] No record found for %s(%s)", qtype, qName)
+				continue
+			}
+			// zone apex always exists, even if it does not have any record
+			record = &definitions.DNSRecord{}
+		}
+		nameExists = true
+
+		info := this.zones.Info(zone)
+		if !info.AllowsType(qtype) {
+			// the name exists, but this type is not served in the zone, so the answer is NODATA
 			continue
 		}
 
+		var rrs []dns.RR
+		ttl := activeTTL(recordSet(record, question.Qtype))
 		switch question.Qtype {
 		case dns.TypeA:
-			m.Answer = append(m.Answer, A(question.Name, record)...)
+			rrs = this.selector.A(question.Name, record, clientIP)
 		case dns.TypeAAAA:
-			m.Answer = append(m.Answer, AAAA(question.Name, record)...)
+			rrs = this.selector.AAAA(question.Name, record, clientIP)
 		case dns.TypeCNAME:
-			m.Answer = append(m.Answer, CNAME(question.Name, record)...)
+			rrs = this.selector.CNAME(question.Name, record, clientIP)
 		case dns.TypeNS:
-			m.Answer = append(m.Answer, NS(question.Name, record)...)
+			rrs = this.selector.NS(question.Name, record, clientIP)
+			if len(rrs) == 0 && isApex {
+				rrs = zoneNS(question.Name, info, this.getSOA().TTL)
+				ttl = rrsetTTL(rrs)
+			}
 		case dns.TypeTXT:
-			m.Answer = append(m.Answer, TXT(question.Name, record)...)
+			rrs = this.selector.TXT(question.Name, record, clientIP)
 		case dns.TypeMX:
-			m.Answer = append(m.Answer, MX(question.Name, record)...)
+			rrs = this.selector.MX(question.Name, record, clientIP)
 		case dns.TypeSRV:
-			m.Answer = append(m.Answer, SRV(question.Name, record)...)
+			rrs = this.selector.SRV(question.Name, record, clientIP)
 		case dns.TypeSOA:
-			m.Answer = append(m.Answer, SOA(question.Name, record, this.getSerialNumber())...)
+			if isApex {
+				rrs = this.SOA(question.Name, zone, false)
+				ttl = rrsetTTL(rrs)
+			}
 		default:
 			log.Printf("[WRN] Invalid question type: %v %v", qtype, qName)
 		}
+		m.Answer = append(m.Answer, this.getTTL(zone).NormalizeRRSet(rrs, ttl, usesFailover(record, question.Qtype))...)
 	}
 
-	if len(m.Answer) == 0 {
-		m.Rcode = dns.RcodeNameError
-		m.Answer = append(m.Answer, SOA(".", &definitions.DNSRecord{
-			NSRecords: &definitions.DNS_NS_Record{
-				Addresses: []definitions.DNS_NS_Address{
-					definitions.DNS_NS_Address{
-						DNS_STR_Address: definitions.DNS_STR_Address{
-							Value: "dns.cloud.snapp.ir",
-						},
-					},
-				},
-			},
-		}, this.getSerialNumber())...)
+	if refused && len(m.Answer) == 0 && len(m.Ns) == 0 {
+		// we are not authoritative for any of the questions
+		m.Rcode = dns.RcodeRefused
+		m.Authoritative = false
+	} else if len(m.Answer) == 0 && len(m.Ns) == 0 {
+		// a name that exists with other types is NODATA, not NXDOMAIN
+		if !nameExists {
+			m.Rcode = dns.RcodeNameError
+		}
+		// RFC 2308: negative answers carry SOA of the zone in the authority section
+		if negativeZone != "" {
+			m.Ns = append(m.Ns, this.SOA(dns.Fqdn(negativeZone), negativeZone, true)...)
+		}
 	}
 
-	err := w.WriteMsg(m)
-	if err != nil {
-		log.Printf("[ERR] failed to write message: %v", err)
-	}
+	return m
 }
-func (this *DNSServer) Start() error    { return this.server.ListenAndServe() }
-func (this *DNSServer) Shutdown() error { return this.server.Shutdown() }
 
-func WeightedSelect(rec definitions.IDNSAddressRecord) definitions.IDNSAddress {
-	if rec.IsEmpty() {
-		panic("This function should only called on non-empty records")
-	}
+// addReferral add a referral to a delegated zone to the message
+func (this *DNSServer) addReferral(m *dns.Msg, lookup *Lookup, cut string, delegation *definitions.DNSRecord, ttl TTLConfig) {
+	m.Authoritative = false
 
-	addresses := rec.AddressList()
-	if len(addresses) == 1 {
-		return addresses[0]
-	}
+	nsRecords := delegation.NSRecords.LimitToActive()
+	m.Ns = append(m.Ns, ttl.NormalizeRRSet(nsRecords.ToRRList(dns.Fqdn(definitions.RedisKeyToName(cut))),
+		activeTTL(nsRecords), false)...)
 
-	overallWeight := 0
-	for i := 0; i < len(addresses); i++ {
-		overallWeight += int(addresses[i].BaseAddress().Weight)
+	// glue is only required for the name servers that are inside of the delegated zone
+	var targets []string
+	var keys []string
+	for _, ns := range nsRecords.AddressList() {
+		target := strings.ToLower(strings.TrimSuffix(ns.GetValue(), "."))
+		if target == cut || strings.HasSuffix(target, "."+cut) {
+			targets = append(targets, target)
+			keys = append(keys, definitions.NameToRedisKey(target))
+		}
+	}
+	err := lookup.Prefetch(keys...)
+	if err != nil {
+		log.Printf("[ERR] Error in reading glue records of %s: %v", cut, err)
+		return
 	}
 
-	n := rand.Int31n(int32(overallWeight))
-
-	index := 0
-	for i := 0; i < len(addresses); i++ {
-		weight := int32(addresses[i].BaseAddress().Weight)
-		if n < weight {
-			index = i
-			break
+	for _, target := range targets {
+		// glue only come from the records of the name itself, never from a wildcard
+		glue, err := lookup.FindExactRecord(target)
+		if err != nil {
+			log.Printf("[ERR] Error in finding glue records of %s: %v", target, err)
+			continue
+		}
+		if glue == nil {
+			log.Printf("[WRN] Missing glue records for %s", target)
+			continue
 		}
 
-		n -= weight
+		for _, set := range []definitions.IDNSAddressRecord{glue.ARecords, glue.AAAARecords} {
+			active := set.LimitToActive()
+			m.Extra = append(m.Extra, ttl.NormalizeRRSet(active.ToRRList(dns.Fqdn(target)), activeTTL(active), false)...)
+		}
 	}
-
-	return addresses[index]
 }
-func ToRR(name string, rec definitions.IDNSAddressRecord, rec2 definitions.IDNSAddressRecord) []dns.RR {
-	activeRec := rec.LimitToActive()
-	if activeRec.IsEmpty() {
-		if rec2 != nil {
-			activeRec := rec2.LimitToActive()
-			if activeRec.IsEmpty() {
-				return nil
+
+// Start start all of the listeners and wait until one of them stopped
+func (this *DNSServer) Start() error {
+	stopped := make(chan error, len(this.servers)+len(this.httpServers))
+	for _, server := range this.servers {
+		go func(server *dns.Server) {
+			if server.PacketConn != nil || server.Listener != nil {
+				stopped <- server.ActivateAndServe()
+			} else {
+				stopped <- server.ListenAndServe()
 			}
-		} else {
-			return nil
-		}
+		}(server)
+	}
+	for _, server := range this.httpServers {
+		go func(server *http.Server) {
+			if server.TLSConfig == nil {
+				stopped <- server.ListenAndServe()
+			} else {
+				stopped <- server.ListenAndServeTLS("", "")
+			}
+		}(server)
 	}
+	return <-stopped
+}
 
-	if activeRec.IsWeighted() {
-		return []dns.RR{WeightedSelect(activeRec).ToRR(name)}
+// Shutdown stop all of the listeners and return the first error
+func (this *DNSServer) Shutdown() error {
+	var result error
+	for _, server := range this.servers {
+		err := server.Shutdown()
+		if err != nil && result == nil {
+			result = err
+		}
 	}
+	for _, server := range this.httpServers {
+		err := server.Shutdown(context.Background())
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
 
-	return activeRec.ToRRList(name)
+func getClientIP(w dns.ResponseWriter) net.IP {
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
 }
 
-func A(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.ARecords, record.CNameRecords)
+func (this *Selector) A(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.ARecords, record.CNameRecords, clientIP)
 }
-func AAAA(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.AAAARecords, record.CNameRecords)
+func (this *Selector) AAAA(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.AAAARecords, record.CNameRecords, clientIP)
 }
-func CNAME(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.CNameRecords, nil)
+func (this *Selector) CNAME(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.CNameRecords, nil, clientIP)
 }
-func NS(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.NSRecords, nil)
+func (this *Selector) NS(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.NSRecords, nil, clientIP)
 }
-func TXT(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.TXTRecords, nil)
+func (this *Selector) TXT(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.TXTRecords, nil, clientIP)
 }
-func MX(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.MXRecords, nil)
+func (this *Selector) MX(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.MXRecords, nil, clientIP)
 }
-func SRV(name string, record *definitions.DNSRecord) []dns.RR {
-	return ToRR(name, record.SRVRecords, nil)
+func (this *Selector) SRV(name string, record *definitions.DNSRecord, clientIP net.IP) []dns.RR {
+	return this.ToRR(name, record.SRVRecords, nil, clientIP)
 }
 
-func SOA(name string, record *definitions.DNSRecord, serialNumber uint32) []dns.RR {
-	nsRecord := record.NSRecords.LimitToActive()
-	if nsRecord.IsEmpty() {
+// SOA create the SOA record of a zone, using settings of the zone and the configured defaults.
+// TTL and minimum TTL of the negative SOA records are the negative TTL of the zone, or the minimum
+// TTL of the zone if negative TTL is not configured(RFC 2308).
+func (this *DNSServer) SOA(name string, zone string, negative bool) []dns.RR {
+	soa := this.getSOA()
+	nameserver := soa.Nameserver
+	mbox := soa.Mailbox
+	refresh, retry, expire := soa.Refresh, soa.Retry, soa.Expire
+	if info := this.zones.Info(zone); info != nil {
+		if primary := info.PrimaryNameserver(); primary != "" {
+			nameserver = primary
+		}
+		if info.Mailbox != "" {
+			mbox = info.Mailbox
+		}
+		if info.Refresh != 0 {
+			refresh = info.Refresh
+		}
+		if info.Retry != 0 {
+			retry = info.Retry
+		}
+		if info.Expire != 0 {
+			expire = info.Expire
+		}
+	}
+	if nameserver == "" {
+		log.Printf("[ERR] No nameserver is configured for zone %s", zone)
 		return nil
 	}
+	if mbox == "" {
+		// RFC 2142
+		mbox = "hostmaster." + zone
+	}
 
-	mbox := ""
-	mxRecord := record.MXRecords.LimitToActive()
-	if !mxRecord.IsEmpty() {
-		mbox = mxRecord.AddressList()[0].GetValue()
+	ttl := soa.TTL
+	minTTL := soa.MinTTL
+	if negative {
+		if negativeTTL := this.getTTL(zone).Negative; negativeTTL != 0 {
+			ttl = negativeTTL
+			minTTL = negativeTTL
+		} else if minTTL < ttl {
+			ttl = minTTL
+		}
 	}
 
 	return []dns.RR{
 		&dns.SOA{
-			Hdr:     dns.RR_Header{Name: name, Class: dns.ClassINET, Rrtype: dns.TypeSOA, Ttl: 60},
-			Ns:      dns.Fqdn(nsRecord.AddressList()[0].GetValue()),
-			Mbox:    mbox,
-			Serial:  serialNumber,
-			Refresh: 86400,
-			Retry:   7200,
-			Expire:  3600, // RFC1912 suggests 2-4 weeks 1209600-2419200
-			Minttl:  60,
+			Hdr:     dns.RR_Header{Name: name, Class: dns.ClassINET, Rrtype: dns.TypeSOA, Ttl: ttl},
+			Ns:      dns.Fqdn(nameserver),
+			Mbox:    dns.Fqdn(mbox),
+			Serial:  this.getSerialNumber(),
+			Refresh: refresh,
+			Retry:   retry,
+			Expire:  expire,
+			Minttl:  minTTL,
 		},
 	}
 }
+
+// zoneNS create NS records of the zone apex from the nameservers in the settings of the zone
+func zoneNS(name string, info *definitions.ZoneInfo, ttl uint32) []dns.RR {
+	if info == nil {
+		return nil
+	}
+	result := make([]dns.RR, 0, len(info.Nameservers))
+	for _, nameserver := range info.Nameservers {
+		result = append(result, &dns.NS{
+			Hdr: dns.RR_Header{Name: name, Class: dns.ClassINET, Rrtype: dns.TypeNS, Ttl: ttl},
+			Ns:  dns.Fqdn(nameserver),
+		})
+	}
+	return result
+}
+
+// CheckZones check that a nameserver is available for SOA records of all of the zones, from their
+// settings or the default SOA. Every zone has settings, since zones without them are not loaded.
+func (this *DNSServer) CheckZones() error {
+	if this.getSOA().Nameserver != "" {
+		return nil
+	}
+
+	missing := this.zones.WithoutNameserver()
+	if len(missing) != 0 {
+		return fmt.Errorf("No default nameserver is configured and zones %s do not have one in their settings",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
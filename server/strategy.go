@@ -0,0 +1,231 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// Selector select addresses of records that should be returned to the clients, based on the load
+// balancing strategy of each record. It is safe for concurrent use.
+type Selector struct {
+	mutex   sync.Mutex
+	random  *rand.Rand
+	counter uint32
+}
+
+// NewSelector create a new selector, selectors that created with the same seed produce same results
+// for same sequence of calls
+func NewSelector(seed int64) *Selector {
+	return &Selector{random: rand.New(rand.NewSource(seed))}
+}
+
+func (this *Selector) int63n(n int64) int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.random.Int63n(n)
+}
+func (this *Selector) nextCounter() uint32 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.counter++
+	return this.counter
+}
+
+// ToRR create resource records of the first of `rec` and `fallback` that has any active address
+func (this *Selector) ToRR(
+	name string,
+	rec definitions.IDNSAddressRecord,
+	fallback definitions.IDNSAddressRecord,
+	clientIP net.IP) []dns.RR {
+	activeRec := rec.LimitToActive()
+	if activeRec.IsEmpty() {
+		if fallback == nil {
+			return nil
+		}
+
+		activeRec = fallback.LimitToActive()
+		if activeRec.IsEmpty() {
+			return nil
+		}
+	}
+
+	addresses := this.Select(activeRec, clientIP)
+	result := make([]dns.RR, len(addresses))
+	for i := 0; i < len(addresses); i++ {
+		result[i] = addresses[i].ToRR(name)
+	}
+	return result
+}
+
+// Select select addresses of an active record based on its load balancing strategy
+func (this *Selector) Select(rec definitions.IDNSAddressRecord, clientIP net.IP) []definitions.IDNSAddress {
+	if rec.IsEmpty() {
+		return nil
+	}
+
+	switch rec.GetStrategy() {
+	case definitions.Strategy_Weighted:
+		return []definitions.IDNSAddress{this.WeightedSelect(rec.AddressList())}
+	case definitions.Strategy_RoundRobin:
+		return this.RoundRobinSelect(rec.AddressList())
+	case definitions.Strategy_TopN:
+		return TopNSelect(rec.AddressList(), int(rec.GetTopN()))
+	case definitions.Strategy_ClientHash:
+		return []definitions.IDNSAddress{ClientHashSelect(rec.AddressList(), clientIP)}
+	case definitions.Strategy_Failover:
+		return FailoverSelect(rec.AddressList())
+	default:
+		return rec.AddressList()
+	}
+}
+
+// WeightedSelect select one random address, probability of selecting each address is proportional
+// to its weight. Addresses with zero weight are only selected when no address has a positive weight
+// and in that case all addresses have the same chance.
+func (this *Selector) WeightedSelect(addresses []definitions.IDNSAddress) definitions.IDNSAddress {
+	if len(addresses) == 0 {
+		panic("This function should only called on non-empty address lists")
+	}
+	if len(addresses) == 1 {
+		return addresses[0]
+	}
+
+	weights := effectiveWeights(addresses)
+	overallWeight := int64(0)
+	for i := 0; i < len(weights); i++ {
+		overallWeight += weights[i]
+	}
+
+	n := this.int63n(overallWeight)
+	for i := 0; i < len(weights); i++ {
+		if n < weights[i] {
+			return addresses[i]
+		}
+		n -= weights[i]
+	}
+
+	// unreachable, `n` is always less than sum of the weights
+	return addresses[len(addresses)-1]
+}
+
+// RoundRobinSelect return all addresses, rotated by one position on each call
+func (this *Selector) RoundRobinSelect(addresses []definitions.IDNSAddress) []definitions.IDNSAddress {
+	length := len(addresses)
+	if length < 2 {
+		return addresses
+	}
+
+	offset := int(this.nextCounter() % uint32(length))
+	result := make([]definitions.IDNSAddress, 0, length)
+	result = append(result, addresses[offset:]...)
+	result = append(result, addresses[:offset]...)
+	return result
+}
+
+// TopNSelect return `n` addresses that have the highest weight, if `n` is 0 only one address will be returned.
+// Addresses with same weight keep their original order.
+func TopNSelect(addresses []definitions.IDNSAddress, n int) []definitions.IDNSAddress {
+	if n == 0 {
+		n = 1
+	}
+	if n >= len(addresses) {
+		return addresses
+	}
+
+	sorted := append([]definitions.IDNSAddress{}, addresses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].BaseAddress().Weight > sorted[j].BaseAddress().Weight
+	})
+	return sorted[:n]
+}
+
+// ClientHashSelect select one address using weighted rendezvous hashing of the client IP, so a client
+// will receive the same address as long as the set of addresses does not change
+func ClientHashSelect(addresses []definitions.IDNSAddress, clientIP net.IP) definitions.IDNSAddress {
+	if ip4 := clientIP.To4(); ip4 != nil {
+		clientIP = ip4
+	}
+
+	weights := effectiveWeights(addresses)
+	index := 0
+	bestScore := -1.0
+	for i := 0; i < len(addresses); i++ {
+		if weights[i] == 0 {
+			continue
+		}
+
+		h := fnv.New64a()
+		h.Write(clientIP)
+		h.Write([]byte(addresses[i].GetValue()))
+		// map the hash to (0, 1) and use it as a sample of an exponential distribution
+		u := (float64(mix64(h.Sum64())>>11) + 0.5) / (1 << 53)
+		score := float64(weights[i]) / -math.Log(u)
+		if score > bestScore {
+			bestScore = score
+			index = i
+		}
+	}
+
+	return addresses[index]
+}
+
+// mix64 is the finalizer of splitmix64. FNV does not spread the values that only differ in their last
+// bytes(like IPs of a subnet) over the high bits, so without it one address wins for all clients.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// FailoverSelect return all addresses of the lowest tier
+func FailoverSelect(addresses []definitions.IDNSAddress) []definitions.IDNSAddress {
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	tier := addresses[0].BaseAddress().Tier
+	for i := 1; i < len(addresses); i++ {
+		if addresses[i].BaseAddress().Tier < tier {
+			tier = addresses[i].BaseAddress().Tier
+		}
+	}
+
+	result := make([]definitions.IDNSAddress, 0, len(addresses))
+	for i := 0; i < len(addresses); i++ {
+		if addresses[i].BaseAddress().Tier == tier {
+			result = append(result, addresses[i])
+		}
+	}
+	return result
+}
+
+// effectiveWeights return the weights that should be used for selection, if all of the addresses
+// have zero weight, all of them considered to have the same weight
+func effectiveWeights(addresses []definitions.IDNSAddress) []int64 {
+	allZero := true
+	weights := make([]int64, len(addresses))
+	for i := 0; i < len(addresses); i++ {
+		weights[i] = int64(addresses[i].BaseAddress().Weight)
+		if weights[i] != 0 {
+			allZero = false
+		}
+	}
+
+	if allZero {
+		for i := 0; i < len(weights); i++ {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
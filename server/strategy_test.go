@@ -0,0 +1,244 @@
+package main
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"testing"
+	"testing/quick"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// quickConfig make the property tests reproducible
+var quickConfig = &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(1))}
+
+func newAddresses(weights []uint16, tiers []uint16) []definitions.IDNSAddress {
+	result := make([]definitions.IDNSAddress, len(weights))
+	for i, weight := range weights {
+		address := &definitions.DNS_A_Address{}
+		address.IP = "10.0.0." + strconv.Itoa(i+1)
+		address.Enabled, address.Healthy, address.Weight = true, true, weight
+		if tiers != nil {
+			address.Tier = tiers[i]
+		}
+		result[i] = address
+	}
+	return result
+}
+
+// smallWeights limit the generated weights, so the tests cover zero weights and small lists
+func smallWeights(raw []uint8) []uint16 {
+	if len(raw) > 8 {
+		raw = raw[:8]
+	}
+	result := make([]uint16, len(raw))
+	for i, weight := range raw {
+		result[i] = uint16(weight % 4)
+	}
+	return result
+}
+
+func indexOf(addresses []definitions.IDNSAddress, address definitions.IDNSAddress) int {
+	for i := range addresses {
+		if addresses[i] == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	selector := NewSelector(1)
+	addresses := newAddresses([]uint16{1, 3, 0}, nil)
+	counts := make([]int, len(addresses))
+	const samples = 40000
+	for i := 0; i < samples; i++ {
+		counts[indexOf(addresses, selector.WeightedSelect(addresses))]++
+	}
+	if counts[2] != 0 {
+		t.Fatalf("Zero weight address is selected %d times", counts[2])
+	}
+	if ratio := float64(counts[1]) / samples; ratio < 0.73 || ratio > 0.77 {
+		t.Fatalf("Address with weight 3 of 4 is selected with ratio %f", ratio)
+	}
+}
+
+func TestWeightedNeverSelectZeroWeight(t *testing.T) {
+	selector := NewSelector(1)
+	property := func(raw []uint8) bool {
+		weights := smallWeights(raw)
+		if len(weights) == 0 {
+			return true
+		}
+		addresses := newAddresses(weights, nil)
+		hasPositive := false
+		for _, weight := range weights {
+			hasPositive = hasPositive || weight != 0
+		}
+		for i := 0; i < 50; i++ {
+			index := indexOf(addresses, selector.WeightedSelect(addresses))
+			if index == -1 || (hasPositive && weights[index] == 0) {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWeightedAllZero(t *testing.T) {
+	selector := NewSelector(1)
+	addresses := newAddresses([]uint16{0, 0, 0, 0}, nil)
+	counts := make([]int, len(addresses))
+	const samples = 40000
+	for i := 0; i < samples; i++ {
+		counts[indexOf(addresses, selector.WeightedSelect(addresses))]++
+	}
+	for i, count := range counts {
+		if ratio := float64(count) / samples; ratio < 0.23 || ratio > 0.27 {
+			t.Fatalf("Address %d of zero weight addresses is selected with ratio %f", i, ratio)
+		}
+	}
+}
+
+func TestTopN(t *testing.T) {
+	property := func(raw []uint8, n uint8) bool {
+		weights := smallWeights(raw)
+		addresses := newAddresses(weights, nil)
+		count := int(n % 5)
+		result := TopNSelect(addresses, count)
+		if count == 0 {
+			count = 1
+		}
+		if count > len(addresses) {
+			count = len(addresses)
+		}
+		if len(result) != count {
+			return false
+		}
+		// no address that is left out may have a higher weight than a selected one
+		selected := make(map[definitions.IDNSAddress]bool)
+		minWeight := uint16(0xFFFF)
+		for _, address := range result {
+			selected[address] = true
+			if address.BaseAddress().Weight < minWeight {
+				minWeight = address.BaseAddress().Weight
+			}
+		}
+		for _, address := range addresses {
+			if !selected[address] && address.BaseAddress().Weight > minWeight {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientHashStability(t *testing.T) {
+	property := func(raw []uint8, ip [4]byte) bool {
+		weights := smallWeights(raw)
+		if len(weights) < 2 {
+			return true
+		}
+		addresses := newAddresses(weights, nil)
+		clientIP := net.IP(ip[:])
+		selected := ClientHashSelect(addresses, clientIP)
+		for i := 0; i < 10; i++ {
+			if ClientHashSelect(addresses, clientIP) != selected {
+				return false
+			}
+		}
+
+		// removing an address that is not selected does not move the client
+		for i := range addresses {
+			if addresses[i] == selected {
+				continue
+			}
+			rest := append(append([]definitions.IDNSAddress{}, addresses[:i]...), addresses[i+1:]...)
+			if ClientHashSelect(rest, clientIP) != selected {
+				return false
+			}
+			break
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientHashDistribution(t *testing.T) {
+	addresses := newAddresses([]uint16{1, 1, 2}, nil)
+	random := rand.New(rand.NewSource(1))
+	counts := make([]int, len(addresses))
+	const samples = 20000
+	for i := 0; i < samples; i++ {
+		ip := make(net.IP, 4)
+		random.Read(ip)
+		counts[indexOf(addresses, ClientHashSelect(addresses, ip))]++
+	}
+	if ratio := float64(counts[2]) / samples; ratio < 0.47 || ratio > 0.53 {
+		t.Fatalf("Address with weight 2 of 4 is selected for %f of the clients", ratio)
+	}
+}
+
+func TestFailoverTiers(t *testing.T) {
+	property := func(raw []uint8, rawTiers []uint8) bool {
+		weights := smallWeights(raw)
+		if len(weights) == 0 {
+			return FailoverSelect(nil) == nil
+		}
+		tiers := make([]uint16, len(weights))
+		lowest := uint16(0xFFFF)
+		for i := range tiers {
+			if i < len(rawTiers) {
+				tiers[i] = uint16(rawTiers[i] % 3)
+			}
+			if tiers[i] < lowest {
+				lowest = tiers[i]
+			}
+		}
+		addresses := newAddresses(weights, tiers)
+		result := FailoverSelect(addresses)
+		expected := 0
+		for _, tier := range tiers {
+			if tier == lowest {
+				expected++
+			}
+		}
+		if len(result) != expected {
+			return false
+		}
+		for _, address := range result {
+			if address.BaseAddress().Tier != lowest {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFailoverToNextTier(t *testing.T) {
+	selector := NewSelector(1)
+	record := &definitions.DNS_A_Record{Strategy: definitions.Strategy_Failover}
+	for _, address := range newAddresses([]uint16{1, 1, 1}, []uint16{0, 1, 1}) {
+		record.Addresses = append(record.Addresses, *address.(*definitions.DNS_A_Address))
+	}
+	if rrs := selector.ToRR("www.example.com.", record, nil, nil); len(rrs) != 1 {
+		t.Fatalf("Expected only the first tier, got %v", rrs)
+	}
+
+	record.Addresses[0].Healthy = false
+	if rrs := selector.ToRR("www.example.com.", record, nil, nil); len(rrs) != 2 {
+		t.Fatalf("Expected the second tier once the first one failed, got %v", rrs)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertificateReloader hold a certificate that loaded from files and reload it whenever the files change
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	_, err := reloader.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload load the certificate if its files changed since the last load
+func (this *CertificateReloader) Reload() (bool, error) {
+	certInfo, err := os.Stat(this.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(this.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	this.mutex.RLock()
+	changed := this.certificate == nil ||
+		!certInfo.ModTime().Equal(this.certModTime) ||
+		!keyInfo.ModTime().Equal(this.keyModTime)
+	this.mutex.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(this.certFile, this.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.certificate = &certificate
+	this.certModTime = certInfo.ModTime()
+	this.keyModTime = keyInfo.ModTime()
+	return true, nil
+}
+
+// Watch periodically check the files and reload the certificate until `stop` closed
+func (this *CertificateReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := this.Reload()
+			if err != nil {
+				// keep using the last certificate, files may be in the middle of an update
+				log.Printf("[ERR] Error in reloading TLS certificate from %s: %v", this.certFile, err)
+			} else if reloaded {
+				log.Printf("[INF] TLS certificate reloaded from %s", this.certFile)
+			}
+		}
+	}
+}
+
+func (this *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.certificate, nil
+}
+
+// TLSConfig create a TLS configuration that always use the last loaded certificate
+func (this *CertificateReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: this.GetCertificate,
+	}
+}
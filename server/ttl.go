@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// TTLConfig is the limits of the TTLs of the records that server return
+type TTLConfig struct {
+	// Min is the minimum TTL of the records, so a 0 TTL never reach the clients
+	Min uint32 `yaml:"min"`
+	// Max is the maximum TTL of the records
+	Max uint32 `yaml:"max"`
+	// Failover is the maximum TTL of the records that use the failover strategy, so clients
+	// notice failure of an address soon
+	Failover uint32 `yaml:"failover"`
+	// Default is the TTL of the records that have no TTL(0), 0 use the minimum TTL
+	Default uint32 `yaml:"default"`
+	// Negative is the TTL of the negative answers(NXDOMAIN and NODATA), 0 use minimum TTL of the SOA
+	Negative uint32 `yaml:"negative"`
+}
+
+// ForZone return the limits of a zone, settings of the zone override the defaults
+func (this TTLConfig) ForZone(info *definitions.ZoneInfo) TTLConfig {
+	if info == nil {
+		return this
+	}
+	if info.DefaultTTL != 0 {
+		this.Default = info.DefaultTTL
+	}
+	if info.MinTTL != 0 {
+		this.Min = info.MinTTL
+	}
+	if info.MaxTTL != 0 {
+		this.Max = info.MaxTTL
+	}
+	if info.NegativeTTL != 0 {
+		this.Negative = info.NegativeTTL
+	}
+	return this
+}
+
+// Clamp limit a TTL to [Min, Max], and to Failover if `failover` is true. A 0 TTL is replaced with
+// the default TTL first.
+func (this TTLConfig) Clamp(ttl uint32, failover bool) uint32 {
+	if ttl == 0 {
+		ttl = this.Default
+	}
+	if ttl < this.Min {
+		ttl = this.Min
+	}
+	if this.Max != 0 && ttl > this.Max {
+		ttl = this.Max
+	}
+	if failover && this.Failover != 0 && ttl > this.Failover {
+		ttl = this.Failover
+	}
+	return ttl
+}
+
+// NormalizeRRSet set TTL of all of the records of an RRset to `ttl` and clamp it. `ttl` is the minimum
+// TTL of the whole RRset(RFC 2181 section 5.2), even the records that are not selected, so every
+// answer of a name have the same TTL regardless of the selected addresses.
+func (this TTLConfig) NormalizeRRSet(rrs []dns.RR, ttl uint32, failover bool) []dns.RR {
+	ttl = this.Clamp(ttl, failover)
+	for _, rr := range rrs {
+		rr.Header().Ttl = ttl
+	}
+	return rrs
+}
+
+// recordSet return the address set of a record that answer a question type(like the `Selector`, A
+// and AAAA questions fall back to CNAME), it returns nil if the type is not served from the records
+func recordSet(record *definitions.DNSRecord, qtype uint16) definitions.IDNSAddressRecord {
+	switch qtype {
+	case dns.TypeA:
+		if record.ARecords.LimitToActive().IsEmpty() {
+			return record.CNameRecords
+		}
+		return record.ARecords
+	case dns.TypeAAAA:
+		if record.AAAARecords.LimitToActive().IsEmpty() {
+			return record.CNameRecords
+		}
+		return record.AAAARecords
+	case dns.TypeCNAME:
+		return record.CNameRecords
+	case dns.TypeNS:
+		return record.NSRecords
+	case dns.TypeMX:
+		return record.MXRecords
+	case dns.TypeSRV:
+		return record.SRVRecords
+	case dns.TypeTXT:
+		return record.TXTRecords
+	default:
+		return nil
+	}
+}
+
+// activeTTL return the minimum TTL of the active(enabled and healthy) addresses of a set
+func activeTTL(set definitions.IDNSAddressRecord) uint32 {
+	if set == nil {
+		return 0
+	}
+	return minTTL(set.LimitToActive().AddressList())
+}
+func minTTL(addresses []definitions.IDNSAddress) uint32 {
+	var ttl uint32
+	for i, address := range addresses {
+		if i == 0 || address.BaseAddress().TTL < ttl {
+			ttl = address.BaseAddress().TTL
+		}
+	}
+	return ttl
+}
+
+// rrsetTTL return the minimum TTL of the records of an RRset, for the RRsets that are not built from
+// address sets
+func rrsetTTL(rrs []dns.RR) uint32 {
+	var ttl uint32
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+// usesFailover return `true` if the address set of a record that answer a question type use the
+// failover strategy
+func usesFailover(record *definitions.DNSRecord, qtype uint16) bool {
+	set := recordSet(record, qtype)
+	return set != nil && !set.IsEmpty() && set.GetStrategy() == definitions.Strategy_Failover
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+func newTTLRecord(strategy string, ttls ...uint32) *definitions.DNSRecord {
+	record := &definitions.DNSRecord{ARecords: &definitions.DNS_A_Record{Strategy: strategy}}
+	for i, address := range newAddresses(make([]uint16, len(ttls)), nil) {
+		a := *address.(*definitions.DNS_A_Address)
+		a.TTL, a.Weight = ttls[i], 1
+		record.ARecords.Addresses = append(record.ARecords.Addresses, a)
+	}
+	return record
+}
+
+func TestNormalizeRRSetUseWholeActiveSet(t *testing.T) {
+	// only one address is selected, but TTL of the answer is the minimum of the active set
+	record := newTTLRecord(definitions.Strategy_Weighted, 300, 60, 30)
+	record.ARecords.Addresses[2].Healthy = false
+	ttl := TTLConfig{Min: 5, Max: 3600}
+	set := recordSet(record, dns.TypeA)
+	if activeTTL(set) != 60 {
+		t.Fatalf("Expected TTL of active set to be 60, got %d", activeTTL(set))
+	}
+
+	selector := NewSelector(1)
+	for i := 0; i < 20; i++ {
+		rrs := ttl.NormalizeRRSet(selector.A("www.example.com.", record, nil), activeTTL(set), false)
+		if len(rrs) != 1 || rrs[0].Header().Ttl != 60 {
+			t.Fatalf("Expected a single answer with TTL 60, got %v", rrs)
+		}
+	}
+}
+
+func TestUsesFailoverOnlyForQuestionType(t *testing.T) {
+	record := newTTLRecord(definitions.Strategy_All, 300)
+	record.TXTRecords = &definitions.DNS_TXT_Record{Strategy: definitions.Strategy_Failover}
+	record.TXTRecords.Addresses = []definitions.DNS_TXT_Address{{}}
+	if usesFailover(record, dns.TypeA) {
+		t.Fatal("A answer use failover TTL because of the TXT records")
+	}
+	if !usesFailover(record, dns.TypeTXT) {
+		t.Fatal("TXT answer does not use failover TTL")
+	}
+}
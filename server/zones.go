@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devops-simba/redns/definitions"
+)
+
+// ZoneSet is the set of zones that this server is authoritative for
+type ZoneSet struct {
+	mutex sync.RWMutex
+	zones map[string]*definitions.ZoneInfo
+}
+
+func NewZoneSet() *ZoneSet {
+	return &ZoneSet{}
+}
+
+// Set replace content of this set with the zones and their settings
+func (this *ZoneSet) Set(zones map[string]*definitions.ZoneInfo) {
+	newZones := make(map[string]*definitions.ZoneInfo, len(zones))
+	for zone, info := range zones {
+		zone = normalizeZone(zone)
+		if zone != "" {
+			newZones[zone] = info
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.zones = newZones
+}
+
+// Len return number of zones in this set
+func (this *ZoneSet) Len() int {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return len(this.zones)
+}
+
+// Info return settings of a zone, it returns nil if zone does not have any settings
+func (this *ZoneSet) Info(zone string) *definitions.ZoneInfo {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.zones[zone]
+}
+
+// WithoutNameserver return the zones that does not have a nameserver in their settings
+func (this *ZoneSet) WithoutNameserver() []string {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	var result []string
+	for zone, info := range this.zones {
+		if info.PrimaryNameserver() == "" {
+			result = append(result, zone)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// FindZone find the closest zone that contain the name
+func (this *ZoneSet) FindZone(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for {
+		if _, ok := this.zones[name]; ok {
+			return name, true
+		}
+
+		i := strings.IndexByte(name, '.')
+		if i == -1 {
+			return "", false
+		}
+		name = name[i+1:]
+	}
+}
+
+// RefreshZones periodically reload the zones from the database until `stop` closed, `check` is called
+// after every reload and its error is logged whenever it changes
+func RefreshZones(database DNSDatabase, zones *ZoneSet, interval time.Duration, check func() error,
+	stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCheck := ""
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := LoadZones(database, zones)
+			if err != nil {
+				log.Printf("[ERR] Error in reloading zones: %v", err)
+				continue
+			}
+			if check == nil {
+				continue
+			}
+
+			checkResult := ""
+			if err = check(); err != nil {
+				checkResult = err.Error()
+			}
+			if checkResult != lastCheck {
+				if checkResult != "" {
+					log.Printf("[WRN] Invalid zones: %s", checkResult)
+				} else {
+					log.Printf("[INF] All zones are valid")
+				}
+				lastCheck = checkResult
+			}
+		}
+	}
+}
+
+// LoadZones load the zones from the database, we are only authoritative for the zones that have
+// their settings in the database
+func LoadZones(database DNSDatabase, zones *ZoneSet) error {
+	dbZones, err := database.GetZones()
+	if err != nil {
+		return err
+	}
+	zones.Set(dbZones)
+	return nil
+}
+
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}